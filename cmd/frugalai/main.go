@@ -1,44 +1,63 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
 	"os"
 	"os/signal"
-	"sync"
-	"sync/atomic"
+	"strings"
 	"syscall"
+	"text/tabwriter"
 	"time"
 
 	"github.com/mosajjal/frugalai/internal/config"
+	"github.com/mosajjal/frugalai/internal/manager"
 	"github.com/mosajjal/frugalai/internal/model"
+	"github.com/mosajjal/frugalai/internal/ollama"
 	"github.com/mosajjal/frugalai/internal/openrouter"
+	"github.com/mosajjal/frugalai/internal/popularity"
+	"github.com/mosajjal/frugalai/internal/provider"
+	"github.com/mosajjal/frugalai/internal/quota"
 	"github.com/mosajjal/frugalai/internal/server/anthropic"
 	"github.com/mosajjal/frugalai/internal/server/openai"
 	"github.com/urfave/cli/v2"
 )
 
-var (
-	startTime      time.Time
-	modelManager   *openrouter.ModelManager
-	modelManagerMu sync.RWMutex
-)
+var startTime time.Time
+
+// usageSaveInterval is how often the usage counts are written to the usage
+// file
+const usageSaveInterval = time.Minute
 
 func main() {
 	app := &cli.App{
-		Name:     "frugalai",
-		Usage:    "Intelligent LLM proxy that routes to the best free model on OpenRouter",
-		Version:  "1.0.0",
-		Before:   setupLogging,
+		Name:    "frugalai",
+		Usage:   "Intelligent LLM proxy that routes to the best free model on OpenRouter",
+		Version: "1.0.0",
+		Before:  setupLogging,
 		Flags: []cli.Flag{
 			&cli.StringFlag{
-				Name:     "api-key",
-				Aliases:  []string{"k"},
-				Usage:    "OpenRouter API key (can also set OPENROUTER_API_KEY env var)",
-				EnvVars:  []string{"OPENROUTER_API_KEY", "FRUGALAI_API_KEY"},
-				Required: true,
+				Name:    "api-key",
+				Aliases: []string{"k"},
+				Usage:   "OpenRouter API key (can also set OPENROUTER_API_KEY env var); without one only the configured providers are used",
+				EnvVars: []string{"OPENROUTER_API_KEY", "FRUGALAI_API_KEY"},
+			},
+			&cli.StringFlag{
+				Name:    "base-url",
+				Usage:   "OpenRouter API base URL (default: " + openrouter.DefaultBaseURL + ")",
+				Value:   openrouter.DefaultBaseURL,
+				EnvVars: []string{"FRUGALAI_BASE_URL"},
+			},
+			&cli.StringFlag{
+				Name:    "config",
+				Aliases: []string{"c"},
+				Usage:   "JSON config file with additional OpenAI-compatible providers",
+				EnvVars: []string{"FRUGALAI_CONFIG"},
 			},
 			&cli.IntFlag{
 				Name:    "port",
@@ -59,15 +78,40 @@ func main() {
 				Value:   0,
 				EnvVars: []string{"FRUGALAI_MIN_POPULARITY"},
 			},
+			&cli.StringFlag{
+				Name:    "popularity-snapshot",
+				Usage:   "JSON snapshot of model usage statistics, e.g. OpenRouter's rankings, to rank popularity offline",
+				EnvVars: []string{"FRUGALAI_POPULARITY_SNAPSHOT"},
+			},
+			&cli.StringFlag{
+				Name:    "usage-file",
+				Usage:   "JSON file to keep the proxy's successful requests per model in across restarts",
+				EnvVars: []string{"FRUGALAI_USAGE_FILE"},
+			},
+			&cli.StringFlag{
+				Name:    "model-overrides",
+				Usage:   "JSON file mapping model IDs or ID patterns to parameter counts and quality tiers",
+				EnvVars: []string{"FRUGALAI_MODEL_OVERRIDES"},
+			},
+			&cli.StringFlag{
+				Name:    "allow",
+				Usage:   "Comma-separated rules a model must match one of to be used, as [id|name|provider|tokenizer:]glob or /regex/; a glob's * also matches /",
+				EnvVars: []string{"FRUGALAI_ALLOW"},
+			},
+			&cli.StringFlag{
+				Name:    "deny",
+				Usage:   "Comma-separated rules that exclude the models they match, as [id|name|provider|tokenizer:]glob or /regex/; a glob's * also matches /",
+				EnvVars: []string{"FRUGALAI_DENY"},
+			},
 			&cli.BoolFlag{
-				Name:    "enable-openai",
-				Usage:   "Enable OpenAI-compatible API (default: true)",
-				Value:   true,
+				Name:  "enable-openai",
+				Usage: "Enable OpenAI-compatible API (default: true)",
+				Value: true,
 			},
 			&cli.BoolFlag{
-				Name:    "enable-anthropic",
-				Usage:   "Enable Anthropic-compatible API (default: true)",
-				Value:   true,
+				Name:  "enable-anthropic",
+				Usage: "Enable Anthropic-compatible API (default: true)",
+				Value: true,
 			},
 			&cli.StringFlag{
 				Name:  "openai-path",
@@ -96,6 +140,21 @@ func main() {
 				Usage:   "Comma-separated list of preferred architectures (e.g., transformer,llama)",
 				EnvVars: []string{"FRUGALAI_PREFERRED_ARCH"},
 			},
+			&cli.StringFlag{
+				Name:    "scorer",
+				Usage:   "Strategy that ranks the models: default, weighted (weights from the config file), context or latency (default: default)",
+				EnvVars: []string{"FRUGALAI_SCORER"},
+			},
+			&cli.StringFlag{
+				Name:    "adaptive",
+				Usage:   "Shift traffic toward the candidates that perform, ranking them with thompson or ucb (default: off)",
+				EnvVars: []string{"FRUGALAI_ADAPTIVE"},
+			},
+			&cli.Uint64Flag{
+				Name:    "adaptive-seed",
+				Usage:   "Seed of the adaptive ranking, for reproducible picks (default: random)",
+				EnvVars: []string{"FRUGALAI_ADAPTIVE_SEED"},
+			},
 			&cli.IntFlag{
 				Name:    "model-index",
 				Usage:   "Model index to use from candidates (default: 0)",
@@ -108,8 +167,51 @@ func main() {
 				Value:   10,
 				EnvVars: []string{"FRUGALAI_NUM_CANDIDATES"},
 			},
+			&cli.IntFlag{
+				Name:    "free-daily-limit",
+				Usage:   "Daily free model request quota of the OpenRouter account (default: 50, or 1000 with credits)",
+				EnvVars: []string{"FRUGALAI_FREE_DAILY_LIMIT"},
+			},
+			&cli.IntFlag{
+				Name:    "refresh-interval",
+				Usage:   "Seconds between background refreshes of the model candidates, 0 to disable (default: 1800)",
+				Value:   config.DefaultRefreshInterval,
+				EnvVars: []string{"FRUGALAI_REFRESH_INTERVAL"},
+			},
+			&cli.StringFlag{
+				Name:    "routing-mode",
+				Usage:   "How requested models are routed: auto (proxy chooses unless a candidate or alias is requested) or passthrough (any known model is honored)",
+				Value:   config.RoutingAuto,
+				EnvVars: []string{"FRUGALAI_ROUTING_MODE"},
+			},
+			&cli.StringFlag{
+				Name:    "auto-models",
+				Usage:   "Comma-separated model names that let the proxy choose",
+				Value:   strings.Join(config.DefaultAutoModels, ","),
+				EnvVars: []string{"FRUGALAI_AUTO_MODELS"},
+			},
+			&cli.StringFlag{
+				Name:    "merge-system-models",
+				Usage:   "Comma-separated model ID patterns that reject system messages; their system prompt is merged into the first user message",
+				Value:   strings.Join(config.DefaultSystemMergeModels, ","),
+				EnvVars: []string{"FRUGALAI_MERGE_SYSTEM_MODELS"},
+			},
 		},
 		Action: run,
+		Commands: []*cli.Command{
+			{
+				Name:      "explain",
+				Usage:     "List every free model with the factors of its score, its rank or the filter that rejected it",
+				UsageText: "frugalai [global options] explain [--json]",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "json",
+						Usage: "Print the explanation as JSON, as served by /candidates/explain",
+					},
+				},
+				Action: runExplain,
+			},
+		},
 	}
 
 	if err := app.Run(os.Args); err != nil {
@@ -149,34 +251,71 @@ func runHeadless(c *cli.Context) error {
 	startTime = time.Now()
 
 	// Build config from CLI
-	cfg := &config.Config{
-		APIKey:                c.String("api-key"),
-		Port:                  c.Int("port"),
-		MinParams:             c.Int("min-params"),
-		MinPopularity:         c.Int("min-popularity"),
-		EnableOpenAI:          c.Bool("enable-openai"),
-		EnableAnthropic:       c.Bool("enable-anthropic"),
-		OpenAIPath:            c.String("openai-path"),
-		AnthropicPath:         c.String("anthropic-path"),
-		LogLevel:              c.String("log-level"),
-		CacheTTL:              c.Int("cache-ttl"),
-		PreferredArchitectures: splitAndTrim(c.String("preferred-arch")),
-		ModelIndex:            c.Int("model-index"),
-		NumCandidates:         c.Int("num-candidates"),
+	cfg, err := configFromFlags(c)
+	if err != nil {
+		return err
 	}
 
-	// Create OpenRouter client
-	client := openrouter.NewClient(cfg.APIKey, cfg.CacheTTL)
+	// Create OpenRouter client, nil without an API key
+	client := newOpenRouterClient(cfg)
+
+	// Combine it with the configured providers
+	providers, err := buildProviders(client, cfg)
+	if err != nil {
+		return err
+	}
 
-	// Create model selector
-	selector := model.NewSelector(client, cfg)
+	// Create model selector, filtering models with the allow and deny rules
+	selector, usage, err := buildSelector(providers, cfg)
+	if err != nil {
+		return err
+	}
 
-	// Initialize model manager and select initial model
-	initializeModelManager(selector, cfg)
+	// Route the models clients ask for
+	router, err := model.NewRouter(selector, cfg)
+	if err != nil {
+		return err
+	}
+
+	// Stops background work on shutdown
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Rank the models with the configured strategy, which may use the
+	// latencies the model manager observes
+	modelManager := manager.New()
+	scorer, err := model.NewScorer(cfg, modelManager.Latency)
+	if err != nil {
+		return err
+	}
+	selector.SetScorer(scorer)
+	if err := modelManager.SetAdaptive(cfg.Adaptive, cfg.AdaptiveSeed); err != nil {
+		return err
+	}
+
+	// Keep the usage counts across restarts
+	usageSaved := usage.StartSaver(ctx, usageSaveInterval)
+
+	// Initialize model manager; candidates are loaded in the background
+	fetchCandidates := initializeModelManager(ctx, modelManager, selector, providers, cfg)
 
 	// Create handlers with model manager
-	openaiHandler := openai.NewHandlerWithManager(selector, client, modelManager)
-	anthropicHandler := anthropic.NewHandlerWithManager(selector, client, modelManager)
+	openaiHandler := openai.NewHandlerWithManager(selector, providers, modelManager)
+	anthropicHandler := anthropic.NewHandlerWithManager(selector, providers, modelManager)
+
+	// Track the daily free model quota from the key's credit status. Only
+	// OpenRouter has one.
+	quotaTracker := quota.New()
+	quotaTracker.SetLimit(cfg.FreeDailyLimit)
+	if client != nil && client.IsOpenRouter() {
+		quotaTracker.StartPoller(ctx, client)
+		openaiHandler.SetQuota(quotaTracker, providers.ServedByPrimary)
+		anthropicHandler.SetQuota(quotaTracker, providers.ServedByPrimary)
+	}
+	openaiHandler.SetRouter(router)
+	anthropicHandler.SetRouter(router)
+	openaiHandler.SetUsage(usage)
+	anthropicHandler.SetUsage(usage)
 
 	// Setup HTTP server
 	mux := http.NewServeMux()
@@ -194,16 +333,22 @@ func runHeadless(c *cli.Context) error {
 	}
 
 	// Health check endpoint with model info
-	mux.HandleFunc("/health", healthHandler)
+	mux.HandleFunc("/health", healthHandler(modelManager, quotaTracker))
 
 	// Model info endpoint
-	mux.HandleFunc("/model", modelInfoHandler)
+	mux.HandleFunc("/model", modelInfoHandler(modelManager))
 
 	// Model switch endpoint (for manual switching)
-	mux.HandleFunc("/model/switch", modelSwitchHandler)
+	mux.HandleFunc("/model/switch", modelSwitchHandler(modelManager))
 
 	// Candidates endpoint
-	mux.HandleFunc("/candidates", candidatesHandler(selector))
+	mux.HandleFunc("/candidates", candidatesHandler(modelManager, fetchCandidates, cfg.ModelIndex))
+
+	// Models filtered out by the configuration, with the reason
+	mux.HandleFunc("/candidates/rejected", rejectedHandler(selector))
+
+	// Every free model with the factors of its score and its rank
+	mux.HandleFunc("/candidates/explain", explainHandler(selector, cfg))
 
 	// Create server
 	server := &http.Server{
@@ -226,14 +371,103 @@ func runHeadless(c *cli.Context) error {
 	if err := server.Close(); err != nil {
 		log.Printf("[ERROR] Error closing server: %v", err)
 	}
+	cancel()
+	<-usageSaved
 	log.Println("[INFO] Server stopped")
 	return nil
 }
 
+// configFromFlags builds the configuration from the command line flags and
+// the config file they name
+func configFromFlags(c *cli.Context) (*config.Config, error) {
+	cfg := &config.Config{
+		APIKey:                 c.String("api-key"),
+		BaseURL:                c.String("base-url"),
+		ConfigFile:             c.String("config"),
+		Port:                   c.Int("port"),
+		MinParams:              c.Int("min-params"),
+		MinPopularity:          c.Int("min-popularity"),
+		PopularitySnapshot:     c.String("popularity-snapshot"),
+		UsageFile:              c.String("usage-file"),
+		ModelOverrides:         c.String("model-overrides"),
+		Allow:                  splitAndTrim(c.String("allow")),
+		Deny:                   splitAndTrim(c.String("deny")),
+		EnableOpenAI:           c.Bool("enable-openai"),
+		EnableAnthropic:        c.Bool("enable-anthropic"),
+		OpenAIPath:             c.String("openai-path"),
+		AnthropicPath:          c.String("anthropic-path"),
+		LogLevel:               c.String("log-level"),
+		CacheTTL:               c.Int("cache-ttl"),
+		PreferredArchitectures: splitAndTrim(c.String("preferred-arch")),
+		Scorer:                 c.String("scorer"),
+		Adaptive:               c.String("adaptive"),
+		AdaptiveSeed:           c.Uint64("adaptive-seed"),
+		ModelIndex:             c.Int("model-index"),
+		NumCandidates:          c.Int("num-candidates"),
+		FreeDailyLimit:         c.Int("free-daily-limit"),
+		RefreshInterval:        c.Int("refresh-interval"),
+		SystemMergeModels:      splitAndTrim(c.String("merge-system-models")),
+		RoutingMode:            c.String("routing-mode"),
+		AutoModels:             splitAndTrim(c.String("auto-models")),
+	}
+
+	if cfg.ConfigFile != "" {
+		if err := config.LoadFile(cfg.ConfigFile, cfg); err != nil {
+			return nil, err
+		}
+	}
+	return cfg, nil
+}
+
+// buildSelector creates the model selector of the providers' models, with
+// their parameter counts and popularity filled in, and the tracker of the
+// usage it ranks popularity with
+func buildSelector(providers *provider.Registry, cfg *config.Config) (*model.Selector, *popularity.Usage, error) {
+	// Fill in the parameter counts the providers do not report
+	var overrides model.Overrides
+	if cfg.ModelOverrides != "" {
+		var err error
+		if overrides, err = model.LoadOverrides(cfg.ModelOverrides); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Filter the models with the allow and deny rules
+	rules, err := model.NewRules(cfg.Allow, cfg.Deny)
+	if err != nil {
+		return nil, nil, err
+	}
+	enricher := model.NewEnricher(providers, overrides)
+	if cfg.PopularitySnapshot != "" {
+		snapshot, err := popularity.LoadSnapshot(cfg.PopularitySnapshot)
+		if err != nil {
+			return nil, nil, err
+		}
+		enricher.SetPopularity(snapshot)
+	}
+	selector := model.NewSelector(enricher, cfg)
+	selector.SetRules(rules)
+
+	// Count the requests each model serves, to rank popularity with
+	usage, err := popularity.NewUsage(cfg.UsageFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	selector.SetUsage(usage)
+	return selector, usage, nil
+}
+
 func runServer(server *http.Server, cfg *config.Config) {
 	for {
 		log.Printf("[INFO] FrugalAI proxy listening on port %d", cfg.Port)
 		log.Printf("[INFO] Min params: %d, Min popularity: %d", cfg.MinParams, cfg.MinPopularity)
+		log.Printf("[INFO] Routing mode: %s", cfg.RoutingMode)
+		if cfg.Scorer != "" {
+			log.Printf("[INFO] Scorer: %s", cfg.Scorer)
+		}
+		if cfg.Adaptive != "" {
+			log.Printf("[INFO] Adaptive ranking: %s", cfg.Adaptive)
+		}
 		if len(cfg.PreferredArchitectures) > 0 {
 			log.Printf("[INFO] Preferred architectures: %v", cfg.PreferredArchitectures)
 		}
@@ -249,174 +483,232 @@ func runServer(server *http.Server, cfg *config.Config) {
 	}
 }
 
-func initializeModelManager(selector *model.Selector, cfg *config.Config) {
-	log.Println("[INFO] Fetching available free models from OpenRouter...")
-
-	candidates, err := selector.GetTopCandidates(cfg.NumCandidates)
-	if err != nil {
-		log.Printf("[WARN] Could not get model candidates: %v", err)
-		log.Println("[INFO] Will retry on first request")
-		// Create empty manager - will be populated later
-		modelManager = &openrouter.ModelManager{
-			Candidates:  []openrouter.Model{},
-			Current:     nil,
-			CurrentIdx:  0,
-			Failures:    make(map[string]int),
-			LastFailure: make(map[string]time.Time),
-			Timeouts:    make(map[string]int),
-			Burned:      make(map[string]bool),
-		}
-		return
-	}
-
-	// Show candidates
-	log.Printf("[INFO] Found %d free model candidates:", len(candidates))
-	for i, m := range candidates {
-		log.Printf("  [%d] %s", i, m.Name)
-		log.Printf("      ID: %s", m.ID)
-		log.Printf("      Modality: %s, Tokenizer: %s", m.Architecture.Modality, m.Architecture.Tokenizer)
-	}
-
-	// Select model
-	selectedIdx := 0
-	if cfg.ModelIndex >= 0 && cfg.ModelIndex < len(candidates) {
-		selectedIdx = cfg.ModelIndex
-		log.Printf("[INFO] Using model index from CLI: %d", cfg.ModelIndex)
-	} else if cfg.ModelIndex == -1 {
-		selectedIdx = 0
-		log.Printf("[INFO] Using best model (index 0)")
-	} else {
-		selectedIdx = 0
-		log.Printf("[INFO] Using best model (index 0)")
-	}
-
-	selectedModel := candidates[selectedIdx]
-	log.Printf("[INFO] Selected model: %s", selectedModel.Name)
-	log.Printf("[INFO]   ID: %s", selectedModel.ID)
-	log.Printf("[INFO]   Modality: %s", selectedModel.Architecture.Modality)
-	log.Printf("[INFO]   Tokenizer: %s", selectedModel.Architecture.Tokenizer)
-	log.Printf("[INFO]   Context Length: %d", selectedModel.ContextLength)
-
-	// Create model manager
-	modelManager = &openrouter.ModelManager{
-		Candidates:  candidates,
-		Current:     &candidates[selectedIdx],
-		CurrentIdx:  selectedIdx,
-		Failures:    make(map[string]int),
-		LastFailure: make(map[string]time.Time),
-		Timeouts:    make(map[string]int),
-		Burned:      make(map[string]bool),
+// newOpenRouterClient creates the OpenRouter client, or returns nil when
+// there is no API key for it
+func newOpenRouterClient(cfg *config.Config) *openrouter.Client {
+	if cfg.APIKey == "" {
+		return nil
 	}
+	return openrouter.NewClientWithConfig(openrouter.ClientConfig{
+		BaseURL:  cfg.BaseURL,
+		APIKey:   cfg.APIKey,
+		CacheTTL: cfg.CacheTTL,
+	})
 }
 
-func healthHandler(w http.ResponseWriter, r *http.Request) {
-	modelManagerMu.RLock()
-	defer modelManagerMu.RUnlock()
-
-	status := openrouter.HealthStatus{
-		Status: "ok",
-		Uptime: time.Since(startTime).Seconds(),
-	}
+// buildProviders registers the configured providers next to the OpenRouter
+// client. Without a client the configured providers are used alone, and
+// their model IDs keep the provider prefix.
+func buildProviders(client *openrouter.Client, cfg *config.Config) (*provider.Registry, error) {
+	// A nil client must not become a non-nil Provider
+	var primary provider.Provider
+	if client != nil {
+		primary = client
+	} else {
+		if len(cfg.Providers) == 0 {
+			return nil, errors.New("no upstream: set an OpenRouter API key or configure providers in the config file")
+		}
+		log.Printf("[INFO] No OpenRouter API key, using the configured providers only")
+	}
+	registry := provider.NewRegistry(primary)
+	for _, p := range cfg.Providers {
+		var upstream provider.Provider
+		switch p.Type {
+		case config.ProviderOllama:
+			upstream = ollama.NewClient(ollama.Config{
+				Name:          p.Name,
+				BaseURL:       p.BaseURL,
+				CacheTTL:      cfg.CacheTTL,
+				FreeModels:    p.FreeModels,
+				ContextLength: p.ContextLength,
+			})
+		default:
+			freeModels := p.FreeModels
+			if p.Type == config.ProviderLlamaCpp && len(freeModels) == 0 {
+				freeModels = []string{"*"}
+			}
+			upstream = openrouter.NewClientWithConfig(openrouter.ClientConfig{
+				Name:          p.Name,
+				BaseURL:       p.BaseURL,
+				APIKey:        p.Key(),
+				CacheTTL:      cfg.CacheTTL,
+				FreeModels:    freeModels,
+				ContextLength: p.ContextLength,
+			})
+		}
 
-	if modelManager != nil {
-		status.Candidates = len(modelManager.Candidates)
-		if modelManager.Current != nil {
-			status.Model = modelManager.Current.ID
-			status.ModelName = modelManager.Current.Name
+		if p.Fallback {
+			if err := registry.AddFallback(upstream); err != nil {
+				return nil, err
+			}
+			log.Printf("[INFO] Fallback provider %s enabled", p.Name)
+			continue
+		}
+		if err := registry.Add(upstream); err != nil {
+			return nil, err
 		}
+		log.Printf("[INFO] Provider %s enabled at %s", p.Name, p.BaseURL)
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(status)
+	return registry, nil
 }
 
-func modelInfoHandler(w http.ResponseWriter, r *http.Request) {
-	modelManagerMu.RLock()
-	defer modelManagerMu.RUnlock()
+// initializeModelManager loads the candidates of the model manager in the
+// background, refreshing them every cfg.RefreshInterval seconds
+func initializeModelManager(ctx context.Context, mgr *manager.Manager, selector *model.Selector, client *provider.Registry, cfg *config.Config) manager.Fetcher {
+	log.Println("[INFO] Fetching available free models...")
 
-	if modelManager.Current == nil {
-		http.Error(w, "No model selected", http.StatusServiceUnavailable)
-		return
+	// Bypass the client's model cache so refreshes see models that stopped
+	// being free
+	fetch := func() ([]openrouter.Model, error) {
+		client.InvalidateCache()
+		return selector.GetTopCandidates(cfg.NumCandidates)
 	}
 
-	m := modelManager.Current
-	w.Header().Set("Content-Type", "application/json")
-	fmt.Fprintf(w, `{"model_id":"%s","name":"%s","modality":"%s","tokenizer":"%s","context_length":%d,"params":%d,"popularity":%d}`,
-		m.ID, m.Name, m.Architecture.Modality, m.Architecture.Tokenizer, m.ContextLength, m.Params, m.Popularity)
+	mgr.SetFallbackFetcher(client.GetFallbackModels)
+	mgr.SetPoolFetcher(selector.GetRankedModels)
+	mgr.StartRefresher(ctx, time.Duration(cfg.RefreshInterval)*time.Second, fetch, cfg.ModelIndex)
+	return fetch
 }
 
-func modelSwitchHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+func healthHandler(mgr *manager.Manager, quotaTracker *quota.Tracker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := openrouter.HealthStatus{
+			Status:     "ok",
+			Uptime:     time.Since(startTime).Seconds(),
+			Candidates: len(mgr.Candidates()),
+			Quota:      quotaTracker.Status(),
+		}
+
+		if current, ok := mgr.Current(); ok {
+			status.Model = current.ID
+			status.ModelName = current.Name
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(status)
 	}
+}
 
-	modelManagerMu.Lock()
-	defer modelManagerMu.Unlock()
+func modelInfoHandler(mgr *manager.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		m, ok := mgr.Current()
+		if !ok {
+			http.Error(w, "No model selected", http.StatusServiceUnavailable)
+			return
+		}
 
-	// Try to switch to next available model
-	if len(modelManager.Candidates) == 0 {
-		http.Error(w, "No candidates available", http.StatusServiceUnavailable)
-		return
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"model_id":"%s","name":"%s","modality":"%s","tokenizer":"%s","context_length":%d,"params":%d,"popularity":%d}`,
+			m.ID, m.Name, m.Architecture.Modality, m.Architecture.Tokenizer, m.ContextLength, m.Params, m.Popularity)
 	}
+}
 
-	// Move to next candidate, wrapping around
-	nextIdx := (modelManager.CurrentIdx + 1) % len(modelManager.Candidates)
-	modelManager.Current = &modelManager.Candidates[nextIdx]
-	modelManager.CurrentIdx = nextIdx
+func modelSwitchHandler(mgr *manager.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
 
-	log.Printf("[INFO] Switched to model: %s (index %d)", modelManager.Current.Name, nextIdx)
+		// Move to next candidate, wrapping around
+		next, nextIdx, ok := mgr.SwitchNext()
+		if !ok {
+			http.Error(w, "No candidates available", http.StatusServiceUnavailable)
+			return
+		}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"status":     "switched",
-		"model_id":   modelManager.Current.ID,
-		"model_name": modelManager.Current.Name,
-		"index":      nextIdx,
-	})
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":     "switched",
+			"model_id":   next.ID,
+			"model_name": next.Name,
+			"index":      nextIdx,
+		})
+	}
 }
 
-func candidatesHandler(selector *model.Selector) http.HandlerFunc {
+func candidatesHandler(mgr *manager.Manager, fetch manager.Fetcher, initialIdx int) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		modelManagerMu.RLock()
-		defer modelManagerMu.RUnlock()
-
-		if len(modelManager.Candidates) == 0 {
-			// Try to refresh candidates
-			candidates, err := selector.GetTopCandidates(10)
-			if err != nil {
+		if len(mgr.Candidates()) == 0 {
+			// Try to refresh candidates; the fallback models are still
+			// worth listing when that fails
+			if err := mgr.Refresh(fetch, initialIdx); err != nil && len(mgr.Fallbacks()) == 0 {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
-			modelManager.Candidates = candidates
 		}
 
 		type Candidate struct {
-			Index      int      `json:"index"`
-			ID         string   `json:"id"`
-			Name       string   `json:"name"`
-			Modality   string   `json:"modality"`
-			Tokenizer  string   `json:"tokenizer"`
-			ContextLen int      `json:"context_length"`
-			Params     int      `json:"params"`
-			Popularity int      `json:"popularity"`
-			IsCurrent  bool     `json:"is_current"`
-			Failures   int      `json:"failures"`
+			Index      int        `json:"index"`
+			ID         string     `json:"id"`
+			Provider   string     `json:"provider"`
+			Name       string     `json:"name"`
+			Modality   string     `json:"modality"`
+			Tokenizer  string     `json:"tokenizer"`
+			ContextLen int        `json:"context_length"`
+			Params     int        `json:"params"`
+			Active     int        `json:"active_params,omitempty"`
+			Tier       string     `json:"quality_tier,omitempty"`
+			Popularity int        `json:"popularity"`
+			PopScore   float64    `json:"popularity_score,omitempty"`
+			IsCurrent  bool       `json:"is_current"`
+			Fallback   bool       `json:"fallback,omitempty"`
+			Failures   int        `json:"failures"`
+			Timeouts   int        `json:"timeouts"`
+			Breaker    string     `json:"breaker"`
+			Trips      int        `json:"trips"`
+			OpenUntil  *time.Time `json:"open_until,omitempty"`
+			Remaining  *int       `json:"ratelimit_remaining,omitempty"`
+			LatencyMs  int64      `json:"latency_ms,omitempty"`
+			TTFTMs     int64      `json:"ttft_ms,omitempty"`
+			TokensSec  float64    `json:"tokens_per_sec,omitempty"`
+			Successes  int        `json:"successes"`
+			Success    *float64   `json:"success_ratio,omitempty"`
+			Expected   float64    `json:"expected_reward,omitempty"`
 		}
 
 		result := []Candidate{}
-		for i, m := range modelManager.Candidates {
+		for _, c := range mgr.Status() {
+			m := c.Model
+			var openUntil *time.Time
+			if !c.OpenUntil.IsZero() {
+				openUntil = &c.OpenUntil
+			}
+			var remaining *int
+			if c.RateLimitRemaining >= 0 {
+				remaining = &c.RateLimitRemaining
+			}
+			var success *float64
+			if c.Metrics.Successes+c.Metrics.Failures > 0 {
+				success = &c.Metrics.SuccessRatio
+			}
 			result = append(result, Candidate{
-				Index:      i,
+				Index:      c.Index,
 				ID:         m.ID,
+				Provider:   m.Provider,
 				Name:       m.Name,
 				Modality:   m.Architecture.Modality,
 				Tokenizer:  m.Architecture.Tokenizer,
 				ContextLen: m.ContextLength,
 				Params:     m.Params,
+				Active:     m.ActiveParams,
+				Tier:       m.QualityTier,
 				Popularity: m.Popularity,
-				IsCurrent:  modelManager.Current != nil && m.ID == modelManager.Current.ID,
-				Failures:   modelManager.Failures[m.ID],
+				PopScore:   m.PopularityScore,
+				IsCurrent:  c.IsCurrent,
+				Fallback:   c.Fallback,
+				Failures:   c.Failures,
+				Timeouts:   c.Timeouts,
+				Breaker:    c.Breaker.String(),
+				Trips:      c.Trips,
+				OpenUntil:  openUntil,
+				Remaining:  remaining,
+				LatencyMs:  c.Metrics.Latency.Milliseconds(),
+				TTFTMs:     c.Metrics.TTFT.Milliseconds(),
+				TokensSec:  c.Metrics.TokensPerSec,
+				Successes:  c.Metrics.Successes,
+				Success:    success,
+				Expected:   c.Expected,
 			})
 		}
 
@@ -425,135 +717,193 @@ func candidatesHandler(selector *model.Selector) http.HandlerFunc {
 	}
 }
 
-// GetCurrentModelID returns the current model ID (thread-safe)
-func GetCurrentModelID() string {
-	modelManagerMu.RLock()
-	defer modelManagerMu.RUnlock()
-
-	if modelManager == nil || modelManager.Current == nil {
-		return ""
-	}
-	return modelManager.Current.ID
-}
+func rejectedHandler(selector *model.Selector) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rejected, err := selector.GetRejectedModels()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
 
-// RecordModelFailure records a failure for the current model and potentially switches
-func RecordModelFailure(modelID string, statusCode int) bool {
-	modelManagerMu.Lock()
-	defer modelManagerMu.Unlock()
-
-	if modelManager == nil {
-		return false
-	}
-
-	// Increment failure count
-	modelManager.Failures[modelID]++
-	modelManager.LastFailure[modelID] = time.Now()
-
-	log.Printf("[WARN] Model %s failed (status %d), failure count: %d",
-		modelID, statusCode, modelManager.Failures[modelID])
-
-	// Check if we should switch models
-	// Switch on: 429 (rate limit), 500+, or 3+ failures in quick succession
-	shouldSwitch := false
-
-	if statusCode == 429 {
-		shouldSwitch = true
-		log.Printf("[INFO] Rate limit hit, switching model")
-	} else if statusCode >= 500 {
-		shouldSwitch = true
-		log.Printf("[INFO] Server error, switching model")
-	} else if modelManager.Failures[modelID] >= 3 {
-		// Check if failures happened recently (within 2 minutes)
-		recentFailures := 0
-		cutoff := time.Now().Add(-2 * time.Minute)
-		if modelManager.LastFailure[modelID].After(cutoff) {
-			recentFailures = modelManager.Failures[modelID]
+		type Rejection struct {
+			ID        string `json:"id"`
+			Provider  string `json:"provider"`
+			Name      string `json:"name"`
+			Tokenizer string `json:"tokenizer"`
+			Params    int    `json:"params"`
+			Reason    string `json:"reason"`
 		}
-		if recentFailures >= 3 {
-			shouldSwitch = true
-			log.Printf("[INFO] Multiple recent failures, switching model")
+
+		result := []Rejection{}
+		for _, rej := range rejected {
+			m := rej.Model
+			result = append(result, Rejection{
+				ID:        m.ID,
+				Provider:  m.Provider,
+				Name:      m.Name,
+				Tokenizer: m.Architecture.Tokenizer,
+				Params:    m.Params,
+				Reason:    rej.Reason,
+			})
 		}
-	}
 
-	if shouldSwitch && len(modelManager.Candidates) > 1 {
-		// Find next candidate that isn't the current one
-		for i := 1; i < len(modelManager.Candidates); i++ {
-			nextIdx := (modelManager.CurrentIdx + i) % len(modelManager.Candidates)
-			nextModel := modelManager.Candidates[nextIdx]
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	}
+}
 
-			// Skip if this model also has recent failures
-			if modelManager.Failures[nextModel.ID] >= 3 {
-				continue
-			}
+// explainEntry is a free model in the selection explanation
+type explainEntry struct {
+	Rank      int             `json:"rank"`
+	ID        string          `json:"id"`
+	Provider  string          `json:"provider,omitempty"`
+	Name      string          `json:"name"`
+	Score     float64         `json:"score"`
+	Candidate bool            `json:"candidate"`
+	Rejected  string          `json:"rejected,omitempty"`
+	Factors   []explainFactor `json:"factors"`
+}
 
-			log.Printf("[INFO] Switching from %s to %s",
-				modelManager.Current.ID, nextModel.ID)
+// explainFactor is a factor of a model's score
+type explainFactor struct {
+	Name    string          `json:"name"`
+	Value   float64         `json:"value"`
+	Weight  float64         `json:"weight"`
+	Score   float64         `json:"score"`
+	Factors []explainFactor `json:"factors,omitempty"`
+}
 
-			modelManager.Current = &nextModel
-			modelManager.CurrentIdx = nextIdx
-			return true
-		}
+// explain lists every free model with the factors of its score. The top
+// ranked models, as many as there are candidates, are marked as such.
+func explain(selector *model.Selector, cfg *config.Config) ([]explainEntry, error) {
+	explanations, err := selector.Explain()
+	if err != nil {
+		return nil, err
+	}
+
+	result := []explainEntry{}
+	for _, e := range explanations {
+		result = append(result, explainEntry{
+			Rank:      e.Rank,
+			ID:        e.Model.ID,
+			Provider:  e.Model.Provider,
+			Name:      e.Model.Name,
+			Score:     e.Score,
+			Candidate: e.Rank > 0 && e.Rank <= cfg.NumCandidates,
+			Rejected:  e.Rejected,
+			Factors:   explainFactors(e.Factors),
+		})
+	}
+	return result, nil
+}
 
-		log.Printf("[WARN] No alternative models available, keeping current model")
+func explainFactors(factors []model.Factor) []explainFactor {
+	result := []explainFactor{}
+	for _, f := range factors {
+		result = append(result, explainFactor{
+			Name:    f.Name,
+			Value:   f.Value,
+			Weight:  f.Weight,
+			Score:   f.Score,
+			Factors: explainFactors(f.Factors),
+		})
 	}
-
-	return false
+	return result
 }
 
-// RecordModelTimeout records a timeout for a model and potentially burns/switches it
-func RecordModelTimeout(modelID string) bool {
-	modelManagerMu.Lock()
-	defer modelManagerMu.Unlock()
+func explainHandler(selector *model.Selector, cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		result, err := explain(selector, cfg)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
 
-	if modelManager == nil {
-		return false
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
 	}
+}
 
-	// Increment timeout count
-	modelManager.Timeouts[modelID]++
-
-	log.Printf("[WARN] Model %s timed out, timeout count: %d",
-		modelID, modelManager.Timeouts[modelID])
+// runExplain prints the selection explanation of the configuration and
+// exits. Logs go to stderr so the output can be piped.
+func runExplain(c *cli.Context) error {
+	setupLogging(c)
+	log.SetOutput(os.Stderr)
 
-	// Burn model on first timeout
-	modelManager.Burned[modelID] = true
-	log.Printf("[WARN] Model %s burned after %d timeouts",
-		modelID, modelManager.Timeouts[modelID])
+	cfg, err := configFromFlags(c)
+	if err != nil {
+		return err
+	}
+	providers, err := buildProviders(newOpenRouterClient(cfg), cfg)
+	if err != nil {
+		return err
+	}
+	selector, _, err := buildSelector(providers, cfg)
+	if err != nil {
+		return err
+	}
 
-	// Switch to next non-burned model
-	if len(modelManager.Candidates) > 1 {
-		for i := 1; i < len(modelManager.Candidates); i++ {
-			nextIdx := (modelManager.CurrentIdx + i) % len(modelManager.Candidates)
-			nextModel := modelManager.Candidates[nextIdx]
+	// Nothing is observed outside the proxy, so the latency scorer ranks
+	// by its fallback
+	scorer, err := model.NewScorer(cfg, func(string) (time.Duration, bool) { return 0, false })
+	if err != nil {
+		return err
+	}
+	selector.SetScorer(scorer)
 
-			// Skip burned models
-			if modelManager.Burned[nextModel.ID] {
-				continue
+	result, err := explain(selector, cfg)
+	if err != nil {
+		return err
+	}
+	if c.Bool("json") {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(result)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "RANK\tSCORE\tMODEL\tFACTORS\tREJECTED")
+	for _, e := range result {
+		rank := "-"
+		if e.Rank > 0 {
+			rank = fmt.Sprint(e.Rank)
+			if e.Candidate {
+				rank += "*"
 			}
-
-			log.Printf("[INFO] Switching from %s to %s due to timeout",
-				modelManager.Current.ID, nextModel.ID)
-
-			modelManager.Current = &nextModel
-			modelManager.CurrentIdx = nextIdx
-			return true
 		}
-
-		log.Printf("[WARN] All models burned or unavailable, keeping current model")
+		fmt.Fprintf(tw, "%s\t%.3f\t%s\t%s\t%s\n", rank, e.Score, e.ID, formatFactors(e.Factors), e.Rejected)
 	}
-
-	return false
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Println("\n* candidate; weighted factors are value x weight = score")
+	return nil
 }
 
-// GetCandidates returns the list of candidate models (thread-safe)
-func GetCandidates() []openrouter.Model {
-	modelManagerMu.RLock()
-	defer modelManagerMu.RUnlock()
+// formatFactors writes weighted factors as name=valuexweight=score and the
+// others as name=score, with nested factors in parentheses
+func formatFactors(factors []explainFactor) string {
+	parts := []string{}
+	for _, f := range factors {
+		part := f.Name + "=" + formatNumber(f.Score)
+		if f.Weight != 1 {
+			part = fmt.Sprintf("%s=%sx%s=%s", f.Name, formatNumber(f.Value), formatNumber(f.Weight), formatNumber(f.Score))
+		}
+		if len(f.Factors) > 0 {
+			part += " (" + formatFactors(f.Factors) + ")"
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, " ")
+}
 
-	if modelManager == nil {
-		return []openrouter.Model{}
+// formatNumber writes whole numbers such as context lengths in full and
+// the others to three significant digits
+func formatNumber(f float64) string {
+	if f == math.Trunc(f) {
+		return fmt.Sprintf("%.0f", f)
 	}
-	return modelManager.Candidates
+	return fmt.Sprintf("%.3g", f)
 }
 
 func splitAndTrim(s string) []string {
@@ -604,22 +954,3 @@ func trimSpace(s string) string {
 	}
 	return s[start:end]
 }
-
-// Atomic model ID accessor for handlers
-var currentModelID atomic.Value
-
-func init() {
-	currentModelID.Store("")
-}
-
-func SetCurrentModelID(id string) {
-	currentModelID.Store(id)
-}
-
-func LoadCurrentModelID() string {
-	v := currentModelID.Load()
-	if v == nil {
-		return ""
-	}
-	return v.(string)
-}
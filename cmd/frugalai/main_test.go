@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mosajjal/frugalai/internal/config"
+	"github.com/mosajjal/frugalai/internal/model"
+	"github.com/mosajjal/frugalai/internal/openrouter"
+)
+
+// staticSource is a model source listing fixed models, all of them free
+type staticSource []openrouter.Model
+
+func (s staticSource) GetModels() ([]openrouter.Model, error)     { return s, nil }
+func (s staticSource) GetFreeModels() ([]openrouter.Model, error) { return s, nil }
+
+// failingSource is a model source that cannot be reached
+type failingSource struct{}
+
+func (failingSource) GetModels() ([]openrouter.Model, error) { return nil, errors.New("unreachable") }
+func (failingSource) GetFreeModels() ([]openrouter.Model, error) {
+	return nil, errors.New("unreachable")
+}
+
+// testExplainSelector returns a selector over three models, the smallest
+// of them below the configured minimum size
+func testExplainSelector(cfg *config.Config) *model.Selector {
+	return model.NewSelector(staticSource{
+		{ID: "vendor/small", Params: 8_000_000_000, ContextLength: 8192},
+		{ID: "vendor/tiny", Params: 500_000_000, ContextLength: 8192},
+		{ID: "groq:large", Provider: "groq", Name: "Large", Params: 70_000_000_000, ContextLength: 131072},
+	}, cfg)
+}
+
+func TestExplain(t *testing.T) {
+	cfg := &config.Config{MinParams: 1_000_000_000, NumCandidates: 1}
+	result, err := explain(testExplainSelector(cfg), cfg)
+	if err != nil {
+		t.Fatalf("explain() error = %v", err)
+	}
+
+	// Only the top ranked models, as many as there are candidates, are
+	// marked as candidates
+	want := []explainEntry{
+		{Rank: 1, ID: "groq:large", Provider: "groq", Name: "Large", Candidate: true},
+		{Rank: 2, ID: "vendor/small"},
+		{ID: "vendor/tiny", Rejected: "500000000 params is below the minimum of 1000000000"},
+	}
+	if len(result) != len(want) {
+		t.Fatalf("got %d entries, want %d", len(result), len(want))
+	}
+	for i, w := range want {
+		e := result[i]
+		if e.Rank != w.Rank || e.ID != w.ID || e.Provider != w.Provider || e.Name != w.Name || e.Candidate != w.Candidate || e.Rejected != w.Rejected {
+			t.Errorf("entry %d = %+v, want %+v", i, e, w)
+		}
+		if len(e.Factors) == 0 || e.Factors[0].Name != model.FactorPopularity {
+			t.Errorf("entry %d factors = %+v, want the weighted scorer's", i, e.Factors)
+		}
+	}
+}
+
+func TestExplainNestedFactors(t *testing.T) {
+	cfg := &config.Config{NumCandidates: 3}
+	selector := testExplainSelector(cfg)
+	selector.SetScorer(&model.ContextScorer{Tiebreak: &model.WeightedScorer{Weights: model.DefaultWeights}})
+
+	result, err := explain(selector, cfg)
+	if err != nil {
+		t.Fatalf("explain() error = %v", err)
+	}
+	factors := result[0].Factors
+	if len(factors) != 2 || factors[1].Name != model.FactorTiebreak || len(factors[1].Factors) == 0 {
+		t.Errorf("factors = %+v, want the context and the tiebreak broken down", factors)
+	}
+}
+
+func TestFormatFactors(t *testing.T) {
+	tests := []struct {
+		name    string
+		factors []explainFactor
+		want    string
+	}{
+		{name: "none", want: ""},
+		{
+			name: "weighted and unweighted",
+			factors: []explainFactor{
+				{Name: "params", Value: 0.5, Weight: 0.3, Score: 0.15},
+				{Name: "penalty", Value: -0.05, Weight: 1, Score: -0.05},
+			},
+			want: "params=0.5x0.3=0.15 penalty=-0.05",
+		},
+		{
+			name: "whole numbers in full",
+			factors: []explainFactor{
+				{Name: "context", Value: 131072, Weight: 1, Score: 131072},
+			},
+			want: "context=131072",
+		},
+		{
+			name: "nested",
+			factors: []explainFactor{
+				{Name: "context", Value: 8192, Weight: 1, Score: 8192},
+				{Name: "tiebreak", Value: 0.4567, Weight: 1, Score: 0.3135, Factors: []explainFactor{
+					{Name: "params", Value: 0.25, Weight: 0.2, Score: 0.05},
+					{Name: "vendor_bonus", Value: 0.1, Weight: 1, Score: 0.1},
+				}},
+			},
+			want: "context=8192 tiebreak=0.314 (params=0.25x0.2=0.05 vendor_bonus=0.1)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatFactors(tt.factors); got != tt.want {
+				t.Errorf("formatFactors() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExplainHandler(t *testing.T) {
+	cfg := &config.Config{MinParams: 1_000_000_000, NumCandidates: 1}
+	rec := httptest.NewRecorder()
+	explainHandler(testExplainSelector(cfg), cfg)(rec, httptest.NewRequest(http.MethodGet, "/candidates/explain", nil))
+
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("response = %d %s, want a 200 JSON response", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	var result []struct {
+		Rank      int    `json:"rank"`
+		ID        string `json:"id"`
+		Candidate bool   `json:"candidate"`
+		Rejected  string `json:"rejected"`
+		Factors   []struct {
+			Name   string  `json:"name"`
+			Weight float64 `json:"weight"`
+		} `json:"factors"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatalf("invalid response %s: %v", rec.Body.String(), err)
+	}
+	if len(result) != 3 {
+		t.Fatalf("got %d entries, want 3: %s", len(result), rec.Body.String())
+	}
+	if first := result[0]; first.ID != "groq:large" || first.Rank != 1 || !first.Candidate || len(first.Factors) == 0 {
+		t.Errorf("first entry = %+v, want the ranked candidate with its factors", first)
+	}
+	if last := result[2]; last.ID != "vendor/tiny" || last.Rank != 0 || last.Rejected == "" {
+		t.Errorf("last entry = %+v, want the rejected model with its reason", last)
+	}
+}
+
+func TestExplainHandlerError(t *testing.T) {
+	cfg := &config.Config{}
+	rec := httptest.NewRecorder()
+	explainHandler(model.NewSelector(failingSource{}, cfg), cfg)(rec, httptest.NewRequest(http.MethodGet, "/candidates/explain", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("response = %d, want a 500 when the models cannot be listed", rec.Code)
+	}
+}
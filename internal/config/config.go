@@ -10,6 +10,16 @@ type Config struct {
 	// OpenRouter API key (required)
 	APIKey string
 
+	// OpenRouter API base URL (default: https://openrouter.ai/api/v1)
+	BaseURL string
+
+	// Path of a JSON config file with additional providers
+	ConfigFile string
+
+	// Additional OpenAI-compatible providers whose free models compete
+	// with OpenRouter's for the candidate list
+	Providers []ProviderConfig
+
 	// Server port (default: 8080)
 	Port int
 
@@ -19,6 +29,25 @@ type Config struct {
 	// Minimum popularity score for model selection (default: 0)
 	MinPopularity int
 
+	// Path of a local snapshot of model usage statistics, e.g. OpenRouter's
+	// rankings, that sets the models' popularity
+	PopularitySnapshot string
+
+	// Path of a JSON file the proxy's own successful requests per model are
+	// kept in across restarts; empty keeps them in memory only
+	UsageFile string
+
+	// Path of a JSON file mapping model IDs or ID patterns to parameter
+	// counts and quality tiers, overriding those inferred from the models
+	ModelOverrides string
+
+	// Rules a model must match one of to be used, as [field:]pattern with
+	// field id, name, provider or tokenizer and a glob or /regex/ pattern
+	Allow []string
+
+	// Rules that exclude any model they match, in the same format as Allow
+	Deny []string
+
 	// Enable OpenAI-compatible API (default: true)
 	EnableOpenAI bool
 
@@ -40,13 +69,75 @@ type Config struct {
 	// Prefer specific model architectures
 	PreferredArchitectures []string
 
+	// Scoring strategy that ranks the models: default, weighted, context or
+	// latency (default: default)
+	Scorer string
+
+	// Weights of the weighted scorer by factor (popularity, params, context,
+	// architecture); factors left out keep their default weight
+	ScoreWeights map[string]float64
+
+	// Bonuses the weighted scorer adds to models whose ID or name contains
+	// the key, in place of the built-in model family bonuses
+	VendorBonuses map[string]float64
+
+	// Adaptive ranking that shifts traffic toward the candidates that
+	// perform: thompson or ucb (default: off)
+	Adaptive string
+
+	// Seed of the adaptive ranking's draws, 0 for a random seed. A fixed
+	// seed makes the ranking reproducible.
+	AdaptiveSeed uint64
+
 	// Model index to use from top candidates (0-based, -1 for auto/interactive)
 	ModelIndex int
 
 	// Number of candidates to show
 	NumCandidates int
+
+	// Daily free model request quota of the OpenRouter account, 0 to use
+	// the quota OpenRouter reports or publishes for the key's tier
+	FreeDailyLimit int
+
+	// Interval in seconds between background refreshes of the candidate
+	// list (default: 1800, 0 disables periodic refresh)
+	RefreshInterval int
+
+	// Model ID patterns (e.g. google/gemma-*) of upstream models that reject
+	// system messages; their system prompt is merged into the first user turn
+	SystemMergeModels []string
+
+	// How the model a client asks for is routed: auto or passthrough
+	// (default: auto)
+	RoutingMode string
+
+	// Model names that let the proxy choose the model
+	AutoModels []string
+
+	// Aliases maps model names to a policy (e.g. fast), a preference (e.g.
+	// prefer:coder|devstral) or a model ID
+	Aliases map[string]string
 }
 
+// Routing modes
+const (
+	// RoutingAuto lets the proxy choose unless the client asks for a
+	// candidate or an alias
+	RoutingAuto = "auto"
+
+	// RoutingPassthrough also honors any other model a provider knows
+	RoutingPassthrough = "passthrough"
+)
+
+// DefaultAutoModels lists the model names that let the proxy choose
+var DefaultAutoModels = []string{"auto", "frugalai"}
+
+// DefaultRefreshInterval is the default candidate refresh interval in seconds
+const DefaultRefreshInterval = 1800
+
+// DefaultSystemMergeModels lists models known to reject the system role
+var DefaultSystemMergeModels = []string{"google/gemma-*"}
+
 // LoadFromEnv loads configuration from environment variables (used when CLI is not available)
 func LoadFromEnv() *Config {
 	cfg := &Config{
@@ -62,6 +153,10 @@ func LoadFromEnv() *Config {
 		PreferredArchitectures: []string{},
 		ModelIndex:          -1,
 		NumCandidates:       10,
+		RefreshInterval:     DefaultRefreshInterval,
+		SystemMergeModels:   DefaultSystemMergeModels,
+		RoutingMode:         RoutingAuto,
+		AutoModels:          DefaultAutoModels,
 	}
 
 	// Environment variables
@@ -71,6 +166,12 @@ func LoadFromEnv() *Config {
 	if v := os.Getenv("FRUGALAI_API_KEY"); v != "" {
 		cfg.APIKey = v
 	}
+	if v := os.Getenv("FRUGALAI_BASE_URL"); v != "" {
+		cfg.BaseURL = v
+	}
+	if v := os.Getenv("FRUGALAI_CONFIG"); v != "" {
+		cfg.ConfigFile = v
+	}
 	if v := os.Getenv("FRUGALAI_PORT"); v != "" {
 		if i, err := strconv.Atoi(v); err == nil {
 			cfg.Port = i
@@ -86,6 +187,21 @@ func LoadFromEnv() *Config {
 			cfg.MinPopularity = i
 		}
 	}
+	if v := os.Getenv("FRUGALAI_POPULARITY_SNAPSHOT"); v != "" {
+		cfg.PopularitySnapshot = v
+	}
+	if v := os.Getenv("FRUGALAI_USAGE_FILE"); v != "" {
+		cfg.UsageFile = v
+	}
+	if v := os.Getenv("FRUGALAI_MODEL_OVERRIDES"); v != "" {
+		cfg.ModelOverrides = v
+	}
+	if v := os.Getenv("FRUGALAI_ALLOW"); v != "" {
+		cfg.Allow = splitAndTrim(v)
+	}
+	if v := os.Getenv("FRUGALAI_DENY"); v != "" {
+		cfg.Deny = splitAndTrim(v)
+	}
 	if v := os.Getenv("FRUGALAI_LOG_LEVEL"); v != "" {
 		cfg.LogLevel = v
 	}
@@ -97,6 +213,17 @@ func LoadFromEnv() *Config {
 	if v := os.Getenv("FRUGALAI_PREFERRED_ARCH"); v != "" {
 		cfg.PreferredArchitectures = splitAndTrim(v)
 	}
+	if v := os.Getenv("FRUGALAI_SCORER"); v != "" {
+		cfg.Scorer = v
+	}
+	if v := os.Getenv("FRUGALAI_ADAPTIVE"); v != "" {
+		cfg.Adaptive = v
+	}
+	if v := os.Getenv("FRUGALAI_ADAPTIVE_SEED"); v != "" {
+		if i, err := strconv.ParseUint(v, 10, 64); err == nil {
+			cfg.AdaptiveSeed = i
+		}
+	}
 	if v := os.Getenv("FRUGALAI_MODEL_INDEX"); v != "" {
 		if i, err := strconv.Atoi(v); err == nil {
 			cfg.ModelIndex = i
@@ -107,6 +234,25 @@ func LoadFromEnv() *Config {
 			cfg.NumCandidates = i
 		}
 	}
+	if v := os.Getenv("FRUGALAI_FREE_DAILY_LIMIT"); v != "" {
+		if i, err := strconv.Atoi(v); err == nil {
+			cfg.FreeDailyLimit = i
+		}
+	}
+	if v := os.Getenv("FRUGALAI_REFRESH_INTERVAL"); v != "" {
+		if i, err := strconv.Atoi(v); err == nil {
+			cfg.RefreshInterval = i
+		}
+	}
+	if v, ok := os.LookupEnv("FRUGALAI_MERGE_SYSTEM_MODELS"); ok {
+		cfg.SystemMergeModels = splitAndTrim(v)
+	}
+	if v := os.Getenv("FRUGALAI_ROUTING_MODE"); v != "" {
+		cfg.RoutingMode = v
+	}
+	if v, ok := os.LookupEnv("FRUGALAI_AUTO_MODELS"); ok {
+		cfg.AutoModels = splitAndTrim(v)
+	}
 
 	return cfg
 }
@@ -0,0 +1,141 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Provider types
+const (
+	// ProviderOpenAI is any OpenAI-compatible API
+	ProviderOpenAI = "openai"
+
+	// ProviderOllama is the native API of an Ollama server
+	ProviderOllama = "ollama"
+
+	// ProviderLlamaCpp is a llama.cpp server, which speaks the OpenAI API
+	// and whose models are all free
+	ProviderLlamaCpp = "llamacpp"
+)
+
+// ProviderConfig configures an additional OpenAI-compatible upstream, e.g.
+// Groq, Together or a local server
+type ProviderConfig struct {
+	// Name identifies the provider and prefixes its model IDs, e.g. "groq"
+	Name string `json:"name"`
+
+	// Type is openai (default), ollama or llamacpp
+	Type string `json:"type,omitempty"`
+
+	// BaseURL is the API root that /models and /chat/completions are
+	// relative to, e.g. https://api.groq.com/openai/v1. For Ollama it is
+	// the server root and defaults to http://localhost:11434.
+	BaseURL string `json:"base_url"`
+
+	// APIKey is sent as a bearer token; empty for local servers
+	APIKey string `json:"api_key,omitempty"`
+
+	// APIKeyEnv names an environment variable to read the API key from,
+	// so the file does not have to contain secrets
+	APIKeyEnv string `json:"api_key_env,omitempty"`
+
+	// FreeModels lists model ID patterns (e.g. llama-*) to treat as free;
+	// "*" marks all models free. When empty, models with zero pricing are
+	// free. Ollama and llama.cpp models are always free; patterns select
+	// which of them to use.
+	FreeModels []string `json:"free_models,omitempty"`
+
+	// Fallback keeps the provider's models out of the candidate ranking
+	// and uses them only as a last resort, when no candidate can take a
+	// request
+	Fallback bool `json:"fallback,omitempty"`
+
+	// ContextLength caps the context length of the provider's models. For
+	// Ollama it is requested as num_ctx, since the server otherwise
+	// truncates prompts to its small default window.
+	ContextLength int `json:"context_length,omitempty"`
+}
+
+// Key returns the provider's API key, preferring APIKeyEnv when it is set
+func (p *ProviderConfig) Key() string {
+	if p.APIKeyEnv != "" {
+		if v := os.Getenv(p.APIKeyEnv); v != "" {
+			return v
+		}
+	}
+	return p.APIKey
+}
+
+// fileConfig is the layout of the JSON config file
+type fileConfig struct {
+	Providers []ProviderConfig `json:"providers"`
+
+	// Aliases maps model names to a policy, a preference or a model ID
+	Aliases map[string]string `json:"aliases"`
+
+	// Allow and Deny add to the model rules of the flags
+	Allow []string `json:"allow"`
+	Deny  []string `json:"deny"`
+
+	// Scoring selects and tunes the scorer models are ranked with
+	Scoring *scoringConfig `json:"scoring"`
+}
+
+// scoringConfig is the scoring section of the config file
+type scoringConfig struct {
+	// Strategy is used unless a scorer is set with a flag
+	Strategy      string             `json:"strategy"`
+	Weights       map[string]float64 `json:"weights"`
+	VendorBonuses map[string]float64 `json:"vendor_bonuses"`
+}
+
+// LoadFile reads the JSON config file at path into cfg
+func LoadFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var fc fileConfig
+	if err := json.Unmarshal(data, &fc); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	for i, p := range fc.Providers {
+		if p.Name == "" {
+			return fmt.Errorf("provider %d in %s has no name", i, path)
+		}
+		switch p.Type {
+		case "", ProviderOpenAI, ProviderLlamaCpp:
+			if p.BaseURL == "" {
+				return fmt.Errorf("provider %s in %s has no base_url", p.Name, path)
+			}
+		case ProviderOllama:
+		default:
+			return fmt.Errorf("provider %s in %s has unknown type %q", p.Name, path, p.Type)
+		}
+	}
+
+	cfg.Providers = append(cfg.Providers, fc.Providers...)
+	cfg.Allow = append(cfg.Allow, fc.Allow...)
+	cfg.Deny = append(cfg.Deny, fc.Deny...)
+	if sc := fc.Scoring; sc != nil {
+		if cfg.Scorer == "" {
+			cfg.Scorer = sc.Strategy
+		}
+		if sc.Weights != nil {
+			cfg.ScoreWeights = sc.Weights
+		}
+		if sc.VendorBonuses != nil {
+			cfg.VendorBonuses = sc.VendorBonuses
+		}
+	}
+	if len(fc.Aliases) > 0 && cfg.Aliases == nil {
+		cfg.Aliases = map[string]string{}
+	}
+	for name, target := range fc.Aliases {
+		cfg.Aliases[name] = target
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeFile writes a config file into a temporary directory and returns
+// its path
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "frugalai.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadFileErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{name: "missing name", content: `{"providers":[{"base_url":"https://api.groq.com/openai/v1"}]}`, want: "has no name"},
+		{name: "missing base_url", content: `{"providers":[{"name":"groq"}]}`, want: "has no base_url"},
+		{name: "missing base_url of llama.cpp", content: `{"providers":[{"name":"local","type":"llamacpp"}]}`, want: "has no base_url"},
+		{name: "unknown type", content: `{"providers":[{"name":"x","type":"vertex","base_url":"https://example.com"}]}`, want: `unknown type "vertex"`},
+		{name: "invalid JSON", content: `{"providers":`, want: "failed to parse"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := LoadFile(writeFile(t, tt.content), &Config{})
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("LoadFile() error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+
+	if err := LoadFile(filepath.Join(t.TempDir(), "missing.json"), &Config{}); err == nil {
+		t.Error("LoadFile() of a missing file succeeded")
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	path := writeFile(t, `{
+		"providers": [
+			{"name": "groq", "base_url": "https://api.groq.com/openai/v1", "api_key": "gsk_inline"},
+			{"name": "ollama", "type": "ollama", "fallback": true}
+		],
+		"aliases": {"coder": "prefer:coder"},
+		"allow": ["qwen/*"],
+		"deny": ["*:online"]
+	}`)
+
+	cfg := &Config{Allow: []string{"meta-llama/*"}, Aliases: map[string]string{"cheap": "fast"}}
+	if err := LoadFile(path, cfg); err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+	if len(cfg.Providers) != 2 || cfg.Providers[1].Type != ProviderOllama || !cfg.Providers[1].Fallback {
+		t.Errorf("providers = %+v", cfg.Providers)
+	}
+	if !reflect.DeepEqual(cfg.Allow, []string{"meta-llama/*", "qwen/*"}) || !reflect.DeepEqual(cfg.Deny, []string{"*:online"}) {
+		t.Errorf("rules = %v, %v, want the file's added to the flags'", cfg.Allow, cfg.Deny)
+	}
+	if !reflect.DeepEqual(cfg.Aliases, map[string]string{"cheap": "fast", "coder": "prefer:coder"}) {
+		t.Errorf("aliases = %v", cfg.Aliases)
+	}
+}
+
+func TestProviderKey(t *testing.T) {
+	t.Setenv("FRUGALAI_TEST_KEY", "gsk_from_env")
+
+	tests := []struct {
+		name     string
+		provider ProviderConfig
+		want     string
+	}{
+		{name: "inline key", provider: ProviderConfig{APIKey: "gsk_inline"}, want: "gsk_inline"},
+		{name: "environment before inline key", provider: ProviderConfig{APIKey: "gsk_inline", APIKeyEnv: "FRUGALAI_TEST_KEY"}, want: "gsk_from_env"},
+		{name: "unset variable", provider: ProviderConfig{APIKey: "gsk_inline", APIKeyEnv: "FRUGALAI_TEST_UNSET"}, want: "gsk_inline"},
+		{name: "no key", provider: ProviderConfig{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.provider.Key(); got != tt.want {
+				t.Errorf("Key() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadFileScoring(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		flagScorer  string
+		wantScorer  string
+		wantWeights map[string]float64
+		wantBonuses map[string]float64
+	}{
+		{
+			name:        "strategy without a flag",
+			content:     `{"scoring":{"strategy":"weighted","weights":{"params":2}}}`,
+			wantScorer:  "weighted",
+			wantWeights: map[string]float64{"params": 2},
+			wantBonuses: map[string]float64{"qwen": 5},
+		},
+		{
+			name:        "flag before strategy",
+			content:     `{"scoring":{"strategy":"weighted","vendor_bonuses":{"deepseek":10}}}`,
+			flagScorer:  "latency",
+			wantScorer:  "latency",
+			wantWeights: map[string]float64{"context": 1},
+			wantBonuses: map[string]float64{"deepseek": 10},
+		},
+		{
+			name:        "empty scoring block",
+			content:     `{"scoring":{}}`,
+			flagScorer:  "context",
+			wantScorer:  "context",
+			wantWeights: map[string]float64{"context": 1},
+			wantBonuses: map[string]float64{"qwen": 5},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{
+				Scorer:        tt.flagScorer,
+				ScoreWeights:  map[string]float64{"context": 1},
+				VendorBonuses: map[string]float64{"qwen": 5},
+			}
+			if err := LoadFile(writeFile(t, tt.content), cfg); err != nil {
+				t.Fatalf("LoadFile() error = %v", err)
+			}
+			if cfg.Scorer != tt.wantScorer {
+				t.Errorf("scorer = %q, want %q", cfg.Scorer, tt.wantScorer)
+			}
+			if !reflect.DeepEqual(cfg.ScoreWeights, tt.wantWeights) || !reflect.DeepEqual(cfg.VendorBonuses, tt.wantBonuses) {
+				t.Errorf("weights = %v, bonuses = %v, want %v, %v", cfg.ScoreWeights, cfg.VendorBonuses, tt.wantWeights, tt.wantBonuses)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package manager
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"math/rand/v2"
+	"sort"
+	"time"
+
+	"github.com/mosajjal/frugalai/internal/model"
+	"github.com/mosajjal/frugalai/internal/openrouter"
+)
+
+// Adaptive ranking strategies
+const (
+	// AdaptiveThompson ranks the candidates by a draw from the posterior
+	// of each one's reward, so traffic is spread in proportion to how
+	// likely each is the best
+	AdaptiveThompson = "thompson"
+
+	// AdaptiveUCB ranks the candidates by the upper confidence bound of
+	// their reward, trying rarely used ones until their bound drops
+	AdaptiveUCB = "ucb"
+)
+
+// priorWeight is how many observations the static rank of a candidate is
+// worth. The top candidate starts as if it had that many full rewards and
+// the last one as if it had that many failures.
+const priorWeight = 2.0
+
+// bandit reorders the candidates by the observed performance of each,
+// starting out from their static rank
+type bandit struct {
+	strategy string
+	rng      *rand.Rand
+}
+
+// SetAdaptive enables adaptive ranking of the candidates with the given
+// strategy, or disables it when the strategy is empty. Draws come from a
+// generator seeded with seed, or with the current time when seed is 0, so
+// the same seed and sequence of outcomes give the same picks.
+func (m *Manager) SetAdaptive(strategy string, seed uint64) error {
+	switch strategy {
+	case "", AdaptiveThompson, AdaptiveUCB:
+	default:
+		return fmt.Errorf("unknown adaptive strategy %q: expected %s or %s", strategy, AdaptiveThompson, AdaptiveUCB)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if strategy == "" {
+		m.bandit = nil
+		return nil
+	}
+	if seed == 0 {
+		seed = uint64(time.Now().UnixNano())
+	}
+	m.bandit = &bandit{
+		strategy: strategy,
+		rng:      rand.New(rand.NewPCG(seed, seed)),
+	}
+	return nil
+}
+
+// adaptive reports whether the bandit ranks the candidates of a request.
+// A policy or preference asks for a ranking of its own, so it wins. The
+// caller must hold the lock.
+func (m *Manager) adaptive(reqs model.Requirements) bool {
+	return m.bandit != nil && (reqs.Policy == "" || reqs.Policy == model.PolicyAuto) && len(reqs.Prefer) == 0
+}
+
+// rankAdaptive returns a copy of the candidates ordered by the bandit. Only
+// an acquiring pick draws from the generator; a peek orders by the expected
+// reward, so it neither changes the draws of later picks nor flickers. The
+// caller must hold the lock.
+func (m *Manager) rankAdaptive(candidates []openrouter.Model, draw bool) []openrouter.Model {
+	scores := make(map[string]float64, len(candidates))
+	total := 0.0
+	for i, c := range candidates {
+		alpha, beta := m.posterior(i, len(candidates), c.ID)
+		total += alpha + beta
+		scores[c.ID] = alpha / (alpha + beta)
+		if draw && m.bandit.strategy == AdaptiveThompson {
+			scores[c.ID] = betaSample(m.bandit.rng, alpha, beta)
+		}
+	}
+	if m.bandit.strategy == AdaptiveUCB {
+		for i, c := range candidates {
+			alpha, beta := m.posterior(i, len(candidates), c.ID)
+			scores[c.ID] += math.Sqrt(2 * math.Log(total) / (alpha + beta))
+		}
+	}
+
+	ranked := append([]openrouter.Model(nil), candidates...)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return scores[ranked[i].ID] > scores[ranked[j].ID]
+	})
+	return ranked
+}
+
+// follow makes the candidate the bandit picked the current one, so the
+// status and failover start from it. The caller must hold the lock.
+func (m *Manager) follow(modelID string) {
+	for i, c := range m.candidates {
+		if c.ID == modelID {
+			if i != m.current {
+				log.Printf("[DEBUG] Adaptive ranking moved traffic to %s", modelID)
+			}
+			m.current = i
+			return
+		}
+	}
+}
+
+// expected returns the expected reward of the candidate at index i of n
+// under the adaptive ranking, 0 when it is off. The caller must hold the
+// lock.
+func (m *Manager) expected(i, n int, modelID string) float64 {
+	if m.bandit == nil {
+		return 0
+	}
+	alpha, beta := m.posterior(i, n, modelID)
+	return alpha / (alpha + beta)
+}
+
+// posterior returns the parameters of the Beta distribution of the reward
+// of the candidate at index i of n: a uniform prior, shifted toward its
+// static rank, plus its discounted rewards and penalties. The caller must
+// hold the lock.
+func (m *Manager) posterior(i, n int, modelID string) (alpha, beta float64) {
+	alpha = 1 + priorWeight*float64(n-i)/float64(n)
+	beta = 1 + priorWeight*float64(i)/float64(n)
+	if mt, ok := m.metrics[modelID]; ok {
+		alpha += mt.reward
+		beta += mt.penalty
+	}
+	return alpha, beta
+}
+
+// betaSample draws from Beta(alpha, beta) as the ratio of two Gamma draws
+func betaSample(rng *rand.Rand, alpha, beta float64) float64 {
+	x := gammaSample(rng, alpha)
+	y := gammaSample(rng, beta)
+	return x / (x + y)
+}
+
+// gammaSample draws from Gamma(shape, 1) with the method of Marsaglia and
+// Tsang. Shapes below 1 are boosted and scaled back.
+func gammaSample(rng *rand.Rand, shape float64) float64 {
+	if shape < 1 {
+		return gammaSample(rng, shape+1) * math.Pow(rng.Float64(), 1/shape)
+	}
+	d := shape - 1.0/3
+	c := 1 / math.Sqrt(9*d)
+	for {
+		x := rng.NormFloat64()
+		v := 1 + c*x
+		if v <= 0 {
+			continue
+		}
+		v = v * v * v
+		u := rng.Float64()
+		if math.Log(u) < 0.5*x*x+d-d*v+d*math.Log(v) {
+			return d * v
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package manager
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+// simulate makes rounds picks from three candidates and records how each
+// went: m0, the top ranked, always fails, m1 succeeds slowly and m2 fast.
+// It returns the IDs picked.
+func simulate(t *testing.T, strategy string, seed uint64, rounds int) []string {
+	t.Helper()
+	m := New()
+	m.SetCandidates(testCandidates(3), 0)
+	if err := m.SetAdaptive(strategy, seed); err != nil {
+		t.Fatal(err)
+	}
+
+	picks := make([]string, 0, rounds)
+	for i := 0; i < rounds; i++ {
+		picked, err := m.Pick(textReqs())
+		if err != nil || picked == nil {
+			t.Fatalf("Pick() = %v, %v", picked, err)
+		}
+		picks = append(picks, picked.ID)
+
+		switch picked.ID {
+		case "m0":
+			// A failure that does not trip the breaker, so the bandit
+			// alone has to steer away from the model
+			m.mu.Lock()
+			m.recordFailed(picked.ID)
+			m.mu.Unlock()
+		case "m1":
+			m.RecordSample(picked.ID, Sample{TTFT: 8 * time.Second, Total: 20 * time.Second, CompletionTokens: 100})
+		case "m2":
+			m.RecordSample(picked.ID, Sample{TTFT: 200 * time.Millisecond, Total: 2 * time.Second, CompletionTokens: 100})
+		}
+	}
+	return picks
+}
+
+func TestAdaptiveSeed(t *testing.T) {
+	first := simulate(t, AdaptiveThompson, 42, 100)
+	if again := simulate(t, AdaptiveThompson, 42, 100); !slices.Equal(first, again) {
+		t.Errorf("picks differ with the same seed:\n%v\n%v", first, again)
+	}
+	if other := simulate(t, AdaptiveThompson, 43, 100); slices.Equal(first, other) {
+		t.Error("picks are the same with another seed")
+	}
+}
+
+func TestAdaptiveShiftsTraffic(t *testing.T) {
+	for _, strategy := range []string{AdaptiveThompson, AdaptiveUCB} {
+		t.Run(strategy, func(t *testing.T) {
+			picks := simulate(t, strategy, 1, 300)
+
+			// Count the picks once the bandit has had time to learn
+			counts := map[string]int{}
+			for _, id := range picks[200:] {
+				counts[id]++
+			}
+			if counts["m2"] < 90 {
+				t.Errorf("last 100 picks = %v, want nearly all on m2", counts)
+			}
+		})
+	}
+}
+
+func TestAdaptiveOff(t *testing.T) {
+	picks := simulate(t, "", 0, 20)
+	for _, id := range picks {
+		if id != "m0" {
+			t.Fatalf("picks = %v, want the current model while its breaker stays closed", picks)
+		}
+	}
+
+	if err := New().SetAdaptive("greedy", 0); err == nil {
+		t.Error("SetAdaptive() accepted an unknown strategy")
+	}
+}
+
+func TestAdaptivePeekDoesNotDraw(t *testing.T) {
+	m := New()
+	m.SetCandidates(testCandidates(3), 0)
+	m.SetAdaptive(AdaptiveThompson, 7)
+	n := New()
+	n.SetCandidates(testCandidates(3), 0)
+	n.SetAdaptive(AdaptiveThompson, 7)
+
+	for i := 0; i < 20; i++ {
+		n.Peek(textReqs())
+		a, _ := m.Pick(textReqs())
+		b, _ := n.Pick(textReqs())
+		if a.ID != b.ID {
+			t.Fatalf("pick %d = %s after peeks, want %s as without them", i, b.ID, a.ID)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package manager
+
+import (
+	"time"
+)
+
+const (
+	// baseCooldown is how long a breaker stays open after its first trip
+	baseCooldown = 30 * time.Second
+
+	// maxCooldown caps the exponential growth of the cooldown
+	maxCooldown = 30 * time.Minute
+
+	// probeTimeout is how long a half-open probe may take before another
+	// request is allowed to probe, so an abandoned probe cannot wedge the
+	// breaker
+	probeTimeout = 2 * time.Minute
+)
+
+// BreakerState is the state of a model's circuit breaker
+type BreakerState int
+
+const (
+	// StateClosed lets all requests through
+	StateClosed BreakerState = iota
+
+	// StateOpen rejects requests until the cooldown has passed
+	StateOpen
+
+	// StateHalfOpen lets a single probe request through. Its success closes
+	// the breaker, its failure opens it again with a longer cooldown.
+	StateHalfOpen
+)
+
+// String returns the name of the state
+func (s BreakerState) String() string {
+	switch s {
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// breaker is the circuit breaker of a single model. It is not safe for
+// concurrent use; the manager's lock protects it.
+type breaker struct {
+	// failures counts recent failures while closed
+	failures    int
+	lastFailure time.Time
+
+	// trips counts consecutive trips and drives the exponential cooldown
+	trips    int
+	open     bool
+	openedAt time.Time
+	cooldown time.Duration
+
+	// probeStarted is set while a half-open probe is in flight
+	probeStarted time.Time
+}
+
+// state returns the breaker state at now. An open breaker becomes half-open
+// once its cooldown has passed.
+func (b *breaker) state(now time.Time) BreakerState {
+	if !b.open {
+		return StateClosed
+	}
+	if now.Before(b.openUntil()) {
+		return StateOpen
+	}
+	return StateHalfOpen
+}
+
+// openUntil returns the end of the cooldown
+func (b *breaker) openUntil() time.Time {
+	return b.openedAt.Add(b.cooldown)
+}
+
+// allow reports whether a request may be sent at now
+func (b *breaker) allow(now time.Time) bool {
+	switch b.state(now) {
+	case StateClosed:
+		return true
+	case StateHalfOpen:
+		return b.probeStarted.IsZero() || now.Sub(b.probeStarted) > probeTimeout
+	default:
+		return false
+	}
+}
+
+// acquire marks a request as sent at now. For a half-open breaker the
+// request becomes the probe.
+func (b *breaker) acquire(now time.Time) {
+	if b.state(now) == StateHalfOpen {
+		b.probeStarted = now
+	}
+}
+
+// failure records a failed request and reports whether the breaker tripped.
+// Rate limits, server errors and timeouts trip it at once, other errors
+// after maxRecentFailures recent failures. A failed probe always trips it.
+// Client errors blame the request, not the model, and are not counted.
+func (b *breaker) failure(now time.Time, statusCode int, retryAfter time.Duration) bool {
+	if clientError(statusCode) {
+		return false
+	}
+	if now.Sub(b.lastFailure) > failureWindow {
+		b.failures = 0
+	}
+	b.failures++
+	b.lastFailure = now
+
+	trip := b.open || statusCode == 429 || statusCode >= 500 || b.failures >= maxRecentFailures
+	if trip {
+		b.trip(now, retryAfter)
+	}
+	return trip
+}
+
+// clientError reports whether a status code is a 4xx caused by the request
+// itself, i.e. anything but a request timeout or a rate limit
+func clientError(statusCode int) bool {
+	return statusCode >= 400 && statusCode < 500 && statusCode != 408 && statusCode != 429
+}
+
+// trip opens the breaker. The cooldown doubles with every consecutive trip
+// and is never shorter than the upstream's Retry-After.
+func (b *breaker) trip(now time.Time, retryAfter time.Duration) {
+	cooldown := baseCooldown
+	for i := 0; i < b.trips && cooldown < maxCooldown; i++ {
+		cooldown *= 2
+	}
+	if cooldown > maxCooldown {
+		cooldown = maxCooldown
+	}
+	if retryAfter > cooldown {
+		cooldown = retryAfter
+	}
+
+	b.trips++
+	b.open = true
+	b.openedAt = now
+	b.cooldown = cooldown
+	b.probeStarted = time.Time{}
+}
+
+// park opens the breaker for exactly d, as advertised by the upstream's
+// rate limit headers. Being rate limited says nothing about the model's
+// health, so the exponential backoff is left alone.
+func (b *breaker) park(now time.Time, d time.Duration) {
+	b.open = true
+	b.openedAt = now
+	b.cooldown = d
+	b.probeStarted = time.Time{}
+}
+
+// success records a successful request, which closes the breaker
+func (b *breaker) success() {
+	*b = breaker{}
+}
@@ -0,0 +1,528 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/mosajjal/frugalai/internal/model"
+	"github.com/mosajjal/frugalai/internal/openrouter"
+)
+
+const (
+	// maxRecentFailures is the number of recent failures that trips a
+	// model's circuit breaker
+	maxRecentFailures = 3
+
+	// failureWindow is how long a failure counts as recent
+	failureWindow = 2 * time.Minute
+)
+
+// Manager owns the candidate models, the current selection and the circuit
+// breakers used for failover. It is safe for concurrent use; every method
+// takes the lock and returns copies, never references into its state.
+type Manager struct {
+	mu         sync.Mutex
+	candidates []openrouter.Model
+	current    int
+	breakers   map[string]*breaker
+	pacers     map[string]*pacer
+	timeouts   map[string]int
+	metrics    map[string]*metrics
+
+	// bandit reorders the candidates by how they perform, nil while the
+	// ranking is static
+	bandit *bandit
+
+	// fallbacks are last-resort models, e.g. served by a local Ollama, that
+	// are only used while no candidate can take a request
+	fallbacks     []openrouter.Model
+	fallbackFetch Fetcher
+
+	// pool is every free model the allow and deny rules permit, ranked, for
+	// requests whose routing hints replace the configured filters
+	pool      []openrouter.Model
+	poolFetch Fetcher
+}
+
+// CandidateStatus is a candidate together with its failover state
+type CandidateStatus struct {
+	Index     int
+	Model     openrouter.Model
+	IsCurrent bool
+	Failures  int
+	Timeouts  int
+
+	// Fallback is set for last-resort models; their Index counts within
+	// the fallback list
+	Fallback bool
+
+	// Breaker is the state of the model's circuit breaker. Trips counts its
+	// consecutive trips and OpenUntil is the end of the current cooldown.
+	Breaker   BreakerState
+	Trips     int
+	OpenUntil time.Time
+
+	// RateLimitRemaining is the number of requests the model has left in
+	// its rate limit window, -1 if unknown
+	RateLimitRemaining int
+
+	// Metrics are the moving averages of the model's requests
+	Metrics Metrics
+
+	// Expected is the reward the adaptive ranking expects of a candidate,
+	// between 0 and 1, and 0 while the ranking is static
+	Expected float64
+}
+
+// New creates an empty manager. Candidates are set with SetCandidates.
+func New() *Manager {
+	return &Manager{
+		current:  -1,
+		breakers: make(map[string]*breaker),
+		pacers:   make(map[string]*pacer),
+		timeouts: make(map[string]int),
+		metrics:  make(map[string]*metrics),
+	}
+}
+
+// SetCandidates replaces the candidate list and selects the candidate at
+// currentIdx, or the first one when the index is out of range
+func (m *Manager) SetCandidates(candidates []openrouter.Model, currentIdx int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.candidates = append([]openrouter.Model(nil), candidates...)
+	switch {
+	case len(m.candidates) == 0:
+		m.current = -1
+	case currentIdx >= 0 && currentIdx < len(m.candidates):
+		m.current = currentIdx
+	default:
+		m.current = 0
+	}
+}
+
+// Candidates returns a copy of the candidate list
+func (m *Manager) Candidates() []openrouter.Model {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]openrouter.Model{}, m.candidates...)
+}
+
+// SetFallbacks replaces the last-resort models, best first
+func (m *Manager) SetFallbacks(fallbacks []openrouter.Model) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.fallbacks = append([]openrouter.Model(nil), fallbacks...)
+}
+
+// Fallbacks returns a copy of the last-resort models
+func (m *Manager) Fallbacks() []openrouter.Model {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]openrouter.Model{}, m.fallbacks...)
+}
+
+// Current returns the currently selected model
+func (m *Manager) Current() (openrouter.Model, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.current < 0 {
+		return openrouter.Model{}, false
+	}
+	return m.candidates[m.current], true
+}
+
+// CurrentID returns the ID of the currently selected model, or "" if none
+func (m *Manager) CurrentID() string {
+	current, ok := m.Current()
+	if !ok {
+		return ""
+	}
+	return current.ID
+}
+
+// Pick returns the model a request with the given requirements should be
+// sent to, following the rules of model.Requirements.Pick. Models whose
+// breaker is open are only used when nothing else fits, and a half-open
+// model is handed out as the probe. The model the request asks for comes
+// first while it is usable. When no candidate is usable, or there are none,
+// a usable fallback model is picked instead. Pick returns nil when there are
+// no models at all.
+func (m *Manager) Pick(reqs model.Requirements) (*openrouter.Model, error) {
+	return m.pick(reqs, true)
+}
+
+// Peek returns the model Pick would return without sending a request to it,
+// so a half-open model is not claimed for a probe
+func (m *Manager) Peek(reqs model.Requirements) (*openrouter.Model, error) {
+	return m.pick(reqs, false)
+}
+
+func (m *Manager) pick(reqs model.Requirements, acquire bool) (*openrouter.Model, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	usable := func(id string) bool {
+		return m.breaker(id).allow(now)
+	}
+
+	if requested := reqs.Requested(usable, m.candidates, m.fallbacks); requested != nil {
+		if acquire {
+			m.breaker(requested.ID).acquire(now)
+		}
+		result := *requested
+		return &result, nil
+	}
+
+	var current *openrouter.Model
+	if m.current >= 0 && usable(m.candidates[m.current].ID) {
+		current = &m.candidates[m.current]
+	}
+
+	// Routing hints select from the whole pool instead of the candidates
+	candidates, fallbacks := m.candidates, m.fallbacks
+	if c := reqs.Constraints; c != nil {
+		pool := m.pool
+		if len(pool) == 0 {
+			pool = m.candidates
+		}
+		candidates, fallbacks = c.Filter(pool), c.Filter(m.fallbacks)
+		if len(candidates) == 0 && len(fallbacks) == 0 && len(pool)+len(m.fallbacks) > 0 {
+			return nil, &model.ConstraintError{Constraints: c}
+		}
+		if current != nil && !c.Allows(*current) {
+			current = nil
+		}
+	}
+
+	// The bandit decides between the candidates instead of staying with
+	// the current one
+	if m.adaptive(reqs) {
+		candidates = m.rankAdaptive(candidates, acquire)
+		current = nil
+	}
+
+	picked, err := reqs.Pick(current, candidates, usable)
+	if len(fallbacks) > 0 && (picked == nil || !usable(picked.ID)) {
+		fallback, fallbackErr := reqs.Pick(nil, fallbacks, usable)
+		switch {
+		case fallback != nil && (picked == nil || usable(fallback.ID)):
+			log.Printf("[DEBUG] No candidate can take the request, falling back to %s", fallback.ID)
+			picked, err = fallback, nil
+		case picked == nil && err == nil:
+			err = fallbackErr
+		}
+	}
+
+	// Images are only turned away when no model of the whole pool can see
+	// them, not just none of the candidates
+	var constraint *model.ConstraintError
+	if errors.As(err, &constraint) && constraint.Capability == model.CapabilityVision && reqs.Constraints == nil && len(m.pool) > 0 {
+		picked, err = reqs.Pick(nil, m.pool, usable)
+		if err == nil && picked != nil {
+			log.Printf("[DEBUG] No candidate accepts images, using %s from the pool", picked.ID)
+		}
+	}
+	if err != nil || picked == nil {
+		return nil, err
+	}
+	if acquire {
+		m.breaker(picked.ID).acquire(now)
+		if m.adaptive(reqs) {
+			m.follow(picked.ID)
+		}
+	}
+
+	result := *picked
+	return &result, nil
+}
+
+// RecordSuccess records a successful request, which closes the model's
+// breaker, together with the rate limit state reported with the response.
+// A model that has used up its rate limit window is parked until the window
+// resets.
+func (m *Manager) RecordSuccess(modelID string, rl *openrouter.RateLimit) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b := m.breaker(modelID)
+	if b.open {
+		log.Printf("[INFO] Model %s recovered, closing its circuit breaker", modelID)
+	}
+	b.success()
+
+	m.pacer(modelID).observe(rl)
+	if wait := rl.Wait(); wait > 0 {
+		log.Printf("[INFO] Model %s has used up its rate limit, parking it for %v", modelID, wait.Round(time.Second))
+		b.park(time.Now(), wait)
+		m.switchFrom(modelID)
+	}
+}
+
+// RecordFailure records a failed request. A rate limited model is parked
+// for exactly as long as the upstream's rate limit headers say. Otherwise
+// rate limits, server errors and repeated recent failures trip the model's
+// breaker, and the manager switches away from it. It reports whether a
+// retry should go to another model.
+func (m *Manager) RecordFailure(modelID string, statusCode int, rl *openrouter.RateLimit) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	b := m.breaker(modelID)
+	m.pacer(modelID).observe(rl)
+
+	if clientError(statusCode) {
+		log.Printf("[DEBUG] Model %s rejected the request (status %d), not counting it as a failure", modelID, statusCode)
+		return false
+	}
+
+	if wait := rl.Wait(); statusCode == 429 && wait > 0 {
+		log.Printf("[WARN] Model %s rate limited, parking it for %v", modelID, wait.Round(time.Second))
+		m.recordFailed(modelID)
+		b.park(now, wait)
+		return m.switchFrom(modelID)
+	}
+
+	tripped := b.failure(now, statusCode, rl.Wait())
+
+	m.recordFailed(modelID)
+	log.Printf("[WARN] Model %s failed (status %d), failure count: %d",
+		modelID, statusCode, b.failures)
+
+	if !tripped {
+		return false
+	}
+
+	log.Printf("[INFO] Circuit breaker for %s opened for %v", modelID, b.cooldown)
+	return m.switchFrom(modelID)
+}
+
+// RecordUnreachable records that the provider serving a model could not be
+// reached at all. Its other models are just as unreachable, so the breakers
+// of all of them trip and the manager switches to a model of another
+// provider, or to a fallback model. It reports whether a retry should go to
+// another model.
+func (m *Manager) RecordUnreachable(modelID string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	models := append(append([]openrouter.Model{}, m.candidates...), m.fallbacks...)
+	provider, found := "", false
+	for _, c := range models {
+		if c.ID == modelID {
+			provider, found = c.Provider, true
+			break
+		}
+	}
+
+	now := time.Now()
+	tripped := 0
+	for _, c := range models {
+		if c.ID == modelID || (found && c.Provider == provider) {
+			m.breaker(c.ID).trip(now, 0)
+			tripped++
+		}
+	}
+	if tripped == 0 {
+		m.breaker(modelID).trip(now, 0)
+		tripped++
+	}
+
+	m.recordFailed(modelID)
+	log.Printf("[WARN] Model %s is unreachable, opened the circuit breakers of %d models of its provider",
+		modelID, tripped)
+	return m.switchFrom(modelID)
+}
+
+// Pace holds a request to a model back as long as needed to spread the
+// model's remaining rate limit over the rest of its window. It returns
+// ctx's error when ctx is cancelled while waiting.
+func (m *Manager) Pace(ctx context.Context, modelID string) error {
+	m.mu.Lock()
+	wait := m.pacer(modelID).reserve(time.Now())
+	m.mu.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+	log.Printf("[DEBUG] Pacing request to %s by %v", modelID, wait)
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// RecordTimeout records a timed out request, which trips the model's
+// breaker. It reports whether a retry should go to another model.
+func (m *Manager) RecordTimeout(modelID string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.timeouts[modelID]++
+	m.recordFailed(modelID)
+	b := m.breaker(modelID)
+	b.trip(time.Now(), 0)
+
+	log.Printf("[WARN] Model %s timed out, timeout count: %d, circuit breaker opened for %v",
+		modelID, m.timeouts[modelID], b.cooldown)
+
+	return m.switchFrom(modelID)
+}
+
+// SwitchNext moves to the next candidate, wrapping around, regardless of
+// its state. It is used for manual switching.
+func (m *Manager) SwitchNext() (openrouter.Model, int, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.candidates) == 0 {
+		return openrouter.Model{}, -1, false
+	}
+
+	m.current = (m.current + 1) % len(m.candidates)
+	log.Printf("[INFO] Switched to model: %s (index %d)", m.candidates[m.current].Name, m.current)
+	return m.candidates[m.current], m.current, true
+}
+
+// Status returns every candidate, followed by the fallback models, together
+// with its failover state
+func (m *Manager) Status() []CandidateStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	result := make([]CandidateStatus, 0, len(m.candidates)+len(m.fallbacks))
+	for i, c := range m.candidates {
+		status := m.status(now, i, c)
+		status.IsCurrent = i == m.current
+		status.Expected = m.expected(i, len(m.candidates), c.ID)
+		result = append(result, status)
+	}
+	for i, c := range m.fallbacks {
+		status := m.status(now, i, c)
+		status.Fallback = true
+		result = append(result, status)
+	}
+	return result
+}
+
+// status returns the failover state of the model at index i of its list.
+// The caller must hold the lock.
+func (m *Manager) status(now time.Time, i int, c openrouter.Model) CandidateStatus {
+	b := m.breaker(c.ID)
+	status := CandidateStatus{
+		Index:    i,
+		Model:    c,
+		Failures: b.failures,
+		Timeouts: m.timeouts[c.ID],
+		Breaker:  b.state(now),
+		Trips:    b.trips,
+
+		RateLimitRemaining: -1,
+	}
+	if mt, ok := m.metrics[c.ID]; ok {
+		status.Metrics = mt.Metrics
+	}
+	if p, ok := m.pacers[c.ID]; ok && !p.reset.IsZero() && now.Before(p.reset) {
+		status.RateLimitRemaining = p.remaining
+	}
+	if status.Breaker == StateOpen {
+		status.OpenUntil = b.openUntil()
+	}
+	return status
+}
+
+// breaker returns the circuit breaker of a model, creating it on first use.
+// The caller must hold the lock.
+func (m *Manager) breaker(modelID string) *breaker {
+	b, ok := m.breakers[modelID]
+	if !ok {
+		b = &breaker{}
+		m.breakers[modelID] = b
+	}
+	return b
+}
+
+// pacer returns the rate limit pacer of a model, creating it on first use.
+// The caller must hold the lock.
+func (m *Manager) pacer(modelID string) *pacer {
+	p, ok := m.pacers[modelID]
+	if !ok {
+		p = &pacer{}
+		m.pacers[modelID] = p
+	}
+	return p
+}
+
+// switchFrom moves to the next usable candidate after the failed model and
+// reports whether a retry will go to a different model. When another request
+// has already switched away from the failed model the selection is left
+// alone, so concurrent failures of the same model do not skip over good
+// models. When no other candidate is usable, a retry goes to a fallback
+// model if one is. The caller must hold the lock.
+func (m *Manager) switchFrom(modelID string) bool {
+	now := time.Now()
+	if m.current < 0 || m.candidates[m.current].ID != modelID {
+		if m.isFallback(modelID) {
+			return m.usableFallback(now, modelID)
+		}
+		return m.current >= 0 || m.usableFallback(now, modelID)
+	}
+
+	for i := 1; i < len(m.candidates); i++ {
+		nextIdx := (m.current + i) % len(m.candidates)
+		next := m.candidates[nextIdx]
+		if !m.breaker(next.ID).allow(now) {
+			continue
+		}
+
+		log.Printf("[INFO] Switching from %s to %s", modelID, next.ID)
+		m.current = nextIdx
+		return true
+	}
+
+	if m.usableFallback(now, modelID) {
+		log.Printf("[WARN] No alternative candidates available, falling back to the last-resort models")
+		return true
+	}
+
+	log.Printf("[WARN] No alternative models available, keeping current model")
+	return false
+}
+
+// isFallback reports whether the model is a fallback model. The caller must
+// hold the lock.
+func (m *Manager) isFallback(modelID string) bool {
+	for _, f := range m.fallbacks {
+		if f.ID == modelID {
+			return true
+		}
+	}
+	return false
+}
+
+// usableFallback reports whether a fallback model other than the failed
+// one lets requests through. The caller must hold the lock.
+func (m *Manager) usableFallback(now time.Time, failedID string) bool {
+	for _, f := range m.fallbacks {
+		if f.ID != failedID && m.breaker(f.ID).allow(now) {
+			return true
+		}
+	}
+	return false
+}
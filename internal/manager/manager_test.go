@@ -0,0 +1,423 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mosajjal/frugalai/internal/model"
+	"github.com/mosajjal/frugalai/internal/openrouter"
+)
+
+// testCandidates returns n models with IDs m0, m1, ...
+func testCandidates(n int) []openrouter.Model {
+	models := make([]openrouter.Model, n)
+	for i := range models {
+		models[i] = openrouter.Model{ID: fmt.Sprintf("m%d", i), ContextLength: 8192}
+	}
+	return models
+}
+
+// textReqs returns the requirements of a short text request
+func textReqs() model.Requirements {
+	return model.RequirementsFor(&openrouter.ChatRequest{
+		Messages: []openrouter.ChatMessage{{Role: "user", Content: openrouter.TextContent("Hi")}},
+	})
+}
+
+func TestBreakerTransitions(t *testing.T) {
+	start := time.Now()
+	b := &breaker{}
+
+	if b.state(start) != StateClosed || !b.allow(start) {
+		t.Fatalf("new breaker is %v, want closed", b.state(start))
+	}
+
+	// Request timeouts trip it only after maxRecentFailures recent failures
+	for i := 1; i < maxRecentFailures; i++ {
+		if b.failure(start, 408, 0) {
+			t.Fatalf("breaker tripped after %d request timeouts", i)
+		}
+	}
+	if !b.failure(start, 408, 0) {
+		t.Fatalf("breaker did not trip after %d request timeouts", maxRecentFailures)
+	}
+
+	if got := b.state(start.Add(baseCooldown - time.Second)); got != StateOpen {
+		t.Errorf("state during the cooldown = %v, want open", got)
+	}
+	if b.allow(start.Add(baseCooldown - time.Second)) {
+		t.Error("open breaker lets requests through")
+	}
+
+	// After the cooldown a single probe is let through
+	probe := start.Add(baseCooldown + time.Second)
+	if got := b.state(probe); got != StateHalfOpen || !b.allow(probe) {
+		t.Fatalf("state after the cooldown = %v, want half-open and allowing a probe", got)
+	}
+	b.acquire(probe)
+	if b.allow(probe) {
+		t.Error("half-open breaker lets a second probe through")
+	}
+	if !b.allow(probe.Add(probeTimeout + time.Second)) {
+		t.Error("abandoned probe keeps the breaker wedged")
+	}
+
+	// A client error says nothing about the probe, a failed probe opens it
+	// again with twice the cooldown
+	if b.failure(probe, 400, 0) || b.trips != 1 {
+		t.Fatal("client error of the probe tripped the breaker")
+	}
+	if !b.failure(probe, 408, 0) {
+		t.Fatal("failed probe did not trip the breaker")
+	}
+	if b.cooldown != 2*baseCooldown || b.trips != 2 {
+		t.Errorf("cooldown = %v after %d trips, want %v after 2", b.cooldown, b.trips, 2*baseCooldown)
+	}
+
+	// A successful probe closes it and resets the backoff
+	probe = probe.Add(2*baseCooldown + time.Second)
+	b.acquire(probe)
+	b.success()
+	if b.state(probe) != StateClosed || b.trips != 0 {
+		t.Errorf("state after a successful probe = %v with %d trips, want closed with 0", b.state(probe), b.trips)
+	}
+}
+
+func TestBreakerFailure(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name         string
+		statusCode   int
+		retryAfter   time.Duration
+		wantTrip     bool
+		wantCooldown time.Duration
+	}{
+		{name: "client error", statusCode: 400},
+		{name: "request timeout", statusCode: 408},
+		{name: "rate limit", statusCode: 429, wantTrip: true, wantCooldown: baseCooldown},
+		{name: "server error", statusCode: 502, wantTrip: true, wantCooldown: baseCooldown},
+		{name: "retry-after longer than the cooldown", statusCode: 429, retryAfter: time.Hour, wantTrip: true, wantCooldown: time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &breaker{}
+			if got := b.failure(now, tt.statusCode, tt.retryAfter); got != tt.wantTrip {
+				t.Fatalf("failure() = %v, want %v", got, tt.wantTrip)
+			}
+			if tt.wantTrip && b.cooldown != tt.wantCooldown {
+				t.Errorf("cooldown = %v, want %v", b.cooldown, tt.wantCooldown)
+			}
+		})
+	}
+
+	t.Run("old failures are forgotten", func(t *testing.T) {
+		b := &breaker{}
+		for i := 0; i < maxRecentFailures-1; i++ {
+			b.failure(now, 408, 0)
+		}
+		if b.failure(now.Add(failureWindow+time.Second), 408, 0) {
+			t.Error("failures outside the window tripped the breaker")
+		}
+	})
+
+	t.Run("client errors are not counted", func(t *testing.T) {
+		b := &breaker{}
+		for _, code := range []int{400, 401, 404, 413, 422, 400, 400} {
+			b.failure(now, code, 0)
+		}
+		if b.failures != 0 || b.failure(now, 408, 0) {
+			t.Errorf("client errors counted as %d failures", b.failures)
+		}
+	})
+
+	t.Run("cooldown is capped", func(t *testing.T) {
+		b := &breaker{trips: 20}
+		b.trip(now, 0)
+		if b.cooldown != maxCooldown {
+			t.Errorf("cooldown = %v, want %v", b.cooldown, maxCooldown)
+		}
+	})
+
+	t.Run("parking leaves the backoff alone", func(t *testing.T) {
+		b := &breaker{}
+		b.park(now, 5*time.Second)
+		if b.trips != 0 || b.state(now) != StateOpen || b.state(now.Add(6*time.Second)) != StateHalfOpen {
+			t.Errorf("parked breaker has %d trips and is %v", b.trips, b.state(now))
+		}
+	})
+}
+
+func TestPacer(t *testing.T) {
+	now := time.Now()
+
+	t.Run("unknown window", func(t *testing.T) {
+		p := &pacer{}
+		p.observe(&openrouter.RateLimit{Limit: -1, Remaining: -1})
+		if wait := p.reserve(now); wait != 0 {
+			t.Errorf("reserve() = %v, want 0", wait)
+		}
+	})
+
+	t.Run("spreads the rest of the window", func(t *testing.T) {
+		p := &pacer{}
+		p.observe(&openrouter.RateLimit{Limit: 10, Remaining: 4, Reset: now.Add(9 * time.Second)})
+
+		// Requests pass while more than paceFraction of the window is left,
+		// then the last ones are spaced out until the reset
+		want := []time.Duration{0, 0, 0, 3 * time.Second, 7500 * time.Millisecond}
+		for i, w := range want {
+			if got := p.reserve(now); got != w {
+				t.Errorf("reserve() #%d = %v, want %v", i+1, got, w)
+			}
+		}
+	})
+
+	t.Run("waits are capped", func(t *testing.T) {
+		p := &pacer{}
+		p.observe(&openrouter.RateLimit{Limit: 10, Remaining: 0, Reset: now.Add(time.Hour)})
+		p.reserve(now)
+		if got := p.reserve(now); got != maxPaceDelay {
+			t.Errorf("reserve() = %v, want %v", got, maxPaceDelay)
+		}
+	})
+
+	t.Run("a burst does not push the schedule ahead", func(t *testing.T) {
+		p := &pacer{}
+		p.observe(&openrouter.RateLimit{Limit: 100, Remaining: 20, Reset: now.Add(time.Minute)})
+		for i := 0; i < 10; i++ {
+			if got := p.reserve(now); got > maxPaceDelay {
+				t.Fatalf("reserve() #%d = %v, want at most %v", i+1, got, maxPaceDelay)
+			}
+		}
+
+		// Once the burst's capped slots have passed, the schedule goes on
+		// from the last of them rather than from where the burst had
+		// pushed it
+		later := now.Add(maxPaceDelay + 2*time.Second)
+		if got := p.reserve(later); got > 3*time.Second {
+			t.Errorf("reserve() after the burst = %v, want the next interval", got)
+		}
+	})
+
+	t.Run("a window that has passed", func(t *testing.T) {
+		p := &pacer{}
+		p.observe(&openrouter.RateLimit{Limit: 10, Remaining: 0, Reset: now.Add(-time.Second)})
+		if got := p.reserve(now); got != 0 {
+			t.Errorf("reserve() = %v, want 0", got)
+		}
+	})
+}
+
+func TestPaceRefusesWhenCancelled(t *testing.T) {
+	m := New()
+	m.SetCandidates(testCandidates(1), 0)
+	m.RecordSuccess("m0", &openrouter.RateLimit{Limit: 10, Remaining: 1, Reset: time.Now().Add(time.Hour)})
+
+	// The first request takes the slot, the second has to wait for its share
+	if err := m.Pace(context.Background(), "m0"); err != nil {
+		t.Fatalf("Pace() error = %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := m.Pace(ctx, "m0"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Pace() error = %v, want context.Canceled", err)
+	}
+}
+
+func TestFailover(t *testing.T) {
+	m := New()
+	m.SetCandidates(testCandidates(2), 0)
+
+	if !m.RecordFailure("m0", 500, nil) {
+		t.Fatal("RecordFailure() did not switch to another model")
+	}
+	if got := m.CurrentID(); got != "m1" {
+		t.Errorf("current = %s, want m1", got)
+	}
+	if picked, err := m.Pick(textReqs()); err != nil || picked.ID != "m1" {
+		t.Errorf("Pick() = %v, %v, want m1", picked, err)
+	}
+
+	// With every breaker open the current model is kept
+	if m.RecordTimeout("m1") {
+		t.Error("RecordTimeout() switched although no model is usable")
+	}
+	for _, s := range m.Status() {
+		if s.Breaker != StateOpen {
+			t.Errorf("%s breaker = %v, want open", s.Model.ID, s.Breaker)
+		}
+	}
+
+	// A rate limited model is parked for exactly the advertised time
+	m.RecordSuccess("m0", nil)
+	m.RecordFailure("m0", 429, &openrouter.RateLimit{Limit: -1, Remaining: -1, RetryAfter: time.Hour})
+	for _, s := range m.Status() {
+		if s.Model.ID == "m0" && (s.Breaker != StateOpen || s.Trips != 0) {
+			t.Errorf("m0 is %v with %d trips, want parked", s.Breaker, s.Trips)
+		}
+	}
+}
+
+// TestConcurrentUse exercises the manager from many goroutines; run it with
+// -race
+func TestConcurrentUse(t *testing.T) {
+	m := New()
+	m.SetCandidates(testCandidates(4), 0)
+	m.SetFallbacks([]openrouter.Model{{ID: "local", ContextLength: 8192}})
+	if err := m.SetAdaptive(AdaptiveThompson, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	const workers, rounds = 8, 200
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				picked, err := m.Pick(textReqs())
+				if err != nil {
+					t.Errorf("Pick() error = %v", err)
+					return
+				}
+				id := picked.ID
+
+				switch (w + i) % 7 {
+				case 0:
+					m.RecordFailure(id, 500, nil)
+				case 1:
+					m.RecordTimeout(id)
+				case 2:
+					m.Merge(testCandidates(2+i%3), 0)
+				case 3:
+					m.SwitchNext()
+				case 4:
+					m.Status()
+				default:
+					m.RecordSuccess(id, &openrouter.RateLimit{Limit: 20, Remaining: 10, Reset: time.Now().Add(time.Minute)})
+					m.RecordSample(id, Sample{TTFT: time.Millisecond, Total: 10 * time.Millisecond, CompletionTokens: 5})
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	if len(m.Status()) == 0 {
+		t.Error("Status() is empty after concurrent use")
+	}
+}
+
+func TestMergePrunesState(t *testing.T) {
+	m := New()
+	m.SetCandidates(testCandidates(3), 2)
+	m.SetFallbacks([]openrouter.Model{{ID: "local"}})
+	for _, id := range []string{"m0", "m1", "m2", "local", "hinted"} {
+		m.RecordTimeout(id)
+		m.RecordSample(id, Sample{Total: time.Second})
+	}
+
+	added, removed := m.Merge(testCandidates(2), 0)
+	if len(added) != 0 || len(removed) != 1 || removed[0] != "m2" {
+		t.Errorf("Merge() = %v added, %v removed, want m2 removed", added, removed)
+	}
+	if got := m.CurrentID(); got != "m0" && got != "m1" {
+		t.Errorf("current = %q, want a remaining candidate", got)
+	}
+
+	for _, id := range []string{"m0", "m1", "local"} {
+		if _, ok := m.breakers[id]; !ok || m.Metrics(id).Failures == 0 {
+			t.Errorf("state of %s was dropped", id)
+		}
+	}
+	for _, id := range []string{"m2", "hinted"} {
+		if _, ok := m.breakers[id]; ok {
+			t.Errorf("breaker of %s was kept", id)
+		}
+		if _, ok := m.metrics[id]; ok {
+			t.Errorf("metrics of %s were kept", id)
+		}
+		if _, ok := m.timeouts[id]; ok {
+			t.Errorf("timeouts of %s were kept", id)
+		}
+	}
+}
+
+func TestFallbackTier(t *testing.T) {
+	remote := testCandidates(2)
+	local := openrouter.Model{ID: "ollama:llama3.2:3b", Provider: "ollama", ContextLength: 8192}
+
+	m := New()
+	m.SetFallbackFetcher(func() ([]openrouter.Model, error) { return []openrouter.Model{local}, nil })
+
+	// Without free remote candidates the fallback takes the requests
+	if err := m.Refresh(func() ([]openrouter.Model, error) { return nil, errors.New("unreachable") }, 0); err == nil {
+		t.Fatal("Refresh() succeeded without candidates")
+	}
+	if picked, err := m.Pick(textReqs()); err != nil || picked == nil || picked.ID != local.ID {
+		t.Fatalf("Pick() without candidates = %v, %v, want the fallback", picked, err)
+	}
+
+	// As long as a remote candidate is usable it is preferred
+	if err := m.Refresh(func() ([]openrouter.Model, error) { return remote, nil }, 0); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if picked, _ := m.Pick(textReqs()); picked.ID != "m0" {
+		t.Errorf("Pick() = %s, want the remote m0", picked.ID)
+	}
+	m.RecordFailure("m0", 502, nil)
+	if picked, _ := m.Pick(textReqs()); picked.ID != "m1" {
+		t.Errorf("Pick() after m0 failed = %s, want the remote m1", picked.ID)
+	}
+
+	// Once none is, the fallback is
+	if !m.RecordFailure("m1", 502, nil) {
+		t.Error("RecordFailure() of the last remote candidate did not offer the fallback")
+	}
+	if picked, _ := m.Pick(textReqs()); picked.ID != local.ID {
+		t.Errorf("Pick() with every candidate down = %s, want the fallback", picked.ID)
+	}
+
+	// and a recovered candidate takes over again
+	m.RecordSuccess("m1", nil)
+	if picked, _ := m.Pick(textReqs()); picked.ID != "m1" {
+		t.Errorf("Pick() after m1 recovered = %s, want m1", picked.ID)
+	}
+}
+
+func TestVisionSearchesThePool(t *testing.T) {
+	vision := openrouter.Model{ID: "vendor/vision:free", ContextLength: 8192}
+	vision.Architecture.InputModalities = []string{"text", "image"}
+	imageReqs := func() model.Requirements {
+		return model.RequirementsFor(&openrouter.ChatRequest{
+			Messages: []openrouter.ChatMessage{{Role: "user", Content: openrouter.PartsContent([]openrouter.ContentPart{
+				{Type: "image_url", ImageURL: &openrouter.ImageURL{URL: "https://example.com/cat.jpg"}},
+			})}},
+		})
+	}
+
+	m := New()
+	m.SetPoolFetcher(func() ([]openrouter.Model, error) { return append(testCandidates(3), vision), nil })
+	if err := m.Refresh(func() ([]openrouter.Model, error) { return testCandidates(2), nil }, 0); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if picked, err := m.Pick(imageReqs()); err != nil || picked == nil || picked.ID != vision.ID {
+		t.Errorf("Pick() = %v, %v, want the pool's vision model", picked, err)
+	}
+	if picked, _ := m.Pick(textReqs()); picked.ID != "m0" {
+		t.Errorf("Pick() of a text request = %s, want the candidate m0", picked.ID)
+	}
+
+	m.SetPoolFetcher(func() ([]openrouter.Model, error) { return testCandidates(3), nil })
+	if err := m.Refresh(func() ([]openrouter.Model, error) { return testCandidates(2), nil }, 0); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	var constraint *model.ConstraintError
+	if _, err := m.Pick(imageReqs()); !errors.As(err, &constraint) || constraint.Capability != model.CapabilityVision {
+		t.Errorf("Pick() error = %v, want a vision ConstraintError", err)
+	}
+}
@@ -0,0 +1,176 @@
+package manager
+
+import "time"
+
+const (
+	// metricsWeight is the weight of a new observation in a model's moving
+	// averages, so a model that slows down is noticed within a few requests
+	metricsWeight = 0.3
+
+	// banditDiscount is how much of a model's past rewards is kept when a
+	// new one is observed. Outcomes of the last 20 or so requests dominate,
+	// so a model that stops performing loses its traffic.
+	banditDiscount = 0.95
+
+	// A request earns half the speed reward at the reference time to first
+	// token, total latency or throughput
+	referenceTTFT    = 2 * time.Second
+	referenceLatency = 10 * time.Second
+	referenceTPS     = 30.0
+)
+
+// Sample is what was observed of a successful request
+type Sample struct {
+	// TTFT is the time to the first streamed token, 0 when the response
+	// was not streamed
+	TTFT time.Duration
+
+	// Total is how long the whole request took
+	Total time.Duration
+
+	// CompletionTokens is the number of tokens generated, 0 if unknown
+	CompletionTokens int
+}
+
+// NewSample returns the sample of a request sent at start whose first token
+// arrived at firstToken, zero when it was not streamed, and which generated
+// completionTokens tokens
+func NewSample(start, firstToken time.Time, completionTokens int) Sample {
+	s := Sample{
+		Total:            time.Since(start),
+		CompletionTokens: completionTokens,
+	}
+	if !firstToken.IsZero() {
+		s.TTFT = firstToken.Sub(start)
+	}
+	return s
+}
+
+// Metrics are the moving averages of a model's requests. An average without
+// observations is 0.
+type Metrics struct {
+	TTFT         time.Duration
+	Latency      time.Duration
+	TokensPerSec float64
+
+	// SuccessRatio is the moving average share of requests that succeeded
+	SuccessRatio float64
+	Successes    int
+	Failures     int
+}
+
+// metrics tracks the Metrics of a model together with the discounted
+// rewards of the adaptive ranking
+type metrics struct {
+	Metrics
+
+	ttftSeen bool
+	tpsSeen  bool
+
+	// reward and penalty sum the discounted speed rewards of successes and
+	// what they fell short of 1, failures counting as a full penalty
+	reward  float64
+	penalty float64
+}
+
+// RecordSample records the performance of a successful request to a model
+func (m *Manager) RecordSample(modelID string, s Sample) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mt := m.metric(modelID)
+	first := mt.Successes == 0
+	mt.Successes++
+	mt.SuccessRatio = ewma(mt.SuccessRatio, 1, first && mt.Failures == 0)
+	mt.Latency = time.Duration(ewma(float64(mt.Latency), float64(s.Total), first))
+	if s.TTFT > 0 {
+		mt.TTFT = time.Duration(ewma(float64(mt.TTFT), float64(s.TTFT), !mt.ttftSeen))
+		mt.ttftSeen = true
+	}
+	if tps := s.tokensPerSec(); tps > 0 {
+		mt.TokensPerSec = ewma(mt.TokensPerSec, tps, !mt.tpsSeen)
+		mt.tpsSeen = true
+	}
+
+	r := s.reward()
+	mt.reward = banditDiscount*mt.reward + r
+	mt.penalty = banditDiscount*mt.penalty + 1 - r
+}
+
+// recordFailed counts a failed request against a model's success ratio and
+// adaptive rank. The caller must hold the lock.
+func (m *Manager) recordFailed(modelID string) {
+	mt := m.metric(modelID)
+	mt.SuccessRatio = ewma(mt.SuccessRatio, 0, mt.Successes == 0 && mt.Failures == 0)
+	mt.Failures++
+	mt.reward = banditDiscount * mt.reward
+	mt.penalty = banditDiscount*mt.penalty + 1
+}
+
+// Latency returns the moving average latency of a model, and false when no
+// request to it has succeeded yet
+func (m *Manager) Latency(modelID string) (time.Duration, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mt, ok := m.metrics[modelID]
+	if !ok || mt.Successes == 0 {
+		return 0, false
+	}
+	return mt.Latency, true
+}
+
+// Metrics returns the moving averages of a model's requests
+func (m *Manager) Metrics(modelID string) Metrics {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if mt, ok := m.metrics[modelID]; ok {
+		return mt.Metrics
+	}
+	return Metrics{}
+}
+
+// metric returns the metrics of a model, creating them on first use. The
+// caller must hold the lock.
+func (m *Manager) metric(modelID string) *metrics {
+	mt, ok := m.metrics[modelID]
+	if !ok {
+		mt = &metrics{}
+		m.metrics[modelID] = mt
+	}
+	return mt
+}
+
+// tokensPerSec returns the generation speed of the sample, 0 if unknown.
+// The time to the first token is left out, as it is mostly queueing.
+func (s Sample) tokensPerSec() float64 {
+	d := s.Total - s.TTFT
+	if s.CompletionTokens <= 0 || d <= 0 {
+		return 0
+	}
+	return float64(s.CompletionTokens) / d.Seconds()
+}
+
+// reward rates the speed of a successful request between 0 and 1, from
+// its time to first token, or its latency when it was not streamed, and
+// its throughput
+func (s Sample) reward() float64 {
+	wait := 1 / (1 + s.Total.Seconds()/referenceLatency.Seconds())
+	if s.TTFT > 0 {
+		wait = 1 / (1 + s.TTFT.Seconds()/referenceTTFT.Seconds())
+	}
+	tps := s.tokensPerSec()
+	if tps == 0 {
+		return wait
+	}
+	return (wait + tps/(tps+referenceTPS)) / 2
+}
+
+// ewma adds an observation to a moving average, or starts it
+func ewma(avg, x float64, first bool) float64 {
+	if first {
+		return x
+	}
+	return avg + metricsWeight*(x-avg)
+}
@@ -0,0 +1,96 @@
+package manager
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestEWMA(t *testing.T) {
+	avg := ewma(0, 10, true)
+	if avg != 10 {
+		t.Fatalf("first observation = %v, want 10", avg)
+	}
+	avg = ewma(avg, 20, false)
+	if want := 10 + metricsWeight*10; avg != want {
+		t.Errorf("second observation = %v, want %v", avg, want)
+	}
+
+	// A steady value is approached within a few observations
+	for i := 0; i < 20; i++ {
+		avg = ewma(avg, 100, false)
+	}
+	if math.Abs(avg-100) > 0.1 {
+		t.Errorf("average = %v after 20 observations of 100", avg)
+	}
+}
+
+func TestRecordSample(t *testing.T) {
+	m := New()
+	if _, ok := m.Latency("m0"); ok {
+		t.Error("Latency() reported before any request")
+	}
+
+	m.RecordSample("m0", Sample{TTFT: time.Second, Total: 3 * time.Second, CompletionTokens: 100})
+	got := m.Metrics("m0")
+	if got.TTFT != time.Second || got.Latency != 3*time.Second || got.TokensPerSec != 50 || got.SuccessRatio != 1 || got.Successes != 1 {
+		t.Fatalf("metrics after the first sample = %+v", got)
+	}
+
+	// A sample that was not streamed and whose tokens are unknown only
+	// moves the latency
+	m.RecordSample("m0", Sample{Total: 13 * time.Second})
+	got = m.Metrics("m0")
+	if want := 3*time.Second + time.Duration(metricsWeight*float64(10*time.Second)); got.Latency != want {
+		t.Errorf("latency = %v, want %v", got.Latency, want)
+	}
+	if got.TTFT != time.Second || got.TokensPerSec != 50 {
+		t.Errorf("TTFT = %v and throughput = %v, want them unchanged", got.TTFT, got.TokensPerSec)
+	}
+	if latency, ok := m.Latency("m0"); !ok || latency != got.Latency {
+		t.Errorf("Latency() = %v, %v, want %v", latency, ok, got.Latency)
+	}
+
+	m.mu.Lock()
+	m.recordFailed("m0")
+	m.mu.Unlock()
+	if got := m.Metrics("m0"); got.SuccessRatio != 1-metricsWeight || got.Failures != 1 {
+		t.Errorf("after a failure = %+v, want a success ratio of %v", got, 1-metricsWeight)
+	}
+}
+
+func TestSuccessRatioStartsWithFailure(t *testing.T) {
+	m := New()
+	m.mu.Lock()
+	m.recordFailed("m0")
+	m.mu.Unlock()
+	if got := m.Metrics("m0").SuccessRatio; got != 0 {
+		t.Fatalf("success ratio = %v after a failure, want 0", got)
+	}
+
+	m.RecordSample("m0", Sample{Total: time.Second})
+	if got := m.Metrics("m0").SuccessRatio; got != metricsWeight {
+		t.Errorf("success ratio = %v after a failure and a success, want %v", got, metricsWeight)
+	}
+	if _, ok := m.Latency("m0"); !ok {
+		t.Error("Latency() not reported after a success")
+	}
+}
+
+func TestSampleReward(t *testing.T) {
+	fast := Sample{TTFT: 200 * time.Millisecond, Total: time.Second, CompletionTokens: 200}
+	slow := Sample{TTFT: 5 * time.Second, Total: 30 * time.Second, CompletionTokens: 200}
+	unstreamed := Sample{Total: referenceLatency}
+
+	if !(fast.reward() > slow.reward()) {
+		t.Errorf("fast reward %v is not above slow reward %v", fast.reward(), slow.reward())
+	}
+	for _, s := range []Sample{fast, slow, unstreamed} {
+		if r := s.reward(); r <= 0 || r >= 1 {
+			t.Errorf("reward of %+v = %v, want between 0 and 1", s, r)
+		}
+	}
+	if r := unstreamed.reward(); r != 0.5 {
+		t.Errorf("reward at the reference latency = %v, want 0.5", r)
+	}
+}
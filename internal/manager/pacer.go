@@ -0,0 +1,74 @@
+package manager
+
+import (
+	"math"
+	"time"
+
+	"github.com/mosajjal/frugalai/internal/openrouter"
+)
+
+const (
+	// paceFraction is the share of a rate limit window's requests left at
+	// which pacing starts
+	paceFraction = 0.2
+
+	// maxPaceDelay caps how long a single request is held back
+	maxPaceDelay = 10 * time.Second
+)
+
+// pacer spreads the requests a model has left in its rate limit window
+// evenly over the rest of the window, so the limit is not hit before the
+// window resets. It is not safe for concurrent use; the manager's lock
+// protects it.
+type pacer struct {
+	limit     int
+	remaining int
+	reset     time.Time
+
+	// next is the earliest time the next paced request may be sent
+	next time.Time
+}
+
+// observe records the rate limit state reported with a response
+func (p *pacer) observe(rl *openrouter.RateLimit) {
+	if rl == nil || rl.Remaining < 0 {
+		return
+	}
+	p.limit = rl.Limit
+	p.remaining = rl.Remaining
+	p.reset = rl.Reset
+}
+
+// reserve claims a request slot at now and returns how long the request has
+// to wait for it. Requests are not held back while more than paceFraction
+// of the window is left or when the window is unknown.
+func (p *pacer) reserve(now time.Time) time.Duration {
+	if p.reset.IsZero() || !now.Before(p.reset) {
+		return 0
+	}
+
+	low := 1
+	if p.limit > 0 {
+		low = int(math.Ceil(float64(p.limit) * paceFraction))
+	}
+	if p.remaining > low {
+		p.remaining--
+		return 0
+	}
+
+	// The schedule continues from the slot actually granted, so a burst
+	// of capped waits does not push it further and further ahead
+	interval := p.reset.Sub(now) / time.Duration(p.remaining+1)
+	start := now
+	if p.next.After(start) {
+		start = p.next
+	}
+	if latest := now.Add(maxPaceDelay); start.After(latest) {
+		start = latest
+	}
+	p.next = start.Add(interval)
+	if p.remaining > 0 {
+		p.remaining--
+	}
+	return start.Sub(now)
+}
@@ -0,0 +1,278 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/mosajjal/frugalai/internal/openrouter"
+)
+
+// retryInterval is how often a failed load is retried while the manager has
+// no candidates at all
+const retryInterval = 30 * time.Second
+
+// Fetcher loads a fresh candidate list, best candidate first
+type Fetcher func() ([]openrouter.Model, error)
+
+// Merge replaces the candidate list with a freshly fetched one and returns
+// the IDs of the models that were added and removed. Circuit breaker state
+// and metrics are kept for models that are still candidates, fallbacks or
+// in the pool, and dropped for the others.
+// The current model stays selected while it is still a candidate, otherwise
+// the first candidate whose breaker lets requests through is selected. When
+// there is no current model yet, initialIdx selects it as in SetCandidates.
+func (m *Manager) Merge(candidates []openrouter.Model, initialIdx int) (added, removed []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	previous := make(map[string]bool, len(m.candidates))
+	for _, c := range m.candidates {
+		previous[c.ID] = true
+	}
+	fresh := make(map[string]bool, len(candidates))
+	for _, c := range candidates {
+		fresh[c.ID] = true
+		if !previous[c.ID] {
+			added = append(added, c.ID)
+		}
+	}
+	for _, c := range m.candidates {
+		if !fresh[c.ID] {
+			removed = append(removed, c.ID)
+		}
+	}
+
+	currentID := ""
+	if m.current >= 0 {
+		currentID = m.candidates[m.current].ID
+	}
+
+	m.candidates = append([]openrouter.Model(nil), candidates...)
+	m.current = -1
+	switch {
+	case len(m.candidates) == 0:
+	case currentID != "":
+		for i, c := range m.candidates {
+			if c.ID == currentID {
+				m.current = i
+				break
+			}
+		}
+		if m.current < 0 {
+			m.current = m.firstUsable()
+			log.Printf("[INFO] Model %s is no longer a candidate, switching to %s",
+				currentID, m.candidates[m.current].ID)
+		}
+	case initialIdx >= 0 && initialIdx < len(m.candidates):
+		m.current = initialIdx
+	default:
+		m.current = 0
+	}
+
+	m.prune()
+	return added, removed
+}
+
+// SetFallbackFetcher sets where the fallback models are loaded from. They
+// are reloaded with every refresh of the candidates.
+func (m *Manager) SetFallbackFetcher(fetch Fetcher) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.fallbackFetch = fetch
+}
+
+// SetPoolFetcher sets where the pool of every ranked free model is loaded
+// from. It is reloaded after every refresh of the candidates.
+func (m *Manager) SetPoolFetcher(fetch Fetcher) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.poolFetch = fetch
+}
+
+// Refresh fetches a fresh candidate list, merges it into the manager and
+// logs what changed. An empty list is treated as an error and leaves the
+// existing candidates in place. The fallback models are reloaded first, so
+// they are available even when the candidates cannot be fetched, and the
+// pool last, so it can reuse the models fetched for the candidates.
+func (m *Manager) Refresh(fetch Fetcher, initialIdx int) error {
+	m.refreshFallbacks()
+	defer m.refreshPool()
+
+	candidates, err := fetch()
+	if err != nil {
+		return err
+	}
+	if len(candidates) == 0 {
+		return errors.New("no free model candidates available")
+	}
+
+	added, removed := m.Merge(candidates, initialIdx)
+
+	// Everything is new on the first load
+	if len(removed) == 0 && len(added) == len(candidates) {
+		log.Printf("[INFO] Found %d free model candidates:", len(candidates))
+		for i, c := range candidates {
+			log.Printf("  [%d] %s", i, c.Name)
+			log.Printf("      ID: %s", c.ID)
+			log.Printf("      Modality: %s, Tokenizer: %s", c.Architecture.Modality, c.Architecture.Tokenizer)
+		}
+		if selected, ok := m.Current(); ok {
+			log.Printf("[INFO] Selected model: %s", selected.Name)
+			log.Printf("[INFO]   ID: %s", selected.ID)
+			log.Printf("[INFO]   Modality: %s", selected.Architecture.Modality)
+			log.Printf("[INFO]   Tokenizer: %s", selected.Architecture.Tokenizer)
+			log.Printf("[INFO]   Context Length: %d", selected.ContextLength)
+		}
+		return nil
+	}
+
+	if len(added) == 0 && len(removed) == 0 {
+		log.Printf("[DEBUG] Model candidates unchanged (%d candidates)", len(candidates))
+		return nil
+	}
+	for _, id := range added {
+		log.Printf("[INFO] New model candidate: %s", id)
+	}
+	for _, id := range removed {
+		log.Printf("[INFO] Dropped model candidate: %s", id)
+	}
+	log.Printf("[INFO] Model candidates refreshed: %d added, %d removed, %d total",
+		len(added), len(removed), len(candidates))
+	return nil
+}
+
+// refreshFallbacks reloads the fallback models. A failed load keeps the
+// previous ones.
+func (m *Manager) refreshFallbacks() {
+	m.mu.Lock()
+	fetch := m.fallbackFetch
+	m.mu.Unlock()
+	if fetch == nil {
+		return
+	}
+
+	fallbacks, err := fetch()
+	if err != nil {
+		log.Printf("[WARN] Could not load fallback models: %v", err)
+		return
+	}
+
+	m.mu.Lock()
+	changed := len(fallbacks) != len(m.fallbacks)
+	for i := 0; !changed && i < len(fallbacks); i++ {
+		changed = fallbacks[i].ID != m.fallbacks[i].ID
+	}
+	m.fallbacks = append([]openrouter.Model(nil), fallbacks...)
+	m.mu.Unlock()
+
+	if changed {
+		log.Printf("[INFO] Found %d fallback models:", len(fallbacks))
+		for i, f := range fallbacks {
+			log.Printf("  [%d] %s", i, f.ID)
+		}
+	}
+}
+
+// refreshPool reloads the pool of every ranked free model and drops the
+// state of models that left it. A failed load keeps the previous pool.
+func (m *Manager) refreshPool() {
+	m.mu.Lock()
+	fetch := m.poolFetch
+	m.mu.Unlock()
+	if fetch == nil {
+		return
+	}
+
+	pool, err := fetch()
+	if err != nil {
+		log.Printf("[DEBUG] Could not load the model pool: %v", err)
+		return
+	}
+
+	m.mu.Lock()
+	m.pool = append([]openrouter.Model(nil), pool...)
+	m.prune()
+	m.mu.Unlock()
+}
+
+// prune drops the breakers, pacers, timeouts and metrics of models that are
+// neither candidates, fallbacks nor in the pool, such as models requested
+// by hints or by name that have since been removed. The caller must hold
+// the lock.
+func (m *Manager) prune() {
+	known := make(map[string]bool, len(m.candidates)+len(m.fallbacks)+len(m.pool))
+	for _, models := range [][]openrouter.Model{m.candidates, m.fallbacks, m.pool} {
+		for _, c := range models {
+			known[c.ID] = true
+		}
+	}
+
+	for id := range m.breakers {
+		if !known[id] {
+			delete(m.breakers, id)
+		}
+	}
+	for id := range m.pacers {
+		if !known[id] {
+			delete(m.pacers, id)
+		}
+	}
+	for id := range m.timeouts {
+		if !known[id] {
+			delete(m.timeouts, id)
+		}
+	}
+	for id := range m.metrics {
+		if !known[id] {
+			delete(m.metrics, id)
+		}
+	}
+}
+
+// StartRefresher loads the candidate list in the background and refreshes
+// it every interval until ctx is cancelled, so startup never waits for the
+// upstream. While the manager has no candidates, failed loads are retried
+// every retryInterval. A zero interval stops after the first successful
+// load.
+func (m *Manager) StartRefresher(ctx context.Context, interval time.Duration, fetch Fetcher, initialIdx int) {
+	go func() {
+		for {
+			wait := interval
+			if err := m.Refresh(fetch, initialIdx); err != nil {
+				log.Printf("[WARN] Could not refresh model candidates: %v", err)
+				if len(m.Candidates()) == 0 && (wait <= 0 || wait > retryInterval) {
+					log.Printf("[INFO] Retrying in %v", retryInterval)
+					wait = retryInterval
+				}
+			}
+			if wait <= 0 {
+				return
+			}
+
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+		}
+	}()
+}
+
+// firstUsable returns the index of the first candidate whose breaker lets
+// requests through, or 0 when none does. The caller must hold the lock and
+// the candidate list must not be empty.
+func (m *Manager) firstUsable() int {
+	now := time.Now()
+	for i, c := range m.candidates {
+		if m.breaker(c.ID).allow(now) {
+			return i
+		}
+	}
+	return 0
+}
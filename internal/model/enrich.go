@@ -0,0 +1,294 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/mosajjal/frugalai/internal/openrouter"
+)
+
+// Quality tiers an override can assign to a model, with the bonus they
+// replace the vendor bonus of the weighted scorer with
+const (
+	TierFrontier = "frontier"
+	TierStrong   = "strong"
+	TierStandard = "standard"
+	TierWeak     = "weak"
+)
+
+var tierBonuses = map[string]float64{
+	TierFrontier: 0.2,
+	TierStrong:   0.1,
+	TierStandard: 0,
+	TierWeak:     -0.1,
+}
+
+// Size patterns of model IDs and names, e.g. qwen3-30b-a3b,
+// llama-4-maverick-17b-128e, mixtral-8x22b or llama-3.3-70b. Sizes must
+// stand on their own, so a version such as gpt-4o or gemma-3n-e4b is not
+// mistaken for one.
+var (
+	activeSizePattern  = regexp.MustCompile(`(?i)(?:^|[^a-z0-9.])(\d+(?:\.\d+)?)([mbt])-a(\d+(?:\.\d+)?)([mbt])(?:$|[^a-z0-9])`)
+	expertCountPattern = regexp.MustCompile(`(?i)(?:^|[^a-z0-9.])(\d+(?:\.\d+)?)([mbt])-(\d+)e(?:$|[^a-z0-9])`)
+	expertSizePattern  = regexp.MustCompile(`(?i)(?:^|[^a-z0-9.])(\d+)x(\d+(?:\.\d+)?)([mbt])(?:$|[^a-z0-9])`)
+	sizePattern        = regexp.MustCompile(`(?i)(?:^|[^a-z0-9.])(\d+(?:\.\d+)?)([mbt])(?:$|[^a-z0-9])`)
+
+	// Sizes in prose, e.g. "671B parameters, with 37B active" or
+	// "30 billion total parameters"
+	totalPhrasePattern  = regexp.MustCompile(`(?i)(\d+(?:\.\d+)?)\s?(m|b|t|million|billion|trillion)[\s-]+(?:total\s+)?param`)
+	activePhrasePattern = regexp.MustCompile(`(?i)(\d+(?:\.\d+)?)\s?(m|b|t|million|billion|trillion)[\s-]+(?:parameters\s+)?active`)
+)
+
+// knownSizes are the published sizes of popular models whose IDs, names and
+// descriptions give none, keyed by ID pattern without the vendor. Sizes
+// that are not published, such as those of gpt-4o, stay unknown.
+var knownSizes = Overrides{
+	"deepseek-chat*": {Params: 671_000_000_000, ActiveParams: 37_000_000_000},
+	"deepseek-r1*":   {Params: 671_000_000_000, ActiveParams: 37_000_000_000},
+	"deepseek-v3*":   {Params: 671_000_000_000, ActiveParams: 37_000_000_000},
+	"kimi-k2*":       {Params: 1_000_000_000_000, ActiveParams: 32_000_000_000},
+	"glm-4.5*":       {Params: 355_000_000_000, ActiveParams: 32_000_000_000},
+	"glm-4.5-air*":   {Params: 106_000_000_000, ActiveParams: 12_000_000_000},
+	"glm-4.6*":       {Params: 355_000_000_000, ActiveParams: 32_000_000_000},
+}
+
+// ModelOverride sets the metadata of the models it applies to
+type ModelOverride struct {
+	Params       ParamCount `json:"params,omitempty"`
+	ActiveParams ParamCount `json:"active_params,omitempty"`
+	Tier         string     `json:"tier,omitempty"`
+}
+
+// ParamCount is a parameter count given in JSON as a number or a string
+// such as "70B"
+type ParamCount int
+
+// UnmarshalJSON accepts a number or a string with a K, M, B or T suffix
+func (p *ParamCount) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		s = string(data)
+	}
+	n, ok := ParseParams(s)
+	if !ok {
+		return fmt.Errorf("invalid parameter count %s", data)
+	}
+	*p = ParamCount(n)
+	return nil
+}
+
+// Overrides maps model IDs, or ID patterns such as deepseek/*, to the
+// metadata to set on the models
+type Overrides map[string]ModelOverride
+
+// LoadOverrides reads an override file, a JSON object of model IDs or ID
+// patterns to overrides
+func LoadOverrides(file string) (Overrides, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read model overrides: %w", err)
+	}
+
+	var overrides Overrides
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return nil, fmt.Errorf("failed to parse model overrides %s: %w", file, err)
+	}
+
+	for id, o := range overrides {
+		if _, err := path.Match(id, ""); err != nil {
+			return nil, fmt.Errorf("model override %q has an invalid pattern: %v", id, err)
+		}
+		if _, ok := tierBonuses[o.Tier]; o.Tier != "" && !ok {
+			return nil, fmt.Errorf("model override %q has unknown tier %q: expected %s, %s, %s or %s",
+				id, o.Tier, TierFrontier, TierStrong, TierStandard, TierWeak)
+		}
+	}
+	return overrides, nil
+}
+
+// find returns the override of a model ID. An exact ID wins over patterns,
+// and a longer pattern over a shorter one.
+func (o Overrides) find(id string) (ModelOverride, bool) {
+	if override, ok := o[id]; ok {
+		return override, true
+	}
+
+	best := ""
+	for pattern := range o {
+		if ok, _ := path.Match(pattern, id); ok && len(pattern) > len(best) {
+			best = pattern
+		}
+	}
+	if best == "" {
+		return ModelOverride{}, false
+	}
+	return o[best], true
+}
+
+// Enricher is a model source that fills in the parameter counts and
+// popularity the upstream does not report. Sizes are parsed from the ID, the
+// name and the description, in that order, then taken from the published
+// sizes of well-known models. Overrides take precedence over all of them.
+type Enricher struct {
+	source     ModelSource
+	overrides  Overrides
+	popularity PopularitySource
+}
+
+// NewEnricher creates an enricher of the models of source
+func NewEnricher(source ModelSource, overrides Overrides) *Enricher {
+	return &Enricher{
+		source:    source,
+		overrides: overrides,
+	}
+}
+
+// SetPopularity sets the source of the models' popularity, e.g. a snapshot
+// of OpenRouter's rankings
+func (e *Enricher) SetPopularity(src PopularitySource) {
+	e.popularity = src
+}
+
+// GetModels returns the enriched models of the source
+func (e *Enricher) GetModels() ([]openrouter.Model, error) {
+	models, err := e.source.GetModels()
+	if err != nil {
+		return nil, err
+	}
+	return e.Enrich(models), nil
+}
+
+// GetFreeModels returns the enriched free models of the source
+func (e *Enricher) GetFreeModels() ([]openrouter.Model, error) {
+	models, err := e.source.GetFreeModels()
+	if err != nil {
+		return nil, err
+	}
+	return e.Enrich(models), nil
+}
+
+// Enrich returns a copy of the models with their metadata filled in
+func (e *Enricher) Enrich(models []openrouter.Model) []openrouter.Model {
+	result := make([]openrouter.Model, len(models))
+	for i, m := range models {
+		if m.Params == 0 {
+			m.Params, m.ActiveParams = InferParams(m)
+		}
+		if m.Popularity == 0 && e.popularity != nil {
+			m.Popularity, _ = e.popularity.Count(m.ID)
+		}
+		if o, ok := e.overrides.find(m.ID); ok {
+			if o.Params > 0 {
+				m.Params = int(o.Params)
+			}
+			if o.ActiveParams > 0 {
+				m.ActiveParams = int(o.ActiveParams)
+			}
+			if o.Tier != "" {
+				m.QualityTier = o.Tier
+			}
+		}
+		result[i] = m
+	}
+	return result
+}
+
+// InferParams parses the total and active parameter counts of a model out
+// of its ID, name and description, falling back to the published sizes of
+// well-known models. Both are 0 when the size is unknown. Active is 0
+// unless the model is a mixture of experts whose active size is known or
+// can be estimated.
+func InferParams(m openrouter.Model) (total, active int) {
+	// Drop the provider prefix and vendor, e.g. groq:meta-llama/
+	id := m.ID
+	if m.Provider != "" {
+		id = strings.TrimPrefix(id, m.Provider+":")
+	}
+	if i := strings.LastIndex(id, "/"); i >= 0 {
+		id = id[i+1:]
+	}
+
+	for _, s := range []string{id, m.Name} {
+		if total, active = parseSize(s); total > 0 {
+			return total, active
+		}
+	}
+	if total, active = parseDescription(m.Description); total > 0 {
+		return total, active
+	}
+	if known, ok := knownSizes.find(id); ok {
+		return int(known.Params), int(known.ActiveParams)
+	}
+	return 0, 0
+}
+
+// parseSize parses a size such as 30b-a3b, 17b-128e, 8x22b or 70b out of an
+// ID or name. For an active size with N experts, the total is estimated as
+// active*N^(2/3), which puts Llama 4 Scout (17b-16e) at 108B and Maverick
+// (17b-128e) at 432B against their published 109B and 400B. The total size
+// of NxM experts is estimated as N*M and its active size as two experts, as
+// most such models route each token to two.
+func parseSize(s string) (total, active int) {
+	if match := activeSizePattern.FindStringSubmatch(s); match != nil {
+		return scaleSize(match[1], match[2]), scaleSize(match[3], match[4])
+	}
+	if match := expertCountPattern.FindStringSubmatch(s); match != nil {
+		active = scaleSize(match[1], match[2])
+		experts, _ := strconv.Atoi(match[3])
+		if experts < 2 {
+			return active, 0
+		}
+		return int(float64(active) * math.Pow(float64(experts), 2.0/3)), active
+	}
+	if match := expertSizePattern.FindStringSubmatch(s); match != nil {
+		experts, _ := strconv.Atoi(match[1])
+		size := scaleSize(match[2], match[3])
+		if experts > 2 {
+			active = 2 * size
+		}
+		return experts * size, active
+	}
+	if match := sizePattern.FindStringSubmatch(s); match != nil {
+		return scaleSize(match[1], match[2]), 0
+	}
+	return 0, 0
+}
+
+// parseDescription parses the sizes a description mentions in prose
+func parseDescription(s string) (total, active int) {
+	if match := totalPhrasePattern.FindStringSubmatch(s); match != nil {
+		total = scaleSize(match[1], match[2])
+	}
+	if match := activePhrasePattern.FindStringSubmatch(s); match != nil {
+		active = scaleSize(match[1], match[2])
+	}
+	if total == 0 || active >= total {
+		// An active size alone says nothing about the total
+		return total, 0
+	}
+	return total, active
+}
+
+// scaleSize converts a number and a unit such as "b" or "billion" into a
+// parameter count
+func scaleSize(number, unit string) int {
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0
+	}
+	switch strings.ToLower(unit[:1]) {
+	case "m":
+		n *= 1e6
+	case "b":
+		n *= 1e9
+	case "t":
+		n *= 1e12
+	}
+	return int(n)
+}
@@ -0,0 +1,83 @@
+package model
+
+import (
+	"math"
+	"testing"
+
+	"github.com/mosajjal/frugalai/internal/openrouter"
+)
+
+func TestInferParams(t *testing.T) {
+	tests := []struct {
+		name   string
+		model  openrouter.Model
+		total  int
+		active int
+	}{
+		{name: "dense", model: openrouter.Model{ID: "meta-llama/llama-3.3-70b-instruct:free"}, total: 70_000_000_000},
+		{name: "upper case", model: openrouter.Model{ID: "nousresearch/hermes-3-llama-3.1-405B"}, total: 405_000_000_000},
+		{name: "fraction", model: openrouter.Model{ID: "qwen/qwen-2.5-coder-1.5b-instruct"}, total: 1_500_000_000},
+		{name: "active size", model: openrouter.Model{ID: "qwen/qwen3-30b-a3b:free"}, total: 30_000_000_000, active: 3_000_000_000},
+		{name: "expert size", model: openrouter.Model{ID: "mistralai/mixtral-8x22b-instruct"}, total: 176_000_000_000, active: 44_000_000_000},
+		{name: "expert count", model: openrouter.Model{ID: "meta-llama/llama-4-maverick-17b-128e-instruct"}, total: 432_000_000_000, active: 17_000_000_000},
+		{name: "few experts", model: openrouter.Model{ID: "meta-llama/llama-4-scout-17b-16e-instruct"}, total: 108_000_000_000, active: 17_000_000_000},
+		{name: "version is no size", model: openrouter.Model{ID: "openai/gpt-4o"}},
+		{name: "effective size is no size", model: openrouter.Model{ID: "google/gemma-3n-e4b-it:free"}},
+		{name: "from the name", model: openrouter.Model{ID: "vendor/model", Name: "Vendor: Model 12B"}, total: 12_000_000_000},
+		{
+			name:   "from the description",
+			model:  openrouter.Model{ID: "vendor/model", Description: "A mixture of experts with 235B total parameters, of which 22B active per token."},
+			total:  235_000_000_000,
+			active: 22_000_000_000,
+		},
+		{name: "known size", model: openrouter.Model{ID: "deepseek/deepseek-r1-0528:free"}, total: 671_000_000_000, active: 37_000_000_000},
+		{name: "known size of a family", model: openrouter.Model{ID: "moonshotai/kimi-k2:free"}, total: 1_000_000_000_000, active: 32_000_000_000},
+		{name: "longest known pattern", model: openrouter.Model{ID: "z-ai/glm-4.5-air:free"}, total: 106_000_000_000, active: 12_000_000_000},
+		{name: "known size of a provider's model", model: openrouter.Model{ID: "groq:glm-4.5", Provider: "groq"}, total: 355_000_000_000, active: 32_000_000_000},
+		{
+			name:  "description before known size",
+			model: openrouter.Model{ID: "deepseek/deepseek-r1-lite", Description: "A 16B parameter distillation."},
+			total: 16_000_000_000,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			total, active := InferParams(tt.model)
+			// Estimates may be off by rounding, up to 0.5%
+			if math.Abs(float64(total-tt.total)) > 0.005*float64(tt.total) || active != tt.active {
+				t.Errorf("InferParams(%s) = %d, %d, want %d, %d", tt.model.ID, total, active, tt.total, tt.active)
+			}
+		})
+	}
+}
+
+func TestEnrichOverrides(t *testing.T) {
+	e := NewEnricher(nil, Overrides{
+		"deepseek/*":                 {Tier: TierStrong},
+		"deepseek/deepseek-r1*":      {Params: 700_000_000_000},
+		"openai/gpt-4o":              {Params: 200_000_000_000, Tier: TierFrontier},
+		"meta-llama/llama-4-scout-*": {ActiveParams: 17_500_000_000},
+	})
+
+	models := e.Enrich([]openrouter.Model{
+		{ID: "deepseek/deepseek-r1-0528:free"},
+		{ID: "openai/gpt-4o"},
+		{ID: "meta-llama/llama-4-scout-17b-16e-instruct"},
+		{ID: "ollama:qwen3:8b", Params: 8_190_000_000},
+	})
+
+	r1, gpt, scout, local := models[0], models[1], models[2], models[3]
+	if r1.Params != 700_000_000_000 || r1.ActiveParams != 37_000_000_000 || r1.QualityTier != "" {
+		t.Errorf("r1 = %d, %d, tier %q, want the longest pattern's params over the known size", r1.Params, r1.ActiveParams, r1.QualityTier)
+	}
+	if gpt.Params != 200_000_000_000 || gpt.QualityTier != TierFrontier {
+		t.Errorf("gpt-4o = %d, tier %q, want the exact override", gpt.Params, gpt.QualityTier)
+	}
+	if scout.ActiveParams != 17_500_000_000 || scout.Params == 0 {
+		t.Errorf("scout = %d, %d, want the inferred total and the overridden active size", scout.Params, scout.ActiveParams)
+	}
+	if local.Params != 8_190_000_000 {
+		t.Errorf("reported size = %d, want it kept", local.Params)
+	}
+}
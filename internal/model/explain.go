@@ -0,0 +1,128 @@
+package model
+
+import (
+	"sort"
+
+	"github.com/mosajjal/frugalai/internal/openrouter"
+)
+
+// Factors a score is made of
+const (
+	FactorPopularity   = "popularity"
+	FactorParams       = "params"
+	FactorContext      = "context"
+	FactorArchitecture = "architecture"
+	FactorTierBonus    = "tier_bonus"
+	FactorVendorBonus  = "vendor_bonus"
+	FactorPenalty      = "penalty"
+	FactorLatency      = "latency"
+	FactorTiebreak     = "tiebreak"
+	FactorFallback     = "fallback"
+)
+
+// Factor is a term of a model's score: a value, normalized where the
+// scorer normalizes it, times its weight. A factor that is itself a score,
+// such as a tiebreak, carries the factors of that score.
+type Factor struct {
+	Name    string
+	Value   float64
+	Weight  float64
+	Score   float64
+	Factors []Factor
+}
+
+// Explainer is a scorer that breaks a score down into its factors
+type Explainer interface {
+	Explain(m openrouter.Model) []Factor
+}
+
+// weighted returns a factor that contributes value times weight
+func weighted(name string, value, weight float64) Factor {
+	return Factor{Name: name, Value: value, Weight: weight, Score: value * weight}
+}
+
+// unweighted returns a factor that contributes its value as is
+func unweighted(name string, value float64) Factor {
+	return weighted(name, value, 1)
+}
+
+// squashed returns a factor that contributes the score of another scorer
+// squashed into the 0-1 range, with the factors of that score
+func squashed(name string, scorer Scorer, m openrouter.Model) Factor {
+	score := scorer.Score(m)
+	f := Factor{Name: name, Value: score, Weight: 1, Score: squash(score)}
+	if e, ok := scorer.(Explainer); ok {
+		f.Factors = e.Explain(m)
+	}
+	return f
+}
+
+// Explanation is how the selector treated a free model: its score and the
+// factors of it, and either its rank or the filter that rejected it
+type Explanation struct {
+	Model   openrouter.Model
+	Score   float64
+	Factors []Factor
+
+	// Rank is the 1-based position of the model among those kept, 0 when
+	// it was rejected
+	Rank int
+
+	// Rejected is why the configuration filtered the model out, "" when it
+	// was kept
+	Rejected string
+}
+
+// Explain scores every free model and reports the factors of each score,
+// the rank of the models kept and why the others were rejected. Kept
+// models come first in rank order, followed by the rejected ones by
+// descending score.
+func (s *Selector) Explain() ([]Explanation, error) {
+	models, err := s.freeModels()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	scorer := s.scorer
+	s.mu.RUnlock()
+
+	kept := []openrouter.Model{}
+	explanations := make([]Explanation, len(models))
+	for i, m := range models {
+		explanations[i] = Explanation{
+			Model:    m,
+			Score:    scorer.Score(m),
+			Rejected: s.rejectReason(m),
+		}
+		if e, ok := scorer.(Explainer); ok {
+			explanations[i].Factors = e.Explain(m)
+		}
+		if explanations[i].Rejected == "" {
+			kept = append(kept, m)
+		}
+	}
+
+	// Rank the kept models the way the candidates are ranked
+	ranks := make(map[string]int, len(kept))
+	for i, m := range s.rank(kept) {
+		ranks[m.ID] = i + 1
+	}
+	for i := range explanations {
+		if explanations[i].Rejected == "" {
+			explanations[i].Rank = ranks[explanations[i].Model.ID]
+		}
+	}
+
+	sort.SliceStable(explanations, func(i, j int) bool {
+		a, b := explanations[i], explanations[j]
+		if (a.Rank == 0) != (b.Rank == 0) {
+			return a.Rank != 0
+		}
+		if a.Rank != b.Rank {
+			return a.Rank < b.Rank
+		}
+		return a.Score > b.Score
+	})
+	return explanations, nil
+}
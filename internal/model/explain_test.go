@@ -0,0 +1,108 @@
+package model
+
+import (
+	"math"
+	"testing"
+
+	"github.com/mosajjal/frugalai/internal/config"
+)
+
+// testExplainSelector returns a selector over four models, two of which
+// the configuration rejects: vendor/tiny is below the minimum size and
+// vendor/denied is denied by a rule
+func testExplainSelector(t *testing.T) *Selector {
+	t.Helper()
+	models := staticSource{
+		{ID: "vendor/small", Params: 8_000_000_000, ContextLength: 8192, Popularity: 10},
+		{ID: "vendor/tiny", Params: 500_000_000, ContextLength: 8192},
+		{ID: "vendor/large", Params: 70_000_000_000, ContextLength: 131072, Popularity: 1000},
+		{ID: "vendor/denied", Params: 400_000_000_000, ContextLength: 131072},
+	}
+	s := NewSelector(models, &config.Config{MinParams: 1_000_000_000})
+	rules, err := NewRules(nil, []string{"vendor/denied"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetRules(rules)
+	return s
+}
+
+func TestExplain(t *testing.T) {
+	explanations, err := testExplainSelector(t).Explain()
+	if err != nil {
+		t.Fatalf("Explain() error = %v", err)
+	}
+
+	// Kept models come first by rank, then the rejected ones by score
+	want := []struct {
+		id       string
+		rank     int
+		rejected string
+	}{
+		{id: "vendor/large", rank: 1},
+		{id: "vendor/small", rank: 2},
+		{id: "vendor/denied", rejected: `denied by rule "vendor/denied"`},
+		{id: "vendor/tiny", rejected: "500000000 params is below the minimum of 1000000000"},
+	}
+	if len(explanations) != len(want) {
+		t.Fatalf("got %d explanations, want %d", len(explanations), len(want))
+	}
+	for i, w := range want {
+		e := explanations[i]
+		if e.Model.ID != w.id || e.Rank != w.rank || e.Rejected != w.rejected {
+			t.Errorf("explanation %d = %s, rank %d, rejected %q, want %s, %d, %q", i, e.Model.ID, e.Rank, e.Rejected, w.id, w.rank, w.rejected)
+		}
+	}
+
+	// Each score is the sum of its factors, weighted by the default weights
+	for _, e := range explanations {
+		sum := 0.0
+		for _, f := range e.Factors {
+			sum += f.Score
+			if math.Abs(f.Score-f.Value*f.Weight) > 1e-9 {
+				t.Errorf("%s factor %s = %v x %v = %v", e.Model.ID, f.Name, f.Value, f.Weight, f.Score)
+			}
+		}
+		if math.Abs(sum-e.Score) > 1e-9 {
+			t.Errorf("%s score = %v, want the sum of its factors %v", e.Model.ID, e.Score, sum)
+		}
+		for _, name := range []string{FactorPopularity, FactorParams, FactorContext, FactorArchitecture, FactorVendorBonus, FactorPenalty} {
+			if _, ok := factor(e.Factors, name); !ok {
+				t.Errorf("%s has no %s factor", e.Model.ID, name)
+			}
+		}
+	}
+	if got, _ := factor(explanations[3].Factors, FactorPenalty); got >= 0 {
+		t.Errorf("vendor/tiny penalty = %v, want it penalized", got)
+	}
+	for _, f := range explanations[0].Factors {
+		if f.Name == FactorParams && f.Weight != DefaultWeights.Params {
+			t.Errorf("params weight = %v, want %v", f.Weight, DefaultWeights.Params)
+		}
+	}
+}
+
+func TestExplainNestedFactors(t *testing.T) {
+	s := testExplainSelector(t)
+	s.SetScorer(&ContextScorer{Tiebreak: &WeightedScorer{Weights: DefaultWeights}})
+
+	explanations, err := s.Explain()
+	if err != nil {
+		t.Fatalf("Explain() error = %v", err)
+	}
+	if explanations[0].Model.ID != "vendor/large" {
+		t.Fatalf("first explanation = %s, want the longest context", explanations[0].Model.ID)
+	}
+
+	factors := explanations[0].Factors
+	if len(factors) != 2 || factors[0].Name != FactorContext || factors[0].Score != 131072 {
+		t.Fatalf("factors = %+v, want the context length and the tiebreak", factors)
+	}
+	tiebreak := factors[1]
+	if tiebreak.Name != FactorTiebreak || tiebreak.Score <= 0 || tiebreak.Score >= 1 {
+		t.Errorf("tiebreak = %+v, want a score squashed between 0 and 1", tiebreak)
+	}
+	if _, ok := factor(tiebreak.Factors, FactorParams); !ok {
+		t.Errorf("tiebreak factors = %+v, want the weighted scorer's", tiebreak.Factors)
+	}
+}
@@ -0,0 +1,206 @@
+package model
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/mosajjal/frugalai/internal/openrouter"
+)
+
+// Routing hint headers a client may send to steer the selection of a
+// single request
+const (
+	HeaderMinParams = "X-FrugalAI-Min-Params"
+	HeaderRequire   = "X-FrugalAI-Require"
+	HeaderPrefer    = "X-FrugalAI-Prefer"
+	HeaderExclude   = "X-FrugalAI-Exclude"
+
+	// HeaderConstraints reports the constraints applied to a request
+	HeaderConstraints = "X-FrugalAI-Constraints"
+)
+
+// Capabilities a request can require through HeaderRequire
+const (
+	CapabilityTools  = "tools"
+	CapabilityVision = "vision"
+)
+
+// Constraints narrows the models a single request may go to. They are set
+// through the hint headers and take the place of the configured filters, so
+// they select from every ranked free model rather than only the candidates.
+type Constraints struct {
+	// MinParams is the minimum parameter count, 0 for none
+	MinParams int
+
+	// Require lists capabilities the model must have
+	Require []string
+
+	// Prefer lists substrings of model IDs whose models are tried first,
+	// in order
+	Prefer []string
+
+	// Exclude lists model IDs or ID patterns (e.g. google/*) not to use
+	Exclude []string
+}
+
+// ParseHints parses the hint headers of a request. It returns nil when the
+// request has none.
+func ParseHints(h http.Header) (*Constraints, error) {
+	c := &Constraints{
+		Require: splitHeader(h, HeaderRequire),
+		Prefer:  splitHeader(h, HeaderPrefer),
+		Exclude: splitHeader(h, HeaderExclude),
+	}
+
+	if v := strings.TrimSpace(h.Get(HeaderMinParams)); v != "" {
+		n, ok := ParseParams(v)
+		if !ok {
+			return nil, fmt.Errorf("invalid %s %q: expected a parameter count such as 30000000000 or 30B", HeaderMinParams, v)
+		}
+		c.MinParams = n
+	}
+
+	for i, capability := range c.Require {
+		capability = strings.ToLower(capability)
+		if capability != CapabilityTools && capability != CapabilityVision {
+			return nil, fmt.Errorf("invalid %s %q: expected %s or %s", HeaderRequire, capability, CapabilityTools, CapabilityVision)
+		}
+		c.Require[i] = capability
+	}
+
+	for _, pattern := range c.Exclude {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid %s pattern %q: %v", HeaderExclude, pattern, err)
+		}
+	}
+
+	if c.MinParams == 0 && len(c.Require) == 0 && len(c.Prefer) == 0 && len(c.Exclude) == 0 {
+		return nil, nil
+	}
+	return c, nil
+}
+
+// Allows reports whether the model meets the constraints
+func (c *Constraints) Allows(m openrouter.Model) bool {
+	if c.MinParams > 0 && m.Params < c.MinParams {
+		return false
+	}
+	for _, capability := range c.Require {
+		switch capability {
+		case CapabilityTools:
+			if !m.SupportsTools() {
+				return false
+			}
+		case CapabilityVision:
+			if !m.AcceptsInput("image") {
+				return false
+			}
+		}
+	}
+	for _, pattern := range c.Exclude {
+		if ok, _ := path.Match(pattern, m.ID); ok || pattern == m.ID {
+			return false
+		}
+	}
+	return true
+}
+
+// Filter returns the models that meet the constraints, in order
+func (c *Constraints) Filter(models []openrouter.Model) []openrouter.Model {
+	var result []openrouter.Model
+	for _, m := range models {
+		if c.Allows(m) {
+			result = append(result, m)
+		}
+	}
+	return result
+}
+
+// String describes the constraints in the format of the
+// X-FrugalAI-Constraints header, e.g. "min-params=30000000000; require=tools"
+func (c *Constraints) String() string {
+	var parts []string
+	if c.MinParams > 0 {
+		parts = append(parts, fmt.Sprintf("min-params=%d", c.MinParams))
+	}
+	if len(c.Require) > 0 {
+		parts = append(parts, "require="+strings.Join(c.Require, ","))
+	}
+	if len(c.Prefer) > 0 {
+		parts = append(parts, "prefer="+strings.Join(c.Prefer, ","))
+	}
+	if len(c.Exclude) > 0 {
+		parts = append(parts, "exclude="+strings.Join(c.Exclude, ","))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// ConstraintError is returned when no model meets a request's constraints:
+// its routing hints, or a capability it cannot do without
+type ConstraintError struct {
+	Constraints *Constraints
+
+	// Capability is what no model offers, e.g. CapabilityVision, empty
+	// when the routing hints ruled the models out
+	Capability string
+}
+
+func (e *ConstraintError) Error() string {
+	if e.Capability != "" {
+		return fmt.Sprintf("no available model supports %s", e.Capability)
+	}
+	return fmt.Sprintf("no available model meets the routing constraints (%s)", e.Constraints)
+}
+
+// ParseParams parses a parameter count given as a number or with a K, M, B
+// or T suffix, e.g. "8B" or "567M". Counts too large for an int are
+// rejected.
+func ParseParams(s string) (int, bool) {
+	s = strings.TrimSpace(strings.ToUpper(s))
+	if s == "" {
+		return 0, false
+	}
+
+	multiplier := 1.0
+	switch s[len(s)-1] {
+	case 'K':
+		multiplier = 1e3
+	case 'M':
+		multiplier = 1e6
+	case 'B':
+		multiplier = 1e9
+	case 'T':
+		multiplier = 1e12
+	}
+	if multiplier != 1 {
+		s = s[:len(s)-1]
+	}
+
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	// Also rules out NaN and infinity, whose conversion is undefined
+	n *= multiplier
+	if !(n < math.MaxInt) {
+		return 0, false
+	}
+	return int(n), true
+}
+
+// splitHeader splits the comma-separated values of a header
+func splitHeader(h http.Header, name string) []string {
+	var result []string
+	for _, v := range h.Values(name) {
+		for _, part := range strings.Split(v, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				result = append(result, part)
+			}
+		}
+	}
+	return result
+}
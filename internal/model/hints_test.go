@@ -0,0 +1,132 @@
+package model
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/mosajjal/frugalai/internal/openrouter"
+)
+
+func TestParseHints(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string][]string
+		want    string
+		wantErr string
+	}{
+		{name: "no hints", headers: map[string][]string{}, want: ""},
+		{name: "blank hints", headers: map[string][]string{HeaderMinParams: {" "}, HeaderPrefer: {" , "}}, want: ""},
+		{
+			name: "all hints",
+			headers: map[string][]string{
+				HeaderMinParams: {"30B"},
+				HeaderRequire:   {"Tools, VISION"},
+				HeaderPrefer:    {"qwen", "llama"},
+				HeaderExclude:   {"google/*,openai/gpt-oss-20b:free"},
+			},
+			want: "min-params=30000000000; require=tools,vision; prefer=qwen,llama; exclude=google/*,openai/gpt-oss-20b:free",
+		},
+		{name: "plain parameter count", headers: map[string][]string{HeaderMinParams: {"7000000000"}}, want: "min-params=7000000000"},
+		{name: "invalid parameter count", headers: map[string][]string{HeaderMinParams: {"lots"}}, wantErr: HeaderMinParams},
+		{name: "negative parameter count", headers: map[string][]string{HeaderMinParams: {"-3B"}}, wantErr: HeaderMinParams},
+		{name: "unknown capability", headers: map[string][]string{HeaderRequire: {"tools,audio"}}, wantErr: `"audio"`},
+		{name: "invalid exclude pattern", headers: map[string][]string{HeaderExclude: {"google/[gemma"}}, wantErr: HeaderExclude},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			for name, values := range tt.headers {
+				for _, v := range values {
+					h.Add(name, v)
+				}
+			}
+
+			c, err := ParseHints(h)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("ParseHints() error = %v, want one naming %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseHints() error = %v", err)
+			}
+			if tt.want == "" {
+				if c != nil {
+					t.Errorf("ParseHints() = %v, want nil", c)
+				}
+				return
+			}
+			if c == nil || c.String() != tt.want {
+				t.Errorf("ParseHints() = %v, want %s", c, tt.want)
+			}
+		})
+	}
+}
+
+func TestConstraintsFilter(t *testing.T) {
+	small := testModel("meta-llama/llama-3.2-3b-instruct:free", 8192)
+	small.Params = 3_000_000_000
+	tools := testModel("qwen/qwen3-235b-tools:free", 8192)
+	tools.Params = 235_000_000_000
+	vision := testModel("google/gemma-3-27b-it:free", 8192, "image")
+	vision.Params = 27_000_000_000
+	models := []openrouter.Model{small, tools, vision}
+
+	tests := []struct {
+		name        string
+		constraints Constraints
+		want        []string
+	}{
+		{name: "none", want: []string{small.ID, tools.ID, vision.ID}},
+		{name: "min params", constraints: Constraints{MinParams: 20_000_000_000}, want: []string{tools.ID, vision.ID}},
+		{name: "tools", constraints: Constraints{Require: []string{CapabilityTools}}, want: []string{tools.ID}},
+		{name: "vision", constraints: Constraints{Require: []string{CapabilityVision}}, want: []string{vision.ID}},
+		{name: "exclude pattern", constraints: Constraints{Exclude: []string{"google/*"}}, want: []string{small.ID, tools.ID}},
+		{name: "exclude ID", constraints: Constraints{Exclude: []string{small.ID}}, want: []string{tools.ID, vision.ID}},
+		{name: "nothing left", constraints: Constraints{MinParams: 1e12}, want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, m := range tt.constraints.Filter(models) {
+				got = append(got, m.ID)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Filter() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseParams(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int
+		ok   bool
+	}{
+		{in: "8B", want: 8_000_000_000, ok: true},
+		{in: "3.2b", want: 3_200_000_000, ok: true},
+		{in: "567M", want: 567_000_000, ok: true},
+		{in: " 1T ", want: 1_000_000_000_000, ok: true},
+		{in: "4096", want: 4096, ok: true},
+		{in: "", ok: false},
+		{in: "B", ok: false},
+		{in: "30G", ok: false},
+		{in: "1e30B", ok: false},
+		{in: "9223372036854775807", ok: false},
+		{in: "Inf", ok: false},
+		{in: "NaN", ok: false},
+	}
+
+	for _, tt := range tests {
+		got, ok := ParseParams(tt.in)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("ParseParams(%q) = %d, %v, want %d, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
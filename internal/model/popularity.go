@@ -0,0 +1,72 @@
+package model
+
+import (
+	"math"
+
+	"github.com/mosajjal/frugalai/internal/openrouter"
+)
+
+// PopularitySource counts how much models are used, e.g. in public rankings
+// or through the proxy itself
+type PopularitySource interface {
+	Count(modelID string) (int, bool)
+}
+
+// SetUsage sets the source of the proxy's own usage counts, which are
+// combined with the models' popularity into their popularity score
+func (s *Selector) SetUsage(src PopularitySource) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.usage = src
+}
+
+// withPopularity returns a copy of the models with their popularity score
+// set. The popularity and the usage counts are each scaled logarithmically
+// against the most popular of the models and averaged, leaving out a signal
+// none of the models has. The score is kept between 0.1 and 1, so any known
+// popularity ranks above the 0.1 of an unknown one.
+func (s *Selector) withPopularity(models []openrouter.Model) []openrouter.Model {
+	s.mu.RLock()
+	usage := s.usage
+	s.mu.RUnlock()
+
+	usages := make([]int, len(models))
+	maxPopularity, maxUsage := 0, 0
+	for i, m := range models {
+		if usage != nil {
+			usages[i], _ = usage.Count(m.ID)
+		}
+		maxPopularity = max(maxPopularity, m.Popularity)
+		maxUsage = max(maxUsage, usages[i])
+	}
+
+	result := append([]openrouter.Model(nil), models...)
+	if maxPopularity == 0 && maxUsage == 0 {
+		return result
+	}
+	for i := range result {
+		sum, signals := 0.0, 0
+		if maxPopularity > 0 {
+			sum += logShare(result[i].Popularity, maxPopularity)
+			signals++
+		}
+		if maxUsage > 0 {
+			sum += logShare(usages[i], maxUsage)
+			signals++
+		}
+		if share := sum / float64(signals); share > 0 {
+			result[i].PopularityScore = 0.1 + 0.9*share
+		}
+	}
+	return result
+}
+
+// logShare returns n relative to most on a logarithmic scale, between 0
+// and 1
+func logShare(n, most int) float64 {
+	if n <= 0 {
+		return 0
+	}
+	return math.Log1p(float64(n)) / math.Log1p(float64(most))
+}
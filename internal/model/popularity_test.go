@@ -0,0 +1,115 @@
+package model
+
+import (
+	"math"
+	"testing"
+
+	"github.com/mosajjal/frugalai/internal/config"
+	"github.com/mosajjal/frugalai/internal/openrouter"
+)
+
+// countSource is a popularity source with fixed counts
+type countSource map[string]int
+
+func (c countSource) Count(modelID string) (int, bool) {
+	n, ok := c[modelID]
+	return n, ok
+}
+
+func TestWithPopularity(t *testing.T) {
+	share := func(n, most float64) float64 { return math.Log1p(n) / math.Log1p(most) }
+
+	tests := []struct {
+		name       string
+		popularity map[string]int
+		usage      countSource
+		want       map[string]float64
+	}{
+		{
+			name:       "no signals",
+			popularity: map[string]int{},
+			want:       map[string]float64{"a": 0, "b": 0, "c": 0},
+		},
+		{
+			name:       "snapshot only",
+			popularity: map[string]int{"a": 1000, "b": 10},
+			want:       map[string]float64{"a": 1, "b": 0.1 + 0.9*share(10, 1000), "c": 0},
+		},
+		{
+			name:       "usage only",
+			popularity: map[string]int{},
+			usage:      countSource{"c": 50, "b": 5},
+			want:       map[string]float64{"a": 0, "b": 0.1 + 0.9*share(5, 50), "c": 1},
+		},
+		{
+			name:       "both averaged",
+			popularity: map[string]int{"a": 1000, "b": 10},
+			usage:      countSource{"b": 100},
+			want: map[string]float64{
+				"a": 0.1 + 0.9*(1+0)/2,
+				"b": 0.1 + 0.9*(share(10, 1000)+1)/2,
+				"c": 0,
+			},
+		},
+		{
+			name:       "usage of models not listed",
+			popularity: map[string]int{"a": 1000},
+			usage:      countSource{"gone": 100},
+			want:       map[string]float64{"a": 1, "b": 0, "c": 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var models []openrouter.Model
+			for _, id := range []string{"a", "b", "c"} {
+				models = append(models, openrouter.Model{ID: id, Popularity: tt.popularity[id]})
+			}
+			s := NewSelector(staticSource(models), &config.Config{})
+			if tt.usage != nil {
+				s.SetUsage(tt.usage)
+			}
+
+			got, err := s.freeModels()
+			if err != nil {
+				t.Fatalf("freeModels() error = %v", err)
+			}
+			for _, m := range got {
+				if math.Abs(m.PopularityScore-tt.want[m.ID]) > 1e-9 {
+					t.Errorf("%s popularity score = %v, want %v", m.ID, m.PopularityScore, tt.want[m.ID])
+				}
+			}
+			if models[0].PopularityScore != 0 {
+				t.Error("the source's models were modified")
+			}
+		})
+	}
+}
+
+func TestUsageRanksModels(t *testing.T) {
+	models := staticSource{
+		{ID: "vendor/listed", Params: 8_000_000_000, Popularity: 1000},
+		{ID: "vendor/used", Params: 8_000_000_000, Popularity: 900},
+	}
+	s := NewSelector(models, &config.Config{})
+
+	if id, _ := s.GetBestModelID(); id != "vendor/listed" {
+		t.Fatalf("best = %s from the snapshot, want vendor/listed", id)
+	}
+
+	s.SetUsage(countSource{"vendor/used": 500})
+	if id, _ := s.GetBestModelID(); id != "vendor/used" {
+		t.Errorf("best = %s with usage, want vendor/used", id)
+	}
+}
+
+func TestEnrichPopularity(t *testing.T) {
+	e := NewEnricher(nil, nil)
+	e.SetPopularity(countSource{"vendor/a": 42})
+
+	models := e.Enrich([]openrouter.Model{{ID: "vendor/a"}, {ID: "vendor/b"}, {ID: "vendor/c", Popularity: 7}})
+	if models[0].Popularity != 42 || models[1].Popularity != 0 || models[2].Popularity != 7 {
+		t.Errorf("popularity = %d, %d, %d, want 42 from the source, 0 and the reported 7",
+			models[0].Popularity, models[1].Popularity, models[2].Popularity)
+	}
+}
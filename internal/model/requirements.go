@@ -0,0 +1,251 @@
+package model
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mosajjal/frugalai/internal/openrouter"
+	"github.com/mosajjal/frugalai/internal/tokenizer"
+)
+
+// Requirements describes the capabilities a request needs from a model
+type Requirements struct {
+	// Tools is set when the request offers tools to the model
+	Tools bool
+
+	// Vision is set when the request contains images
+	Vision bool
+
+	// Model is the model the client asked for, empty to let the proxy
+	// choose. It is used while it is usable and the request fits it.
+	Model string
+
+	// Policy orders the candidates when the proxy chooses
+	Policy Policy
+
+	// Prefer lists substrings of model IDs whose models are tried first,
+	// in order
+	Prefer []string
+
+	// Constraints are the request's routing hints, nil when it has none
+	Constraints *Constraints
+
+	// passthrough is the requested model when it is not a candidate but is
+	// known to a provider
+	passthrough *openrouter.Model
+
+	// request is the request whose prompt plus max_tokens has to fit into
+	// the model's context window. Footprints are cached per tokenizer family.
+	request    *openrouter.ChatRequest
+	footprints map[string]int
+}
+
+// RequirementsFor derives the requirements of a chat request
+func RequirementsFor(req *openrouter.ChatRequest) Requirements {
+	return Requirements{
+		Tools:      req.UsesTools(),
+		Vision:     req.HasImages(),
+		request:    req,
+		footprints: map[string]int{},
+	}
+}
+
+// Satisfied reports whether the model meets the requirements
+func (r Requirements) Satisfied(m openrouter.Model) bool {
+	if r.Tools && !m.SupportsTools() {
+		return false
+	}
+	if r.Vision && !m.AcceptsInput("image") {
+		return false
+	}
+	return r.FitsContext(m)
+}
+
+// Footprint estimates the tokens the request occupies in the model's context
+// window: the prompt in the model's tokenizer family plus max_tokens
+func (r Requirements) Footprint(m openrouter.Model) int {
+	if r.request == nil {
+		return 0
+	}
+	family := m.Architecture.Tokenizer
+	prompt, ok := r.footprints[family]
+	if !ok {
+		prompt = tokenizer.EstimateRequest(r.request, family)
+		if r.footprints != nil {
+			r.footprints[family] = prompt
+		}
+	}
+	return prompt + r.request.MaxTokens
+}
+
+// FitsContext reports whether the request fits into the model's context
+// window. Models without a known context length are assumed to fit.
+func (r Requirements) FitsContext(m openrouter.Model) bool {
+	return m.ContextLength <= 0 || r.Footprint(m) <= m.ContextLength
+}
+
+// WithConstraints returns the requirements with the routing hints c, whose
+// preferences come before those of the requested model's alias
+func (r Requirements) WithConstraints(c *Constraints) Requirements {
+	if c == nil {
+		return r
+	}
+	r.Constraints = c
+	r.Prefer = append(append([]string(nil), c.Prefer...), r.Prefer...)
+	return r
+}
+
+// Requested returns the model the client asked for when it is one of
+// models, or the passthrough model, and is usable, fits the request and
+// meets its constraints. Capability preferences are not checked, as the
+// client chose the model.
+func (r Requirements) Requested(usable func(id string) bool, models ...[]openrouter.Model) *openrouter.Model {
+	if r.Model == "" {
+		return nil
+	}
+
+	requested := r.passthrough
+	for _, list := range models {
+		for i := range list {
+			if list[i].ID == r.Model {
+				requested = &list[i]
+			}
+		}
+	}
+
+	if requested == nil || !usable(requested.ID) || !r.FitsContext(*requested) {
+		return nil
+	}
+	if r.Constraints != nil && !r.Constraints.Allows(*requested) {
+		return nil
+	}
+	return requested
+}
+
+// Pick chooses the model for a request. The current model is kept when it
+// meets the requirements, otherwise the first usable candidate that does is
+// returned. Tool support is a preference: when no candidate has it, the best
+// candidate the request fits into is used instead. Image input and the
+// context window are hard limits: a ConstraintError is returned when no
+// candidate accepts images, and a ContextOverflowError when the request fits
+// no candidate. Pick returns nil when there are no candidates at all.
+func (r Requirements) Pick(current *openrouter.Model, candidates []openrouter.Model, usable func(id string) bool) (*openrouter.Model, error) {
+	// A policy or preference overrides the current model
+	if (r.Policy != "" && r.Policy != PolicyAuto) || len(r.Prefer) > 0 {
+		candidates = r.rank(candidates)
+		current = nil
+	}
+
+	if current != nil && r.Satisfied(*current) {
+		return current, nil
+	}
+	for i := range candidates {
+		if usable(candidates[i].ID) && r.Satisfied(candidates[i]) {
+			return &candidates[i], nil
+		}
+	}
+
+	if len(candidates) == 0 {
+		return current, nil
+	}
+
+	// A text-only model cannot see the images, so only models that accept
+	// them are left
+	if r.Vision {
+		vision := []openrouter.Model{}
+		for _, c := range candidates {
+			if c.AcceptsInput("image") {
+				vision = append(vision, c)
+			}
+		}
+		if len(vision) == 0 {
+			return nil, &ConstraintError{Capability: CapabilityVision}
+		}
+		if current != nil && !current.AcceptsInput("image") {
+			current = nil
+		}
+		candidates = vision
+	}
+
+	// Relax the tool preference, usable candidates first
+	if current != nil && usable(current.ID) && r.FitsContext(*current) {
+		return current, nil
+	}
+	for i := range candidates {
+		if usable(candidates[i].ID) && r.FitsContext(candidates[i]) {
+			return &candidates[i], nil
+		}
+	}
+	for i := range candidates {
+		if r.FitsContext(candidates[i]) {
+			return &candidates[i], nil
+		}
+	}
+
+	// Report the overflow against the largest context window available
+	largest := candidates[0]
+	for _, c := range candidates[1:] {
+		if c.ContextLength > largest.ContextLength {
+			largest = c
+		}
+	}
+	footprint := r.Footprint(largest)
+	return nil, &ContextOverflowError{
+		Model:            largest.ID,
+		MaxContext:       largest.ContextLength,
+		PromptTokens:     footprint - r.request.MaxTokens,
+		CompletionTokens: r.request.MaxTokens,
+	}
+}
+
+// rank returns a copy of the candidates ordered by preference first and
+// policy second. Otherwise the candidates keep their order.
+func (r Requirements) rank(candidates []openrouter.Model) []openrouter.Model {
+	ranked := append([]openrouter.Model(nil), candidates...)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		a, b := ranked[i], ranked[j]
+		if pa, pb := r.preference(a), r.preference(b); pa != pb {
+			return pa < pb
+		}
+		switch r.Policy {
+		case PolicyFast:
+			// Mixture-of-experts models are as fast as their active
+			// parameters. Unknown sizes go last.
+			pa, pb := a.ComputeParams(), b.ComputeParams()
+			return pa > 0 && (pb == 0 || pa < pb)
+		case PolicyLarge:
+			return a.Params > b.Params
+		case PolicyLongContext:
+			return a.ContextLength > b.ContextLength
+		}
+		return false
+	})
+	return ranked
+}
+
+// preference returns the position of the first Prefer entry the model's ID
+// contains, or len(Prefer) when there is none
+func (r Requirements) preference(m openrouter.Model) int {
+	id := strings.ToLower(m.ID)
+	for i, p := range r.Prefer {
+		if strings.Contains(id, strings.ToLower(p)) {
+			return i
+		}
+	}
+	return len(r.Prefer)
+}
+
+// ContextOverflowError is returned when a request does not fit into the
+// context window of any candidate model
+type ContextOverflowError struct {
+	Model            string
+	MaxContext       int
+	PromptTokens     int
+	CompletionTokens int
+}
+
+func (e *ContextOverflowError) Error() string {
+	return fmt.Sprintf("This model's maximum context length is %d tokens. However, you requested %d tokens (%d in the messages, %d in the completion). Please reduce the length of the messages or completion.",
+		e.MaxContext, e.PromptTokens+e.CompletionTokens, e.PromptTokens, e.CompletionTokens)
+}
@@ -0,0 +1,170 @@
+package model
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/mosajjal/frugalai/internal/openrouter"
+)
+
+// testModel returns a model with a context window and input modalities.
+// Models whose ID contains "tools" support tool calling.
+func testModel(id string, context int, inputs ...string) openrouter.Model {
+	m := openrouter.Model{ID: id, ContextLength: context}
+	m.Architecture.InputModalities = append([]string{"text"}, inputs...)
+	if strings.Contains(id, "tools") {
+		m.SupportedParameters = []string{"tools", "tool_choice"}
+	}
+	return m
+}
+
+// textRequest returns a request with a short prompt
+func textRequest() *openrouter.ChatRequest {
+	return &openrouter.ChatRequest{
+		Messages: []openrouter.ChatMessage{{Role: "user", Content: openrouter.TextContent("Hi")}},
+	}
+}
+
+// imageRequest returns a request with an image
+func imageRequest() *openrouter.ChatRequest {
+	return &openrouter.ChatRequest{
+		Messages: []openrouter.ChatMessage{{Role: "user", Content: openrouter.PartsContent([]openrouter.ContentPart{
+			{Type: "text", Text: "What is this?"},
+			{Type: "image_url", ImageURL: &openrouter.ImageURL{URL: "https://example.com/cat.jpg"}},
+		})}},
+	}
+}
+
+// toolRequest returns a request that offers a tool
+func toolRequest() *openrouter.ChatRequest {
+	req := textRequest()
+	req.Tools = []openrouter.Tool{{Type: "function", Function: openrouter.FunctionDefinition{Name: "get_weather"}}}
+	return req
+}
+
+func allUsable(string) bool { return true }
+
+func TestRequirementsPick(t *testing.T) {
+	text := testModel("text", 8192)
+	textTools := testModel("text-tools", 8192)
+	vision := testModel("vision", 8192, "image")
+	visionTools := testModel("vision-tools", 8192, "image")
+	small := testModel("small", 2)
+
+	tests := []struct {
+		name       string
+		req        *openrouter.ChatRequest
+		current    *openrouter.Model
+		candidates []openrouter.Model
+		usable     func(string) bool
+		want       string
+		wantErr    interface{}
+	}{
+		{
+			name:       "keeps the current model",
+			req:        textRequest(),
+			current:    &textTools,
+			candidates: []openrouter.Model{text, textTools},
+			want:       "text-tools",
+		},
+		{
+			name:       "skips unusable candidates",
+			req:        textRequest(),
+			candidates: []openrouter.Model{text, textTools},
+			usable:     func(id string) bool { return id != "text" },
+			want:       "text-tools",
+		},
+		{
+			name:       "images go to a vision model",
+			req:        imageRequest(),
+			current:    &text,
+			candidates: []openrouter.Model{text, vision},
+			want:       "vision",
+		},
+		{
+			name:       "images without a vision model are rejected",
+			req:        imageRequest(),
+			current:    &text,
+			candidates: []openrouter.Model{text, textTools},
+			wantErr:    &ConstraintError{},
+		},
+		{
+			name:       "tools prefer a tool model",
+			req:        toolRequest(),
+			candidates: []openrouter.Model{text, textTools},
+			want:       "text-tools",
+		},
+		{
+			name:       "tools fall back to a model without them",
+			req:        toolRequest(),
+			current:    &text,
+			candidates: []openrouter.Model{text, vision},
+			want:       "text",
+		},
+		{
+			name:       "tool_choice none does not ask for a tool model",
+			req:        func() *openrouter.ChatRequest { r := toolRequest(); r.ToolChoice = "none"; return r }(),
+			current:    &text,
+			candidates: []openrouter.Model{textTools, text},
+			want:       "text",
+		},
+		{
+			name:       "images and tools relax tools but not images",
+			req:        func() *openrouter.ChatRequest { r := imageRequest(); r.Tools = toolRequest().Tools; return r }(),
+			candidates: []openrouter.Model{textTools, vision},
+			want:       "vision",
+		},
+		{
+			name:       "images and tools together",
+			req:        func() *openrouter.ChatRequest { r := imageRequest(); r.Tools = toolRequest().Tools; return r }(),
+			candidates: []openrouter.Model{textTools, vision, visionTools},
+			want:       "vision-tools",
+		},
+		{
+			name:       "a request that fits no context overflows",
+			req:        textRequest(),
+			candidates: []openrouter.Model{small},
+			wantErr:    &ContextOverflowError{},
+		},
+		{
+			name:       "skips candidates the request does not fit",
+			req:        textRequest(),
+			current:    &small,
+			candidates: []openrouter.Model{small, text},
+			want:       "text",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			usable := tt.usable
+			if usable == nil {
+				usable = allUsable
+			}
+			got, err := RequirementsFor(tt.req).Pick(tt.current, tt.candidates, usable)
+
+			switch want := tt.wantErr.(type) {
+			case *ConstraintError:
+				var constraint *ConstraintError
+				if !errors.As(err, &constraint) || constraint.Capability != CapabilityVision {
+					t.Fatalf("error = %v, want a vision ConstraintError", err)
+				}
+			case *ContextOverflowError:
+				var overflow *ContextOverflowError
+				if !errors.As(err, &overflow) {
+					t.Fatalf("error = %v, want a ContextOverflowError", err)
+				}
+			case nil:
+				if err != nil {
+					t.Fatalf("error = %v", err)
+				}
+				if got == nil || got.ID != tt.want {
+					t.Errorf("picked %v, want %s", got, tt.want)
+				}
+			default:
+				t.Fatalf("unexpected wanted error %T", want)
+			}
+		})
+	}
+}
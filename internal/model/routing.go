@@ -0,0 +1,150 @@
+package model
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/mosajjal/frugalai/internal/config"
+)
+
+// Policy orders the candidates the proxy chooses from
+type Policy string
+
+const (
+	// PolicyAuto keeps the current model while it can take the request
+	PolicyAuto Policy = "auto"
+
+	// PolicyBest uses the highest ranked candidate
+	PolicyBest Policy = "best"
+
+	// PolicyFast uses the candidate with the fewest active parameters
+	PolicyFast Policy = "fast"
+
+	// PolicyLarge uses the candidate with the most parameters
+	PolicyLarge Policy = "large"
+
+	// PolicyLongContext uses the candidate with the longest context
+	PolicyLongContext Policy = "long-context"
+)
+
+// preferPrefix starts an alias target that prefers models by ID substring,
+// e.g. "prefer:coder|devstral"
+const preferPrefix = "prefer:"
+
+// ParsePolicy returns the policy with the given name
+func ParsePolicy(name string) (Policy, bool) {
+	switch p := Policy(name); p {
+	case PolicyAuto, PolicyBest, PolicyFast, PolicyLarge, PolicyLongContext:
+		return p, true
+	}
+	return "", false
+}
+
+// Router maps the model a client asks for to routing requirements. Names
+// in the auto set, and any name in auto mode that is not a candidate, let
+// the proxy choose. Aliases map a name to a policy, a preference or a model
+// ID. In passthrough mode any model a provider knows is honored.
+type Router struct {
+	selector *Selector
+	mode     string
+	auto     map[string]bool
+	aliases  map[string]string
+}
+
+// NewRouter creates a router from the routing settings of cfg. Alias
+// targets are validated.
+func NewRouter(selector *Selector, cfg *config.Config) (*Router, error) {
+	mode := cfg.RoutingMode
+	if mode == "" {
+		mode = config.RoutingAuto
+	}
+	if mode != config.RoutingAuto && mode != config.RoutingPassthrough {
+		return nil, fmt.Errorf("unknown routing mode %q", cfg.RoutingMode)
+	}
+
+	r := &Router{
+		selector: selector,
+		mode:     mode,
+		auto:     map[string]bool{},
+		aliases:  map[string]string{},
+	}
+	for _, name := range cfg.AutoModels {
+		r.auto[name] = true
+	}
+	for name, target := range cfg.Aliases {
+		if target == "" {
+			return nil, fmt.Errorf("alias %q has no target", name)
+		}
+		if prefer, ok := strings.CutPrefix(target, preferPrefix); ok && len(splitPrefer(prefer)) == 0 {
+			return nil, fmt.Errorf("alias %q prefers nothing", name)
+		}
+		r.aliases[name] = target
+	}
+	return r, nil
+}
+
+// Route adds the routing of a request for the requested model to reqs
+func (r *Router) Route(requested string, reqs Requirements) Requirements {
+	name := requested
+	target, aliased := r.aliases[name]
+	if aliased {
+		name = target
+	}
+
+	if name == "" || r.auto[name] {
+		return reqs
+	}
+	if policy, ok := ParsePolicy(name); ok {
+		reqs.Policy = policy
+		return reqs
+	}
+	if prefer, ok := strings.CutPrefix(name, preferPrefix); ok {
+		reqs.Prefer = splitPrefer(prefer)
+		return reqs
+	}
+
+	// An exact model ID. In auto mode only candidates are honored, unless
+	// an alias names the model.
+	reqs.Model = name
+	if aliased || r.mode == config.RoutingPassthrough {
+		m, err := r.selector.SelectModelByID(name)
+		if err != nil {
+			log.Printf("[DEBUG] Requested model %s is not available: %v", name, err)
+			return reqs
+		}
+		if reason := r.selector.ruleReason(*m); reason != "" {
+			log.Printf("[DEBUG] Requested model %s is %s", name, reason)
+			return reqs
+		}
+		reqs.passthrough = m
+	}
+	return reqs
+}
+
+// Names returns the auto names and aliases clients may ask for, sorted
+func (r *Router) Names() []string {
+	names := make([]string, 0, len(r.auto)+len(r.aliases))
+	for name := range r.auto {
+		names = append(names, name)
+	}
+	for name := range r.aliases {
+		if !r.auto[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// splitPrefer splits the substrings of a preference at '|' or ','
+func splitPrefer(s string) []string {
+	var result []string
+	for _, part := range strings.FieldsFunc(s, func(c rune) bool { return c == '|' || c == ',' }) {
+		if part = strings.TrimSpace(part); part != "" {
+			result = append(result, part)
+		}
+	}
+	return result
+}
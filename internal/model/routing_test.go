@@ -0,0 +1,128 @@
+package model
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/mosajjal/frugalai/internal/config"
+	"github.com/mosajjal/frugalai/internal/openrouter"
+)
+
+// staticSource is a model source listing fixed models, all of them free
+type staticSource []openrouter.Model
+
+func (s staticSource) GetModels() ([]openrouter.Model, error)     { return s, nil }
+func (s staticSource) GetFreeModels() ([]openrouter.Model, error) { return s, nil }
+
+// testRouter returns a router over a provider that knows vendor/known and
+// vendor/denied, the latter denied by a rule
+func testRouter(t *testing.T, mode string) *Router {
+	t.Helper()
+	selector := NewSelector(staticSource{testModel("vendor/known", 8192), testModel("vendor/denied", 8192)}, &config.Config{})
+	rules, err := NewRules(nil, []string{"vendor/denied"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	selector.SetRules(rules)
+
+	r, err := NewRouter(selector, &config.Config{
+		RoutingMode: mode,
+		AutoModels:  []string{"frugal", "gpt-4o"},
+		Aliases: map[string]string{
+			"cheap":   "fast",
+			"coder":   "prefer:coder| devstral,",
+			"pinned":  "vendor/known",
+			"banned":  "vendor/denied",
+			"default": "frugal",
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewRouter() error = %v", err)
+	}
+	return r
+}
+
+func TestRoute(t *testing.T) {
+	tests := []struct {
+		name        string
+		mode        string
+		requested   string
+		policy      Policy
+		prefer      []string
+		model       string
+		passthrough bool
+	}{
+		{name: "no model", requested: ""},
+		{name: "auto name", requested: "frugal"},
+		{name: "policy", requested: "long-context", policy: PolicyLongContext},
+		{name: "policy alias", requested: "cheap", policy: PolicyFast},
+		{name: "alias to an auto name", requested: "default"},
+		{name: "second auto name", requested: "gpt-4o"},
+		{name: "prefer alias", requested: "coder", prefer: []string{"coder", "devstral"}},
+		{name: "model ID in auto mode", requested: "vendor/known", model: "vendor/known"},
+		{name: "unknown model in auto mode", requested: "claude-3-opus", model: "claude-3-opus"},
+		{name: "alias to a model ID", requested: "pinned", model: "vendor/known", passthrough: true},
+		{name: "alias to a denied model", requested: "banned", model: "vendor/denied"},
+		{name: "passthrough", mode: config.RoutingPassthrough, requested: "vendor/known", model: "vendor/known", passthrough: true},
+		{name: "passthrough of an unknown model", mode: config.RoutingPassthrough, requested: "vendor/missing", model: "vendor/missing"},
+		{name: "passthrough of a denied model", mode: config.RoutingPassthrough, requested: "vendor/denied", model: "vendor/denied"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reqs := testRouter(t, tt.mode).Route(tt.requested, RequirementsFor(textRequest()))
+			if reqs.Policy != tt.policy || !slices.Equal(reqs.Prefer, tt.prefer) || reqs.Model != tt.model {
+				t.Errorf("Route(%q) = policy %q, prefer %q, model %q, want %q, %q, %q",
+					tt.requested, reqs.Policy, reqs.Prefer, reqs.Model, tt.policy, tt.prefer, tt.model)
+			}
+			if got := reqs.passthrough != nil; got != tt.passthrough {
+				t.Errorf("Route(%q) passes through %v, want %v", tt.requested, got, tt.passthrough)
+			}
+
+			// Only a passed through model is used when it is not a candidate
+			requested := reqs.Requested(allUsable)
+			if got := requested != nil; got != tt.passthrough {
+				t.Errorf("Requested() = %v, want a model %v", requested, tt.passthrough)
+			}
+		})
+	}
+}
+
+func TestRequestedPrefersCandidates(t *testing.T) {
+	reqs := testRouter(t, config.RoutingPassthrough).Route("vendor/known", RequirementsFor(textRequest()))
+
+	candidate := testModel("vendor/known", 4096)
+	got := reqs.Requested(allUsable, []openrouter.Model{candidate})
+	if got == nil || got.ContextLength != 4096 {
+		t.Errorf("Requested() = %v, want the candidate", got)
+	}
+	if got := reqs.Requested(func(string) bool { return false }); got != nil {
+		t.Errorf("Requested() = %v for an unusable model, want nil", got)
+	}
+}
+
+func TestNewRouterErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.Config
+	}{
+		{name: "unknown mode", cfg: config.Config{RoutingMode: "strict"}},
+		{name: "alias without a target", cfg: config.Config{Aliases: map[string]string{"x": ""}}},
+		{name: "alias preferring nothing", cfg: config.Config{Aliases: map[string]string{"x": "prefer: |,"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewRouter(nil, &tt.cfg); err == nil {
+				t.Error("NewRouter() accepted an invalid configuration")
+			}
+		})
+	}
+}
+
+func TestRouterNames(t *testing.T) {
+	want := []string{"banned", "cheap", "coder", "default", "frugal", "gpt-4o", "pinned"}
+	if got := testRouter(t, "").Names(); !slices.Equal(got, want) {
+		t.Errorf("Names() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,177 @@
+package model
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/mosajjal/frugalai/internal/openrouter"
+)
+
+// Fields a rule can match
+const (
+	RuleFieldID        = "id"
+	RuleFieldName      = "name"
+	RuleFieldProvider  = "provider"
+	RuleFieldTokenizer = "tokenizer"
+)
+
+// Rule matches models by a field of their listing. It is written as
+// [field:]pattern, where field is id (default), name, provider or tokenizer
+// and pattern is a glob, or a regular expression between slashes, e.g.
+// "provider:mistralai", "qwen/*" or "/:online$/". A glob's * also matches
+// slashes, so "*:online" matches every :online variant.
+type Rule struct {
+	Field   string
+	Pattern string
+
+	text string
+	re   *regexp.Regexp
+}
+
+// ParseRule parses a rule
+func ParseRule(s string) (Rule, error) {
+	r := Rule{Field: RuleFieldID, Pattern: strings.TrimSpace(s), text: strings.TrimSpace(s)}
+	if field, pattern, ok := strings.Cut(r.Pattern, ":"); ok {
+		switch field {
+		case RuleFieldID, RuleFieldName, RuleFieldProvider, RuleFieldTokenizer:
+			r.Field, r.Pattern = field, pattern
+		}
+	}
+	if r.Pattern == "" {
+		return Rule{}, fmt.Errorf("rule %q has no pattern", s)
+	}
+
+	if len(r.Pattern) > 1 && strings.HasPrefix(r.Pattern, "/") && strings.HasSuffix(r.Pattern, "/") {
+		re, err := regexp.Compile(r.Pattern[1 : len(r.Pattern)-1])
+		if err != nil {
+			return Rule{}, fmt.Errorf("rule %q has an invalid regular expression: %v", s, err)
+		}
+		r.re = re
+		return r, nil
+	}
+
+	re, err := globRegexp(r.Pattern)
+	if err != nil {
+		return Rule{}, fmt.Errorf("rule %q has an invalid pattern: %v", s, err)
+	}
+	r.re = re
+	return r, nil
+}
+
+// globRegexp converts a glob to an anchored regular expression. * matches
+// any run of characters, / included, ? any single character and [...] a
+// character class, negated with a leading ! or ^. A backslash escapes the
+// character after it.
+func globRegexp(glob string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		case '\\':
+			if i+1 == len(glob) {
+				return nil, fmt.Errorf("trailing backslash")
+			}
+			i++
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated character class")
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += end + 1
+		default:
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+// Matches reports whether the rule matches the model. The provider field
+// matches both the provider serving the model and the vendor prefix of its
+// ID, e.g. meta-llama for meta-llama/llama-3.3-70b-instruct:free.
+func (r Rule) Matches(m openrouter.Model) bool {
+	switch r.Field {
+	case RuleFieldName:
+		return r.match(m.Name)
+	case RuleFieldTokenizer:
+		return r.match(m.Architecture.Tokenizer)
+	case RuleFieldProvider:
+		id := m.ID
+		if m.Provider != "" {
+			id = strings.TrimPrefix(id, m.Provider+":")
+		}
+		vendor, _, ok := strings.Cut(id, "/")
+		return (m.Provider != "" && r.match(m.Provider)) || (ok && r.match(vendor))
+	default:
+		return r.match(m.ID)
+	}
+}
+
+// match matches a single value against the pattern
+func (r Rule) match(value string) bool {
+	return r.re.MatchString(value)
+}
+
+// String returns the rule as it was written
+func (r Rule) String() string {
+	return r.text
+}
+
+// Rules decides which models may be used. A model matching any deny rule
+// is rejected; when there are allow rules, a model must match one of them.
+type Rules struct {
+	Allow []Rule
+	Deny  []Rule
+}
+
+// NewRules parses allow and deny rules
+func NewRules(allow, deny []string) (*Rules, error) {
+	rules := &Rules{}
+	for _, s := range allow {
+		r, err := ParseRule(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allow rule: %w", err)
+		}
+		rules.Allow = append(rules.Allow, r)
+	}
+	for _, s := range deny {
+		r, err := ParseRule(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid deny rule: %w", err)
+		}
+		rules.Deny = append(rules.Deny, r)
+	}
+	return rules, nil
+}
+
+// Check returns why the rules reject the model, or "" when it may be used
+func (rs *Rules) Check(m openrouter.Model) string {
+	if rs == nil {
+		return ""
+	}
+	for _, r := range rs.Deny {
+		if r.Matches(m) {
+			return fmt.Sprintf("denied by rule %q", r)
+		}
+	}
+	if len(rs.Allow) == 0 {
+		return ""
+	}
+	for _, r := range rs.Allow {
+		if r.Matches(m) {
+			return ""
+		}
+	}
+	return "not matched by any allow rule"
+}
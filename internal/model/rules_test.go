@@ -0,0 +1,108 @@
+package model
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mosajjal/frugalai/internal/openrouter"
+)
+
+func TestRuleMatches(t *testing.T) {
+	llama := openrouter.Model{ID: "meta-llama/llama-3.3-70b-instruct:free", Name: "Meta: Llama 3.3 70B Instruct (free)"}
+	llama.Architecture.Tokenizer = "Llama3"
+	online := openrouter.Model{ID: "openai/gpt-4o-mini:online"}
+	local := openrouter.Model{ID: "ollama:qwen3:8b", Provider: "ollama"}
+
+	tests := []struct {
+		rule  string
+		model openrouter.Model
+		want  bool
+	}{
+		{rule: "meta-llama/*", model: llama, want: true},
+		{rule: "meta-llama/*", model: online, want: false},
+		{rule: "*:online", model: online, want: true},
+		{rule: "*:online", model: llama, want: false},
+		{rule: "*/gpt-4o-*", model: online, want: true},
+		{rule: "*llama-3.?-70b*", model: llama, want: true},
+		{rule: "[!m]*", model: llama, want: false},
+		{rule: "[!m]*", model: online, want: true},
+		{rule: "meta-llama/llama-3.3-70b-instruct:free", model: llama, want: true},
+		{rule: "meta-llama/llama-3x3-70b-instruct:free", model: llama, want: false},
+		{rule: "/:online$/", model: online, want: true},
+		{rule: "id:/^meta-/", model: llama, want: true},
+		{rule: "name:*(free)", model: llama, want: true},
+		{rule: "name:/(?i)LLAMA/", model: llama, want: true},
+		{rule: "tokenizer:Llama3", model: llama, want: true},
+		{rule: "provider:meta-llama", model: llama, want: true},
+		{rule: "provider:meta-*", model: llama, want: true},
+		{rule: "provider:openai", model: llama, want: false},
+		{rule: "provider:ollama", model: local, want: true},
+		{rule: "provider:qwen3", model: local, want: false},
+	}
+
+	for _, tt := range tests {
+		r, err := ParseRule(tt.rule)
+		if err != nil {
+			t.Fatalf("ParseRule(%q) error = %v", tt.rule, err)
+		}
+		if got := r.Matches(tt.model); got != tt.want {
+			t.Errorf("%q matches %s = %v, want %v", tt.rule, tt.model.ID, got, tt.want)
+		}
+	}
+}
+
+func TestParseRuleErrors(t *testing.T) {
+	for _, rule := range []string{"", " ", "id:", "google/[gemma", "/(unclosed/", `trailing\`} {
+		if _, err := ParseRule(rule); err == nil {
+			t.Errorf("ParseRule(%q) succeeded, want an error", rule)
+		}
+	}
+
+	if r, err := ParseRule("https://example.com/*"); err != nil || r.Field != RuleFieldID {
+		t.Errorf("ParseRule() = %+v, %v, want an ID rule for an unknown field", r, err)
+	}
+}
+
+func TestRulesCheck(t *testing.T) {
+	llama := openrouter.Model{ID: "meta-llama/llama-3.3-70b-instruct:free"}
+	llamaOnline := openrouter.Model{ID: "meta-llama/llama-3.3-70b-instruct:online"}
+	qwen := openrouter.Model{ID: "qwen/qwen3-235b-a22b:free"}
+	gemma := openrouter.Model{ID: "google/gemma-3-27b-it:free"}
+
+	tests := []struct {
+		name  string
+		allow []string
+		deny  []string
+		model openrouter.Model
+		want  string
+	}{
+		{name: "no rules", model: gemma, want: ""},
+		{name: "allowed", allow: []string{"meta-llama/*", "qwen/*"}, model: qwen, want: ""},
+		{name: "not allowed", allow: []string{"meta-llama/*", "qwen/*"}, model: gemma, want: "not matched by any allow rule"},
+		{name: "denied", deny: []string{"google/*"}, model: gemma, want: `denied by rule "google/*"`},
+		{name: "not denied", deny: []string{"google/*"}, model: llama, want: ""},
+		{name: "deny wins over allow", allow: []string{"meta-llama/*"}, deny: []string{"*:online"}, model: llamaOnline, want: `denied by rule "*:online"`},
+		{name: "allowed and not denied", allow: []string{"meta-llama/*"}, deny: []string{"*:online"}, model: llama, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := NewRules(tt.allow, tt.deny)
+			if err != nil {
+				t.Fatalf("NewRules() error = %v", err)
+			}
+			if got := rules.Check(tt.model); got != tt.want {
+				t.Errorf("Check(%s) = %q, want %q", tt.model.ID, got, tt.want)
+			}
+		})
+	}
+
+	var none *Rules
+	if got := none.Check(gemma); got != "" {
+		t.Errorf("nil rules Check() = %q, want every model allowed", got)
+	}
+
+	if _, err := NewRules(nil, []string{"google/[gemma"}); err == nil || !strings.Contains(err.Error(), "deny") {
+		t.Errorf("NewRules() error = %v, want an invalid deny rule", err)
+	}
+}
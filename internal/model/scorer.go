@@ -0,0 +1,343 @@
+package model
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/mosajjal/frugalai/internal/config"
+	"github.com/mosajjal/frugalai/internal/openrouter"
+)
+
+// Scorer rates a model. The selector ranks models by descending score.
+type Scorer interface {
+	Score(m openrouter.Model) float64
+}
+
+// Scoring strategies
+const (
+	// ScorerDefault weighs popularity, size, context length and
+	// architecture with the default weights and known model family bonuses
+	ScorerDefault = "default"
+
+	// ScorerWeighted is the default formula with configured weights and
+	// vendor bonuses
+	ScorerWeighted = "weighted"
+
+	// ScorerContext ranks the longest context first
+	ScorerContext = "context"
+
+	// ScorerLatency ranks the lowest observed latency first
+	ScorerLatency = "latency"
+)
+
+// Weights weighs the factors of a WeightedScorer. Every factor is
+// normalized to 0-1 before it is weighed.
+type Weights struct {
+	Popularity   float64
+	Params       float64
+	Context      float64
+	Architecture float64
+}
+
+// DefaultWeights are the weights of the default scorer
+var DefaultWeights = Weights{
+	Popularity:   0.3,
+	Params:       0.4,
+	Context:      0.2,
+	Architecture: 0.1,
+}
+
+// WeightedScorer scores a model as the weighted sum of its popularity,
+// parameter count, context length and whether its architecture is
+// preferred, plus a bonus for its vendor
+type WeightedScorer struct {
+	Weights Weights
+
+	// VendorBonuses adds a bonus to models whose ID or name contains the
+	// key, case-insensitively. Without bonuses the built-in bonuses for
+	// known model families are used. Either, and the penalty for tiny
+	// models, is replaced by the bonus of the model's quality tier, when it
+	// has one.
+	VendorBonuses map[string]float64
+
+	// PreferredArchitectures earn the architecture weight when the model's
+	// modality or tokenizer contains one of them
+	PreferredArchitectures []string
+}
+
+// Score calculates the score of a model as the sum of its factors
+func (w *WeightedScorer) Score(model openrouter.Model) float64 {
+	score := 0.0
+	for _, f := range w.Explain(model) {
+		score += f.Score
+	}
+	return score
+}
+
+// Explain breaks the score of a model down into its factors
+func (w *WeightedScorer) Explain(model openrouter.Model) []Factor {
+	// Popularity score (normalized to 0-1), combined from the popularity
+	// sources when the selector set it
+	popularity := model.PopularityScore
+	if popularity == 0 {
+		popularity = normalizePopularity(model.Popularity)
+	}
+
+	// Preferred architecture bonus
+	architecture := 0.0
+	if isPreferredArchitecture(w.PreferredArchitectures, model.Architecture.Modality, model.Architecture.Tokenizer) {
+		architecture = 1
+	}
+
+	factors := []Factor{
+		weighted(FactorPopularity, popularity, w.Weights.Popularity),
+		weighted(FactorParams, normalizeParams(model.Params), w.Weights.Params),
+		weighted(FactorContext, normalizeContextLength(model.ContextLength), w.Weights.Context),
+		weighted(FactorArchitecture, architecture, w.Weights.Architecture),
+	}
+
+	// Quality bonus based on the model's tier, its vendor or known good
+	// model names, and a penalty for tiny models
+	if bonus, ok := tierBonuses[model.QualityTier]; ok {
+		return append(factors, unweighted(FactorTierBonus, bonus))
+	}
+	bonus := getModelQualityBonus(model.Name, model.ID)
+	if w.VendorBonuses != nil {
+		bonus = vendorBonus(w.VendorBonuses, model.Name, model.ID)
+	}
+	return append(factors,
+		unweighted(FactorVendorBonus, bonus),
+		unweighted(FactorPenalty, weakModelPenalty(model.ID)))
+}
+
+// ContextScorer ranks models by context length, breaking ties with another
+// scorer
+type ContextScorer struct {
+	Tiebreak Scorer
+}
+
+// Score returns the context length, plus the tiebreak score squashed into
+// the 0-1 range so it cannot outweigh a single token of context
+func (c *ContextScorer) Score(model openrouter.Model) float64 {
+	return float64(model.ContextLength) + squash(c.Tiebreak.Score(model))
+}
+
+// Explain returns the context length and the tiebreak, broken down in turn
+func (c *ContextScorer) Explain(model openrouter.Model) []Factor {
+	return []Factor{
+		unweighted(FactorContext, float64(model.ContextLength)),
+		squashed(FactorTiebreak, c.Tiebreak, model),
+	}
+}
+
+// LatencySource returns the observed latency of a model, and false when
+// none was observed yet
+type LatencySource func(modelID string) (time.Duration, bool)
+
+// LatencyScorer ranks models whose latency was observed first, fastest
+// first. The others follow in the order of a fallback scorer.
+type LatencyScorer struct {
+	Latency  LatencySource
+	Fallback Scorer
+}
+
+// Score returns a score between 1 and 2 for models with an observed
+// latency, and the fallback score squashed below 1 for the rest
+func (l *LatencyScorer) Score(model openrouter.Model) float64 {
+	if d, ok := l.Latency(model.ID); ok {
+		return 1 + 1/(1+d.Seconds())
+	}
+	return squash(l.Fallback.Score(model))
+}
+
+// Explain returns the observed latency in seconds, or the fallback broken
+// down in turn
+func (l *LatencyScorer) Explain(model openrouter.Model) []Factor {
+	if d, ok := l.Latency(model.ID); ok {
+		return []Factor{{Name: FactorLatency, Value: d.Seconds(), Weight: 1, Score: 1 + 1/(1+d.Seconds())}}
+	}
+	return []Factor{squashed(FactorFallback, l.Fallback, model)}
+}
+
+// NewScorer creates the scorer of the configured strategy. latency is the
+// source of observed latencies for the latency strategy.
+func NewScorer(cfg *config.Config, latency LatencySource) (Scorer, error) {
+	def := &WeightedScorer{
+		Weights:                DefaultWeights,
+		PreferredArchitectures: cfg.PreferredArchitectures,
+	}
+
+	switch cfg.Scorer {
+	case "", ScorerDefault:
+		return def, nil
+	case ScorerWeighted:
+		weights, err := parseWeights(cfg.ScoreWeights)
+		if err != nil {
+			return nil, err
+		}
+		return &WeightedScorer{
+			Weights:                weights,
+			VendorBonuses:          cfg.VendorBonuses,
+			PreferredArchitectures: cfg.PreferredArchitectures,
+		}, nil
+	case ScorerContext:
+		return &ContextScorer{Tiebreak: def}, nil
+	case ScorerLatency:
+		if latency == nil {
+			return nil, fmt.Errorf("the %s scorer needs a latency source", ScorerLatency)
+		}
+		return &LatencyScorer{Latency: latency, Fallback: def}, nil
+	}
+	return nil, fmt.Errorf("unknown scorer %q", cfg.Scorer)
+}
+
+// parseWeights overrides the default weights with the configured ones
+func parseWeights(configured map[string]float64) (Weights, error) {
+	weights := DefaultWeights
+	for name, weight := range configured {
+		switch name {
+		case "popularity":
+			weights.Popularity = weight
+		case "params":
+			weights.Params = weight
+		case "context":
+			weights.Context = weight
+		case "architecture":
+			weights.Architecture = weight
+		default:
+			return Weights{}, fmt.Errorf("unknown score weight %q: expected popularity, params, context or architecture", name)
+		}
+	}
+	return weights, nil
+}
+
+// squash maps a score onto the 0-1 range, keeping its order
+func squash(score float64) float64 {
+	return 0.5 + math.Atan(score)/math.Pi
+}
+
+// normalizePopularity normalizes popularity to 0-1 range
+func normalizePopularity(popularity int) float64 {
+	if popularity <= 0 {
+		return 0.1
+	}
+	// Logarithmic scale: log(1) = 0, log(1000000) ≈ 13.8
+	normalized := math.Log(float64(popularity)) / math.Log(1000000)
+	return math.Min(normalized, 1.0)
+}
+
+// normalizeParams normalizes parameter count to 0-1 range
+func normalizeParams(params int) float64 {
+	if params <= 0 {
+		return 0.1
+	}
+	// Linear scale: 0 = 0, 70B+ = 1
+	normalized := float64(params) / 70_000_000_000
+	return math.Min(normalized, 1.0)
+}
+
+// normalizeContextLength normalizes context length to 0-1 range
+func normalizeContextLength(length int) float64 {
+	if length <= 0 {
+		return 0.1
+	}
+	// Linear scale: 0 = 0, 200k+ = 1
+	normalized := float64(length) / 200_000
+	return math.Min(normalized, 1.0)
+}
+
+// isPreferredArchitecture checks if the model architecture is preferred
+func isPreferredArchitecture(preferredArchitectures []string, modality, tokenizer string) bool {
+	if len(preferredArchitectures) == 0 {
+		return false
+	}
+
+	// Check modality and tokenizer against preferred list
+	combined := strings.ToLower(modality) + " " + strings.ToLower(tokenizer)
+	for _, preferred := range preferredArchitectures {
+		if strings.Contains(combined, strings.ToLower(preferred)) {
+			return true
+		}
+	}
+	return false
+}
+
+// getModelQualityBonus adds a bonus for known high-quality models
+func getModelQualityBonus(name, id string) float64 {
+	bonus := 0.0
+
+	nameLower := strings.ToLower(name)
+	idLower := strings.ToLower(id)
+
+	// Known high-quality model families
+	qualityIndicators := []struct {
+		patterns []string
+		bonus    float64
+	}{
+		{[]string{"claude", "anthropic"}, 0.15},
+		{[]string{"gpt-", "openai"}, 0.12},
+		{[]string{"gemini", "google"}, 0.10},
+		{[]string{"mistral", "mixtral"}, 0.08},
+		{[]string{"llama", "meta"}, 0.08},
+		{[]string{"qwen"}, 0.07},
+		{[]string{"deepseek"}, 0.07},
+		{[]string{"command", "cohere"}, 0.06},
+		{[]string{"xiaomi", "mimo"}, 0.08},
+		{[]string{"kwaipilot", "kat-coder"}, 0.08},
+		{[]string{"nvidia", "nemotron"}, 0.07},
+		{[]string{"olmo", "allenai"}, 0.06},
+		{[]string{"trinity", "arcee"}, 0.06},
+	}
+
+	for _, indicator := range qualityIndicators {
+		for _, pattern := range indicator.patterns {
+			if strings.Contains(idLower, pattern) || strings.Contains(nameLower, pattern) {
+				bonus += indicator.bonus
+				break
+			}
+		}
+	}
+
+	// Bonus for "flash" or "pro" models (usually newer/better variants)
+	if strings.Contains(idLower, "flash") || strings.Contains(nameLower, "flash") {
+		bonus += 0.03
+	}
+	if strings.Contains(idLower, "pro") || strings.Contains(nameLower, "pro") {
+		bonus += 0.02
+	}
+
+	return bonus
+}
+
+// weakModelPenalty penalizes very old or tiny models
+func weakModelPenalty(id string) float64 {
+	penalty := 0.0
+
+	idLower := strings.ToLower(id)
+	weakIndicators := []string{"tiny", "mini", "nano", "micro"}
+	for _, indicator := range weakIndicators {
+		if strings.Contains(idLower, indicator) {
+			penalty -= 0.05
+		}
+	}
+
+	return penalty
+}
+
+// vendorBonus sums the configured bonuses whose key the model's ID or name
+// contains
+func vendorBonus(bonuses map[string]float64, name, id string) float64 {
+	bonus := 0.0
+
+	nameLower := strings.ToLower(name)
+	idLower := strings.ToLower(id)
+	for vendor, b := range bonuses {
+		vendor = strings.ToLower(vendor)
+		if strings.Contains(idLower, vendor) || strings.Contains(nameLower, vendor) {
+			bonus += b
+		}
+	}
+	return bonus
+}
@@ -0,0 +1,162 @@
+package model
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/mosajjal/frugalai/internal/config"
+	"github.com/mosajjal/frugalai/internal/openrouter"
+)
+
+// factor returns the score of the named factor, and false when there is no
+// such factor
+func factor(factors []Factor, name string) (float64, bool) {
+	for _, f := range factors {
+		if f.Name == name {
+			return f.Score, true
+		}
+	}
+	return 0, false
+}
+
+func TestWeightedScorerBonuses(t *testing.T) {
+	mini := openrouter.Model{ID: "qwen/qwen3-mini:free"}
+	tiered := mini
+	tiered.QualityTier = TierStrong
+
+	tests := []struct {
+		name    string
+		bonuses map[string]float64
+		model   openrouter.Model
+		vendor  float64
+		penalty float64
+		tier    float64
+	}{
+		{name: "built-in bonuses", model: mini, vendor: 0.07, penalty: -0.05},
+		{name: "configured bonuses", bonuses: map[string]float64{"qwen": 0.2, "mini": 0.1}, model: mini, vendor: 0.3, penalty: -0.05},
+		{name: "no configured bonus applies", bonuses: map[string]float64{"deepseek": 0.2}, model: mini, vendor: 0, penalty: -0.05},
+		{name: "tier replaces bonus and penalty", model: tiered, tier: 0.1},
+		{name: "tier replaces configured bonuses", bonuses: map[string]float64{"qwen": 0.2}, model: tiered, tier: 0.1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &WeightedScorer{Weights: DefaultWeights, VendorBonuses: tt.bonuses}
+			factors := w.Explain(tt.model)
+
+			if tt.model.QualityTier != "" {
+				if got, ok := factor(factors, FactorTierBonus); !ok || got != tt.tier {
+					t.Errorf("tier bonus = %v, want %v", got, tt.tier)
+				}
+				for _, name := range []string{FactorVendorBonus, FactorPenalty} {
+					if _, ok := factor(factors, name); ok {
+						t.Errorf("%s applied alongside the tier bonus", name)
+					}
+				}
+				return
+			}
+
+			if got, _ := factor(factors, FactorVendorBonus); math.Abs(got-tt.vendor) > 1e-9 {
+				t.Errorf("vendor bonus = %v, want %v", got, tt.vendor)
+			}
+			if got, ok := factor(factors, FactorPenalty); !ok || got != tt.penalty {
+				t.Errorf("penalty = %v (present %v), want %v", got, ok, tt.penalty)
+			}
+
+			sum := 0.0
+			for _, f := range factors {
+				sum += f.Score
+			}
+			if score := w.Score(tt.model); score != sum {
+				t.Errorf("Score() = %v, want the sum of its factors %v", score, sum)
+			}
+		})
+	}
+}
+
+func TestWeightedScorerOrder(t *testing.T) {
+	small := openrouter.Model{ID: "vendor/small", Params: 7_000_000_000, ContextLength: 32_768}
+	large := openrouter.Model{ID: "vendor/large", Params: 70_000_000_000, ContextLength: 32_768}
+	long := openrouter.Model{ID: "vendor/long", Params: 7_000_000_000, ContextLength: 200_000}
+	popular := openrouter.Model{ID: "vendor/popular", Params: 7_000_000_000, ContextLength: 32_768, Popularity: 1_000_000}
+
+	w := &WeightedScorer{Weights: DefaultWeights}
+	for _, better := range []openrouter.Model{large, long, popular} {
+		if w.Score(better) <= w.Score(small) {
+			t.Errorf("%s scores %v, want more than %s at %v", better.ID, w.Score(better), small.ID, w.Score(small))
+		}
+	}
+
+	arch := small
+	arch.Architecture.Tokenizer = "Qwen3"
+	w.PreferredArchitectures = []string{"qwen"}
+	if got := w.Score(arch) - w.Score(small); math.Abs(got-DefaultWeights.Architecture) > 1e-9 {
+		t.Errorf("preferred architecture adds %v, want %v", got, DefaultWeights.Architecture)
+	}
+}
+
+func TestContextScorer(t *testing.T) {
+	c := &ContextScorer{Tiebreak: &WeightedScorer{Weights: DefaultWeights}}
+
+	short := openrouter.Model{ID: "vendor/short", Params: 400_000_000_000, ContextLength: 8192}
+	long := openrouter.Model{ID: "vendor/long", Params: 1_000_000_000, ContextLength: 8193}
+	if c.Score(long) <= c.Score(short) {
+		t.Error("a larger model outranks one with a longer context")
+	}
+
+	larger := long
+	larger.Params = 70_000_000_000
+	if c.Score(larger) <= c.Score(long) {
+		t.Error("the tiebreak does not order models with the same context")
+	}
+}
+
+func TestLatencyScorer(t *testing.T) {
+	observed := map[string]time.Duration{"vendor/fast": 200 * time.Millisecond, "vendor/slow": 5 * time.Second}
+	l := &LatencyScorer{
+		Latency: func(id string) (time.Duration, bool) {
+			d, ok := observed[id]
+			return d, ok
+		},
+		Fallback: &WeightedScorer{Weights: DefaultWeights},
+	}
+
+	fast := openrouter.Model{ID: "vendor/fast"}
+	slow := openrouter.Model{ID: "vendor/slow"}
+	unseen := openrouter.Model{ID: "vendor/unseen", Params: 400_000_000_000, ContextLength: 1_000_000, Popularity: 1_000_000}
+	if !(l.Score(fast) > l.Score(slow) && l.Score(slow) > l.Score(unseen)) {
+		t.Errorf("scores fast %v, slow %v, unseen %v, want them in that order", l.Score(fast), l.Score(slow), l.Score(unseen))
+	}
+}
+
+func TestNewScorer(t *testing.T) {
+	latency := func(string) (time.Duration, bool) { return 0, false }
+
+	tests := []struct {
+		name    string
+		cfg     config.Config
+		latency LatencySource
+		wantErr bool
+	}{
+		{name: "default", cfg: config.Config{}},
+		{name: "weighted", cfg: config.Config{Scorer: ScorerWeighted, ScoreWeights: map[string]float64{"params": 1}}},
+		{name: "unknown weight", cfg: config.Config{Scorer: ScorerWeighted, ScoreWeights: map[string]float64{"speed": 1}}, wantErr: true},
+		{name: "context", cfg: config.Config{Scorer: ScorerContext}},
+		{name: "latency", cfg: config.Config{Scorer: ScorerLatency}, latency: latency},
+		{name: "latency without a source", cfg: config.Config{Scorer: ScorerLatency}, wantErr: true},
+		{name: "unknown", cfg: config.Config{Scorer: "random"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewScorer(&tt.cfg, tt.latency)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewScorer() error = %v, want an error %v", err, tt.wantErr)
+			}
+			if w, ok := s.(*WeightedScorer); ok && tt.cfg.Scorer == ScorerWeighted && w.Weights.Params != 1 {
+				t.Errorf("params weight = %v, want the configured 1", w.Weights.Params)
+			}
+		})
+	}
+}
@@ -2,35 +2,71 @@ package model
 
 import (
 	"fmt"
-	"math"
+	"path"
 	"sort"
-	"strings"
 	"sync"
 
 	"github.com/mosajjal/frugalai/internal/config"
 	"github.com/mosajjal/frugalai/internal/openrouter"
+	"github.com/mosajjal/frugalai/internal/tokenizer"
 )
 
+// ModelSource lists the models a selector chooses from, e.g. an OpenRouter
+// client or a registry of several providers
+type ModelSource interface {
+	GetModels() ([]openrouter.Model, error)
+	GetFreeModels() ([]openrouter.Model, error)
+}
+
 // Selector selects the best model based on configuration
 type Selector struct {
-	client *openrouter.Client
+	client ModelSource
 	config *config.Config
+	rules  *Rules
+	scorer Scorer
+	usage  PopularitySource
 	mu     sync.RWMutex
 }
 
+// Rejection is a free model the selector filtered out, and why
+type Rejection struct {
+	Model  openrouter.Model
+	Reason string
+}
+
 // NewSelector creates a new model selector
-func NewSelector(client *openrouter.Client, cfg *config.Config) *Selector {
+func NewSelector(client ModelSource, cfg *config.Config) *Selector {
 	return &Selector{
 		client: client,
 		config: cfg,
+		scorer: &WeightedScorer{
+			Weights:                DefaultWeights,
+			PreferredArchitectures: cfg.PreferredArchitectures,
+		},
 	}
 }
 
+// SetScorer sets the scoring strategy models are ranked with
+func (s *Selector) SetScorer(scorer Scorer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.scorer = scorer
+}
+
+// SetRules sets the allow and deny rules models are filtered with
+func (s *Selector) SetRules(rules *Rules) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rules = rules
+}
+
 // SelectBest selects the best free model based on configuration
 func (s *Selector) SelectBest() (*openrouter.Model, error) {
-	models, err := s.client.GetFreeModels()
+	models, err := s.freeModels()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get free models: %w", err)
+		return nil, err
 	}
 
 	if len(models) == 0 {
@@ -54,167 +90,104 @@ func (s *Selector) SelectBest() (*openrouter.Model, error) {
 	return &scored[0].Model, nil
 }
 
+// freeModels returns the free models of the source with their popularity
+// score
+func (s *Selector) freeModels() ([]openrouter.Model, error) {
+	models, err := s.client.GetFreeModels()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get free models: %w", err)
+	}
+	return s.withPopularity(models), nil
+}
+
 // filterModels filters models based on configuration constraints
 func (s *Selector) filterModels(models []openrouter.Model) []openrouter.Model {
 	filtered := []openrouter.Model{}
 
 	for _, model := range models {
-		// Check minimum parameter count
-		if s.config.MinParams > 0 && model.Params < s.config.MinParams {
-			continue
-		}
-
-		// Check minimum popularity
-		if s.config.MinPopularity > 0 && model.Popularity < s.config.MinPopularity {
-			continue
+		if s.rejectReason(model) == "" {
+			filtered = append(filtered, model)
 		}
-
-		filtered = append(filtered, model)
 	}
 
 	return filtered
 }
 
-// scoreModels scores models based on various factors
-func (s *Selector) scoreModels(models []openrouter.Model) []openrouter.ModelScore {
-	scored := make([]openrouter.ModelScore, len(models))
-
-	for i, model := range models {
-		scored[i] = openrouter.ModelScore{
-			Model: model,
-			Score: s.calculateScore(model),
-		}
+// rejectReason returns why the configuration filters out the model, or ""
+// when it is kept
+func (s *Selector) rejectReason(model openrouter.Model) string {
+	// Check minimum parameter count
+	if s.config.MinParams > 0 && model.Params < s.config.MinParams {
+		return fmt.Sprintf("%d params is below the minimum of %d", model.Params, s.config.MinParams)
 	}
 
-	return scored
-}
-
-// calculateScore calculates a score for a single model
-func (s *Selector) calculateScore(model openrouter.Model) float64 {
-	score := 0.0
-
-	// Popularity score (normalized to 0-1, weight: 0.3)
-	popularityScore := s.normalizePopularity(model.Popularity)
-	score += popularityScore * 0.3
-
-	// Parameter count score (normalized to 0-1, weight: 0.4)
-	paramScore := s.normalizeParams(model.Params)
-	score += paramScore * 0.4
-
-	// Context length score (normalized to 0-1, weight: 0.2)
-	contextScore := s.normalizeContextLength(model.ContextLength)
-	score += contextScore * 0.2
-
-	// Preferred architecture bonus (weight: 0.1)
-	if s.isPreferredArchitecture(model.Architecture.Modality, model.Architecture.Tokenizer) {
-		score += 0.1
+	// Check minimum popularity
+	if s.config.MinPopularity > 0 && model.Popularity < s.config.MinPopularity {
+		return fmt.Sprintf("popularity %d is below the minimum of %d", model.Popularity, s.config.MinPopularity)
 	}
 
-	// Quality bonus based on known good model names
-	score += s.getModelQualityBonus(model.Name, model.ID)
-
-	return score
+	return s.ruleReason(model)
 }
 
-// normalizePopularity normalizes popularity to 0-1 range
-func (s *Selector) normalizePopularity(popularity int) float64 {
-	if popularity <= 0 {
-		return 0.1
-	}
-	// Logarithmic scale: log(1) = 0, log(1000000) ≈ 13.8
-	normalized := math.Log(float64(popularity)) / math.Log(1000000)
-	return math.Min(normalized, 1.0)
-}
+// ruleReason returns why the allow and deny rules reject the model, or ""
+func (s *Selector) ruleReason(model openrouter.Model) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
-// normalizeParams normalizes parameter count to 0-1 range
-func (s *Selector) normalizeParams(params int) float64 {
-	if params <= 0 {
-		return 0.1
-	}
-	// Linear scale: 0 = 0, 70B+ = 1
-	normalized := float64(params) / 70_000_000_000
-	return math.Min(normalized, 1.0)
+	return s.rules.Check(model)
 }
 
-// normalizeContextLength normalizes context length to 0-1 range
-func (s *Selector) normalizeContextLength(length int) float64 {
-	if length <= 0 {
-		return 0.1
-	}
-	// Linear scale: 0 = 0, 200k+ = 1
-	normalized := float64(length) / 200_000
-	return math.Min(normalized, 1.0)
-}
-
-// isPreferredArchitecture checks if the model architecture is preferred
-func (s *Selector) isPreferredArchitecture(modality, tokenizer string) bool {
-	if len(s.config.PreferredArchitectures) == 0 {
-		return false
+// GetRejectedModels lists the free models the configuration filters out,
+// with the reason for each
+func (s *Selector) GetRejectedModels() ([]Rejection, error) {
+	models, err := s.freeModels()
+	if err != nil {
+		return nil, err
 	}
 
-	// Check modality and tokenizer against preferred list
-	combined := strings.ToLower(modality) + " " + strings.ToLower(tokenizer)
-	for _, preferred := range s.config.PreferredArchitectures {
-		if strings.Contains(combined, strings.ToLower(preferred)) {
-			return true
+	rejected := []Rejection{}
+	for _, model := range models {
+		if reason := s.rejectReason(model); reason != "" {
+			rejected = append(rejected, Rejection{Model: model, Reason: reason})
 		}
 	}
-	return false
+	return rejected, nil
 }
 
-// getModelQualityBonus adds a bonus for known high-quality models
-func (s *Selector) getModelQualityBonus(name, id string) float64 {
-	bonus := 0.0
-
-	nameLower := strings.ToLower(name)
-	idLower := strings.ToLower(id)
-
-	// Known high-quality model families
-	qualityIndicators := []struct {
-		patterns []string
-		bonus    float64
-	}{
-		{[]string{"claude", "anthropic"}, 0.15},
-		{[]string{"gpt-", "openai"}, 0.12},
-		{[]string{"gemini", "google"}, 0.10},
-		{[]string{"mistral", "mixtral"}, 0.08},
-		{[]string{"llama", "meta"}, 0.08},
-		{[]string{"qwen"}, 0.07},
-		{[]string{"deepseek"}, 0.07},
-		{[]string{"command", "cohere"}, 0.06},
-		{[]string{"xiaomi", "mimo"}, 0.08},
-		{[]string{"kwaipilot", "kat-coder"}, 0.08},
-		{[]string{"nvidia", "nemotron"}, 0.07},
-		{[]string{"olmo", "allenai"}, 0.06},
-		{[]string{"trinity", "arcee"}, 0.06},
-	}
+// scoreModels scores models based on various factors
+func (s *Selector) scoreModels(models []openrouter.Model) []openrouter.ModelScore {
+	s.mu.RLock()
+	scorer := s.scorer
+	s.mu.RUnlock()
+
+	scored := make([]openrouter.ModelScore, len(models))
 
-	for _, indicator := range qualityIndicators {
-		for _, pattern := range indicator.patterns {
-			if strings.Contains(idLower, pattern) || strings.Contains(nameLower, pattern) {
-				bonus += indicator.bonus
-				break
-			}
+	for i, model := range models {
+		scored[i] = openrouter.ModelScore{
+			Model: model,
+			Score: scorer.Score(model),
 		}
 	}
 
-	// Bonus for "flash" or "pro" models (usually newer/better variants)
-	if strings.Contains(idLower, "flash") || strings.Contains(nameLower, "flash") {
-		bonus += 0.03
-	}
-	if strings.Contains(idLower, "pro") || strings.Contains(nameLower, "pro") {
-		bonus += 0.02
-	}
+	return scored
+}
 
-	// Penalize very old or tiny models
-	weakIndicators := []string{"tiny", "mini", "nano", "micro"}
-	for _, indicator := range weakIndicators {
-		if strings.Contains(idLower, indicator) {
-			bonus -= 0.05
+// SupportsSystemPrompt reports whether the model accepts system messages.
+// Models matching a SystemMergeModels pattern do not, and get their system
+// prompt merged into the first user message instead.
+func (s *Selector) SupportsSystemPrompt(modelID string) bool {
+	for _, pattern := range s.config.SystemMergeModels {
+		if matched, _ := path.Match(pattern, modelID); matched {
+			return false
 		}
 	}
+	return true
+}
 
-	return bonus
+// EstimateTokens estimates the input tokens of a request for a model, using
+// the model's tokenizer family
+func (s *Selector) EstimateTokens(m openrouter.Model, req *openrouter.ChatRequest) int {
+	return tokenizer.EstimateRequest(req, m.Architecture.Tokenizer)
 }
 
 // SelectModelByID selects a specific model by ID
@@ -244,9 +217,9 @@ func (s *Selector) GetBestModelID() (string, error) {
 
 // GetTopCandidates returns the top N candidates, sorted by score
 func (s *Selector) GetTopCandidates(n int) ([]openrouter.Model, error) {
-	models, err := s.client.GetFreeModels()
+	models, err := s.freeModels()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get free models: %w", err)
+		return nil, err
 	}
 
 	if len(models) == 0 {
@@ -259,21 +232,45 @@ func (s *Selector) GetTopCandidates(n int) ([]openrouter.Model, error) {
 		return nil, fmt.Errorf("no models match the constraints")
 	}
 
-	// Score models
-	scored := s.scoreModels(filtered)
+	// Return top N
+	ranked := s.rank(filtered)
+	if len(ranked) > n {
+		ranked = ranked[:n]
+	}
 
-	// Sort by score (descending)
+	return ranked, nil
+}
+
+// GetRankedModels returns every free model the allow and deny rules permit,
+// sorted by score, for requests that bring their own constraints in place
+// of the minimum parameter count and popularity
+func (s *Selector) GetRankedModels() ([]openrouter.Model, error) {
+	models, err := s.freeModels()
+	if err != nil {
+		return nil, err
+	}
+
+	permitted := []openrouter.Model{}
+	for _, model := range models {
+		if s.ruleReason(model) == "" {
+			permitted = append(permitted, model)
+		}
+	}
+	return s.rank(permitted), nil
+}
+
+// rank scores the models and sorts them by score (descending)
+func (s *Selector) rank(models []openrouter.Model) []openrouter.Model {
+	scored := s.scoreModels(models)
 	sort.Slice(scored, func(i, j int) bool {
 		return scored[i].Score > scored[j].Score
 	})
 
-	// Return top N
-	result := []openrouter.Model{}
-	for i := 0; i < n && i < len(scored); i++ {
-		result = append(result, scored[i].Model)
+	result := make([]openrouter.Model, len(scored))
+	for i := range scored {
+		result[i] = scored[i].Model
 	}
-
-	return result, nil
+	return result
 }
 
 // GetCandidateByIndex gets a candidate by its index (0-based) from the top candidates
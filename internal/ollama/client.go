@@ -0,0 +1,364 @@
+package ollama
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mosajjal/frugalai/internal/openrouter"
+)
+
+const (
+	// DefaultName and DefaultBaseURL identify a local Ollama server
+	DefaultName    = "ollama"
+	DefaultBaseURL = "http://localhost:11434"
+
+	tagsEndpoint = "/api/tags"
+	showEndpoint = "/api/show"
+	chatEndpoint = "/api/chat"
+
+	// chatTimeout bounds non-streaming requests. It is generous because a
+	// local server may have to load the model into memory first.
+	chatTimeout = 2 * time.Minute
+)
+
+// Client is a client for the native API of an Ollama server. It lists the
+// installed models and translates chat requests and responses between the
+// OpenAI format and Ollama's, including its NDJSON streams.
+type Client struct {
+	name       string
+	baseURL    string
+	freeModels []string
+	numCtx     int
+	httpClient *http.Client
+	// streamClient has no overall timeout so long generations are not cut
+	// off; streams are bounded by the caller's context instead
+	streamClient *http.Client
+	cache        *openrouter.CachedModels
+	cacheMutex   sync.RWMutex
+	cacheTTL     time.Duration
+}
+
+// Config configures a client
+type Config struct {
+	// Name identifies the provider (default: ollama)
+	Name string
+
+	// BaseURL is the server root (default: http://localhost:11434)
+	BaseURL string
+
+	// CacheTTL is the model cache TTL in seconds
+	CacheTTL int
+
+	// FreeModels lists patterns (e.g. qwen2.5-coder:*) of the installed
+	// models to use. Without patterns every installed model is used.
+	FreeModels []string
+
+	// ContextLength is the context window requested for every chat, as
+	// Ollama's num_ctx option. It caps the models' advertised context
+	// length, since the server truncates prompts to its window. 0 keeps the
+	// server's default.
+	ContextLength int
+}
+
+// NewClient creates a client for an Ollama server
+func NewClient(cfg Config) *Client {
+	if cfg.Name == "" {
+		cfg.Name = DefaultName
+	}
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = DefaultBaseURL
+	}
+
+	return &Client{
+		name:       cfg.Name,
+		baseURL:    strings.TrimSuffix(cfg.BaseURL, "/"),
+		freeModels: cfg.FreeModels,
+		numCtx:     cfg.ContextLength,
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+		streamClient: &http.Client{},
+		cacheTTL:     time.Duration(cfg.CacheTTL) * time.Second,
+	}
+}
+
+// Name returns the provider name of the client
+func (c *Client) Name() string {
+	return c.name
+}
+
+// GetModels lists the installed models that can chat, with their context
+// length and capabilities
+func (c *Client) GetModels() ([]openrouter.Model, error) {
+	// Check cache first
+	c.cacheMutex.RLock()
+	if c.cache != nil && time.Since(c.cache.Timestamp) < c.cacheTTL {
+		models := c.cache.Models
+		c.cacheMutex.RUnlock()
+		return models, nil
+	}
+	c.cacheMutex.RUnlock()
+
+	resp, err := c.httpClient.Get(c.baseURL + tagsEndpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch models: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, &openrouter.HTTPError{Code: resp.StatusCode, Message: string(body)}
+	}
+
+	var tags tagsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tags); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	models := []openrouter.Model{}
+	for _, tag := range tags.Models {
+		show, err := c.show(tag.Name)
+		if err != nil {
+			log.Printf("[DEBUG] Could not fetch details of %s: %v", tag.Name, err)
+		}
+		if !canChat(show) {
+			continue
+		}
+
+		m := toModel(tag, show)
+		if c.numCtx > 0 && (m.ContextLength == 0 || m.ContextLength > c.numCtx) {
+			m.ContextLength = c.numCtx
+		}
+		models = append(models, m)
+	}
+
+	// Update cache
+	c.cacheMutex.Lock()
+	c.cache = &openrouter.CachedModels{
+		Models:    models,
+		Timestamp: time.Now(),
+	}
+	c.cacheMutex.Unlock()
+
+	return models, nil
+}
+
+// GetFreeModels returns the installed models matching the FreeModels
+// patterns, or all of them. Local models cost nothing.
+func (c *Client) GetFreeModels() ([]openrouter.Model, error) {
+	models, err := c.GetModels()
+	if err != nil {
+		return nil, err
+	}
+	if len(c.freeModels) == 0 {
+		return models, nil
+	}
+
+	freeModels := []openrouter.Model{}
+	for _, m := range models {
+		for _, pattern := range c.freeModels {
+			if ok, _ := path.Match(pattern, m.ID); ok || pattern == "*" {
+				freeModels = append(freeModels, m)
+				break
+			}
+		}
+	}
+	return freeModels, nil
+}
+
+// InvalidateCache invalidates the model cache
+func (c *Client) InvalidateCache() {
+	c.cacheMutex.Lock()
+	c.cache = nil
+	c.cacheMutex.Unlock()
+}
+
+// ChatCompletion sends a chat completion request
+func (c *Client) ChatCompletion(req *openrouter.ChatRequest) (*openrouter.ChatResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), chatTimeout)
+	defer cancel()
+
+	upstream := *req
+	upstream.Stream = false
+	resp, err := c.send(ctx, c.httpClient, &upstream)
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded || errors.Is(err, context.DeadlineExceeded) {
+			return nil, &openrouter.TimeoutError{Duration: chatTimeout}
+		}
+		if urlErr, ok := err.(*url.Error); ok && urlErr.Timeout() {
+			return nil, &openrouter.TimeoutError{Duration: chatTimeout}
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var chatResp chatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&chatResp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if chatResp.Error != "" {
+		return nil, &openrouter.HTTPError{Code: http.StatusBadGateway, Message: chatResp.Error}
+	}
+
+	return toChatResponse(&chatResp, completionID(), req.Model), nil
+}
+
+// StreamChatCompletionWithContext sends a streaming chat completion request
+// that is cancelled together with ctx. The NDJSON stream is translated into
+// OpenAI chunks. errChan is closed before chunkChan, so once chunkChan is
+// drained any error is already waiting in errChan.
+func (c *Client) StreamChatCompletionWithContext(ctx context.Context, req *openrouter.ChatRequest) (<-chan openrouter.StreamChunk, <-chan error) {
+	chunkChan := make(chan openrouter.StreamChunk, 10)
+	errChan := make(chan error, 1)
+
+	go func() {
+		defer close(chunkChan)
+		defer close(errChan)
+
+		upstream := *req
+		upstream.Stream = true
+		resp, err := c.send(ctx, c.streamClient, &upstream)
+		if err != nil {
+			errChan <- err
+			return
+		}
+		defer resp.Body.Close()
+
+		id := completionID()
+		first := true
+		toolCalls := 0
+
+		scanner := bufio.NewScanner(resp.Body)
+		scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		for scanner.Scan() {
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+
+			var chatResp chatResponse
+			if err := json.Unmarshal(line, &chatResp); err != nil {
+				errChan <- fmt.Errorf("failed to decode chunk: %w", err)
+				return
+			}
+
+			// Errors after the stream has started arrive as a line
+			if chatResp.Error != "" {
+				errChan <- &openrouter.HTTPError{Code: http.StatusBadGateway, Message: chatResp.Error}
+				return
+			}
+
+			chunk := toStreamChunk(&chatResp, id, req.Model, first, toolCalls)
+			first = false
+			toolCalls += len(chatResp.Message.ToolCalls)
+
+			select {
+			case chunkChan <- chunk:
+			case <-ctx.Done():
+				return
+			}
+
+			if chatResp.Done {
+				return
+			}
+		}
+		if err := scanner.Err(); err != nil && ctx.Err() == nil {
+			errChan <- fmt.Errorf("failed to read stream: %w", err)
+		}
+	}()
+
+	return chunkChan, errChan
+}
+
+// send posts a chat request and returns the response once its status is OK
+func (c *Client) send(ctx context.Context, client *http.Client, req *openrouter.ChatRequest) (*http.Response, error) {
+	chatReq, err := toChatRequest(req, c.numCtx)
+	if err != nil {
+		return nil, err
+	}
+	body, err := json.Marshal(chatReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+chatEndpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		// A cancelled request says nothing about the server
+		if ctx.Err() == context.Canceled {
+			return nil, fmt.Errorf("failed to send request: %w", err)
+		}
+		if urlErr, ok := err.(*url.Error); ok && urlErr.Timeout() {
+			return nil, err
+		}
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, err
+		}
+		return nil, &openrouter.ConnectionError{Err: err}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return nil, &openrouter.HTTPError{Code: resp.StatusCode, Message: errorMessage(body)}
+	}
+	return resp, nil
+}
+
+// show fetches the details of an installed model
+func (c *Client) show(name string) (*showResponse, error) {
+	body, err := json.Marshal(map[string]string{"model": name})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Post(c.baseURL+showEndpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+
+	var show showResponse
+	if err := json.NewDecoder(resp.Body).Decode(&show); err != nil {
+		return nil, err
+	}
+	return &show, nil
+}
+
+// errorMessage extracts the message of an {"error": "..."} body, falling
+// back to the body itself
+func errorMessage(body []byte) string {
+	var payload struct {
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(body, &payload); err == nil && payload.Error != "" {
+		return payload.Error
+	}
+	return string(body)
+}
+
+// completionID returns an ID for a completion, which Ollama does not assign
+func completionID() string {
+	return fmt.Sprintf("chatcmpl-ollama-%d", time.Now().UnixNano())
+}
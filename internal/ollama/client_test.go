@@ -0,0 +1,240 @@
+package ollama
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mosajjal/frugalai/internal/openrouter"
+)
+
+// fakeServer serves an Ollama API with two chat models and an embedding
+// model. chat is written as the body of /api/chat.
+func fakeServer(t *testing.T, chat string) (*Client, *chatRequest) {
+	t.Helper()
+	var got chatRequest
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(tagsEndpoint, func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"models":[
+			{"name":"llama3.2:3b","details":{"family":"llama","parameter_size":"3.2B","quantization_level":"Q4_K_M"}},
+			{"name":"gemma3:27b","details":{"family":"gemma3","parameter_size":"27.4B","quantization_level":"Q4_K_M"}},
+			{"name":"nomic-embed-text:latest","details":{"family":"nomic-bert","parameter_size":"137M"}}
+		]}`)
+	})
+	mux.HandleFunc(showEndpoint, func(w http.ResponseWriter, r *http.Request) {
+		var req struct{ Model string }
+		json.NewDecoder(r.Body).Decode(&req)
+		switch req.Model {
+		case "llama3.2:3b":
+			io.WriteString(w, `{"capabilities":["completion","tools"],"model_info":{"llama.context_length":131072}}`)
+		case "gemma3:27b":
+			io.WriteString(w, `{"capabilities":["completion","vision"],"model_info":{"gemma3.context_length":8192}}`)
+		default:
+			io.WriteString(w, `{"capabilities":["embedding"]}`)
+		}
+	})
+	mux.HandleFunc(chatEndpoint, func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+		io.WriteString(w, chat)
+	})
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return NewClient(Config{BaseURL: srv.URL, ContextLength: 32768}), &got
+}
+
+func TestGetModels(t *testing.T) {
+	c, _ := fakeServer(t, "")
+
+	models, err := c.GetModels()
+	if err != nil {
+		t.Fatalf("GetModels() error = %v", err)
+	}
+	if len(models) != 2 {
+		t.Fatalf("got %d models, want the two chat models", len(models))
+	}
+
+	llama, gemma := models[0], models[1]
+	if llama.ID != "llama3.2:3b" || llama.Params != 3_200_000_000 || llama.Architecture.Tokenizer != "llama" {
+		t.Errorf("llama = %s with %d params and tokenizer %s", llama.ID, llama.Params, llama.Architecture.Tokenizer)
+	}
+	if !llama.SupportsTools() || llama.AcceptsInput("image") {
+		t.Errorf("llama supports tools %v and images %v, want tools only", llama.SupportsTools(), llama.AcceptsInput("image"))
+	}
+	if llama.ContextLength != 32768 {
+		t.Errorf("llama context = %d, want it capped at num_ctx 32768", llama.ContextLength)
+	}
+	if llama.Pricing.Prompt != "0" || llama.Pricing.Completion != "0" {
+		t.Errorf("llama pricing = %+v, want free", llama.Pricing)
+	}
+
+	if !gemma.AcceptsInput("image") || gemma.SupportsTools() || gemma.ContextLength != 8192 {
+		t.Errorf("gemma = %+v, want vision without tools and a context of 8192", gemma)
+	}
+}
+
+func TestGetFreeModelsPatterns(t *testing.T) {
+	c, _ := fakeServer(t, "")
+	c.freeModels = []string{"gemma3:*"}
+
+	models, err := c.GetFreeModels()
+	if err != nil {
+		t.Fatalf("GetFreeModels() error = %v", err)
+	}
+	if len(models) != 1 || models[0].ID != "gemma3:27b" {
+		t.Errorf("free models = %v, want only gemma3:27b", models)
+	}
+}
+
+func TestChatCompletion(t *testing.T) {
+	c, got := fakeServer(t, `{"model":"llama3.2:3b","created_at":"2025-01-01T00:00:00Z",`+
+		`"message":{"role":"assistant","content":"","tool_calls":[{"function":{"name":"get_weather","arguments":{"city":"Paris"}}}]},`+
+		`"done":true,"done_reason":"stop","prompt_eval_count":20,"eval_count":7}`)
+
+	temperature := 0.2
+	resp, err := c.ChatCompletion(&openrouter.ChatRequest{
+		Model:       "llama3.2:3b",
+		MaxTokens:   100,
+		Temperature: &temperature,
+		Messages:    []openrouter.ChatMessage{{Role: "user", Content: openrouter.TextContent("Weather in Paris?")}},
+		Tools:       []openrouter.Tool{{Type: "function", Function: openrouter.FunctionDefinition{Name: "get_weather"}}},
+	})
+	if err != nil {
+		t.Fatalf("ChatCompletion() error = %v", err)
+	}
+
+	if got.Stream || got.Options.NumCtx != 32768 || got.Options.NumPredict != 100 || *got.Options.Temperature != 0.2 || len(got.Tools) == 0 {
+		t.Errorf("upstream request = %+v, options %+v", got, got.Options)
+	}
+
+	choice := resp.Choices[0]
+	if choice.FinishReason != "tool_calls" || len(choice.Message.ToolCalls) != 1 {
+		t.Fatalf("choice = %+v, want a tool call", choice)
+	}
+	if args := choice.Message.ToolCalls[0].Function.Arguments; args != `{"city":"Paris"}` {
+		t.Errorf("arguments = %s, want them as a JSON string", args)
+	}
+	if resp.Usage.PromptTokens != 20 || resp.Usage.CompletionTokens != 7 || resp.Usage.TotalTokens != 27 {
+		t.Errorf("usage = %+v", resp.Usage)
+	}
+}
+
+func TestStreamChatCompletion(t *testing.T) {
+	t.Run("NDJSON stream", func(t *testing.T) {
+		c, got := fakeServer(t, strings.Join([]string{
+			`{"model":"llama3.2:3b","message":{"role":"assistant","content":"Hel"},"done":false}`,
+			``,
+			`{"model":"llama3.2:3b","message":{"role":"assistant","content":"lo"},"done":false}`,
+			`{"model":"llama3.2:3b","message":{"role":"assistant","content":""},"done":true,"done_reason":"length","prompt_eval_count":12,"eval_count":2}`,
+			`{"model":"llama3.2:3b","message":{"role":"assistant","content":"after done"},"done":false}`,
+		}, "\n"))
+
+		chunks, err := drain(c.StreamChatCompletionWithContext(t.Context(), &openrouter.ChatRequest{
+			Model:    "llama3.2:3b",
+			Messages: []openrouter.ChatMessage{{Role: "user", Content: openrouter.TextContent("Hi")}},
+		}))
+		if err != nil {
+			t.Fatalf("stream error = %v", err)
+		}
+		if !got.Stream {
+			t.Error("upstream request is not streamed")
+		}
+		if len(chunks) != 3 {
+			t.Fatalf("got %d chunks, want 3 up to the done line", len(chunks))
+		}
+
+		var text strings.Builder
+		for i, chunk := range chunks {
+			if chunk.ID != chunks[0].ID || chunk.Object != "chat.completion.chunk" || chunk.Model != "llama3.2:3b" {
+				t.Errorf("chunk %d = %+v", i, chunk)
+			}
+			text.WriteString(chunk.Choices[0].Delta.Content)
+		}
+		if text.String() != "Hello" {
+			t.Errorf("text = %q, want Hello", text.String())
+		}
+		if chunks[0].Choices[0].Delta.Role != "assistant" || chunks[1].Choices[0].Delta.Role != "" {
+			t.Error("only the first chunk should carry the role")
+		}
+
+		final := chunks[2]
+		if final.Choices[0].FinishReason == nil || *final.Choices[0].FinishReason != "length" {
+			t.Errorf("finish reason = %v, want length", final.Choices[0].FinishReason)
+		}
+		if final.Usage == nil || final.Usage.PromptTokens != 12 || final.Usage.CompletionTokens != 2 {
+			t.Errorf("final usage = %+v, want 12 in and 2 out", final.Usage)
+		}
+		if chunks[0].Usage != nil {
+			t.Error("usage reported before the final chunk")
+		}
+	})
+
+	t.Run("tool calls across lines", func(t *testing.T) {
+		c, _ := fakeServer(t, strings.Join([]string{
+			`{"message":{"role":"assistant","content":"","tool_calls":[{"function":{"name":"a","arguments":{}}}]},"done":false}`,
+			`{"message":{"role":"assistant","content":"","tool_calls":[{"function":{"name":"b","arguments":{"x":1}}}]},"done":false}`,
+			`{"message":{"role":"assistant","content":""},"done":true,"done_reason":"stop"}`,
+		}, "\n"))
+
+		chunks, err := drain(c.StreamChatCompletionWithContext(t.Context(), &openrouter.ChatRequest{Model: "llama3.2:3b"}))
+		if err != nil {
+			t.Fatalf("stream error = %v", err)
+		}
+		second := chunks[1].Choices[0].Delta.ToolCalls[0]
+		if second.Index == nil || *second.Index != 1 || second.Function.Name != "b" || second.ID == chunks[0].Choices[0].Delta.ToolCalls[0].ID {
+			t.Errorf("second tool call = %+v, want index 1 and its own ID", second)
+		}
+		if reason := chunks[2].Choices[0].FinishReason; reason == nil || *reason != "tool_calls" {
+			t.Errorf("finish reason = %v, want tool_calls", reason)
+		}
+	})
+
+	t.Run("error line", func(t *testing.T) {
+		c, _ := fakeServer(t, `{"message":{"role":"assistant","content":"Hi"},"done":false}`+"\n"+`{"error":"model runner has unexpectedly stopped"}`+"\n")
+
+		chunks, err := drain(c.StreamChatCompletionWithContext(t.Context(), &openrouter.ChatRequest{Model: "llama3.2:3b"}))
+		if len(chunks) != 1 {
+			t.Errorf("got %d chunks before the error, want 1", len(chunks))
+		}
+		var httpErr *openrouter.HTTPError
+		if !errors.As(err, &httpErr) || httpErr.Code != http.StatusBadGateway || !strings.Contains(httpErr.Message, "runner") {
+			t.Errorf("error = %v, want a 502 with the server's message", err)
+		}
+	})
+}
+
+func TestChatErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, `{"error":"model \"missing\" not found, try pulling it first"}`)
+	}))
+	defer srv.Close()
+	c := NewClient(Config{BaseURL: srv.URL})
+
+	_, err := c.ChatCompletion(&openrouter.ChatRequest{Model: "missing"})
+	var httpErr *openrouter.HTTPError
+	if !errors.As(err, &httpErr) || httpErr.Code != http.StatusNotFound || !strings.HasPrefix(httpErr.Message, "model") {
+		t.Errorf("error = %v, want a 404 with the server's message", err)
+	}
+
+	srv.Close()
+	_, err = c.ChatCompletion(&openrouter.ChatRequest{Model: "missing"})
+	var connErr *openrouter.ConnectionError
+	if !errors.As(err, &connErr) {
+		t.Errorf("error = %v, want a ConnectionError for a server that is down", err)
+	}
+}
+
+// drain collects the chunks of a stream and the error it ended with
+func drain(chunks <-chan openrouter.StreamChunk, errs <-chan error) ([]openrouter.StreamChunk, error) {
+	var got []openrouter.StreamChunk
+	for chunk := range chunks {
+		got = append(got, chunk)
+	}
+	return got, <-errs
+}
@@ -0,0 +1,269 @@
+package ollama
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/mosajjal/frugalai/internal/model"
+	"github.com/mosajjal/frugalai/internal/openrouter"
+)
+
+// toChatRequest converts an OpenAI chat request into an /api/chat request.
+// numCtx is the context window to ask for, 0 for the server's default.
+func toChatRequest(req *openrouter.ChatRequest, numCtx int) (*chatRequest, error) {
+	// Ollama names the tool a result belongs to, OpenAI the call ID
+	toolNames := map[string]string{}
+
+	messages := make([]message, 0, len(req.Messages))
+	for _, msg := range req.Messages {
+		m := message{
+			Role:    msg.Role,
+			Content: msg.Content.String(),
+		}
+		if m.Role == "developer" {
+			m.Role = "system"
+		}
+
+		for _, part := range msg.Content.Parts {
+			if part.Type != "image_url" || part.ImageURL == nil {
+				continue
+			}
+			_, data, ok := openrouter.ParseDataURI(part.ImageURL.URL)
+			if !ok {
+				log.Printf("[WARN] Ollama only accepts inline images, dropping %s", part.ImageURL.URL)
+				continue
+			}
+			m.Images = append(m.Images, data)
+		}
+
+		for _, tc := range msg.ToolCalls {
+			args := json.RawMessage(tc.Function.Arguments)
+			if !json.Valid(args) {
+				args = json.RawMessage("{}")
+			}
+			m.ToolCalls = append(m.ToolCalls, toolCall{
+				Function: toolFunction{Name: tc.Function.Name, Arguments: args},
+			})
+			toolNames[tc.ID] = tc.Function.Name
+		}
+
+		if msg.Role == "tool" {
+			m.ToolName = toolNames[msg.ToolCallID]
+			if m.ToolName == "" {
+				m.ToolName = msg.Name
+			}
+		}
+
+		messages = append(messages, m)
+	}
+
+	result := &chatRequest{
+		Model:    req.Model,
+		Messages: messages,
+		Stream:   req.Stream,
+		Options: &options{
+			NumCtx:           numCtx,
+			NumPredict:       req.MaxTokens,
+			Temperature:      req.Temperature,
+			TopP:             req.TopP,
+			TopK:             req.TopK,
+			Seed:             req.Seed,
+			Stop:             req.Stop,
+			FrequencyPenalty: req.FrequencyPenalty,
+			PresencePenalty:  req.PresencePenalty,
+		},
+	}
+
+	if req.UsesTools() {
+		tools, err := json.Marshal(req.Tools)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal tools: %w", err)
+		}
+		result.Tools = tools
+	}
+
+	if req.ResponseFormat != nil && req.ResponseFormat.Type != "text" {
+		result.Format = "json"
+	}
+
+	return result, nil
+}
+
+// toToolCalls converts Ollama tool calls into OpenAI ones. Ollama does not
+// assign call IDs, so they are derived from id and the call's position,
+// which starts at offset. Stream deltas also need the position as index.
+func toToolCalls(calls []toolCall, id string, offset int, indexed bool) []openrouter.ToolCall {
+	if len(calls) == 0 {
+		return nil
+	}
+
+	result := make([]openrouter.ToolCall, len(calls))
+	for i, tc := range calls {
+		args := "{}"
+		if len(tc.Function.Arguments) > 0 {
+			args = string(tc.Function.Arguments)
+		}
+		result[i] = openrouter.ToolCall{
+			ID:   fmt.Sprintf("call_%s_%d", strings.TrimPrefix(id, "chatcmpl-"), offset+i),
+			Type: "function",
+			Function: openrouter.FunctionCall{
+				Name:      tc.Function.Name,
+				Arguments: args,
+			},
+		}
+		if indexed {
+			index := offset + i
+			result[i].Index = &index
+		}
+	}
+	return result
+}
+
+// finishReason maps Ollama's done reason to an OpenAI finish reason
+func finishReason(resp *chatResponse, toolCalls bool) string {
+	switch {
+	case toolCalls:
+		return "tool_calls"
+	case resp.DoneReason == "length":
+		return "length"
+	default:
+		return "stop"
+	}
+}
+
+// toChatResponse converts an /api/chat response into an OpenAI one
+func toChatResponse(resp *chatResponse, id, modelID string) *openrouter.ChatResponse {
+	toolCalls := toToolCalls(resp.Message.ToolCalls, id, 0, false)
+
+	return &openrouter.ChatResponse{
+		ID:      id,
+		Object:  "chat.completion",
+		Created: created(resp),
+		Model:   modelID,
+		Choices: []openrouter.ChatChoice{{
+			Index: 0,
+			Message: openrouter.ChatMessage{
+				Role:      "assistant",
+				Content:   openrouter.TextContent(resp.Message.Content),
+				ToolCalls: toolCalls,
+			},
+			FinishReason:       finishReason(resp, len(toolCalls) > 0),
+			NativeFinishReason: resp.DoneReason,
+		}},
+		Usage: usage(resp),
+	}
+}
+
+// toStreamChunk converts a line of an /api/chat stream into an OpenAI
+// chunk. toolCalls is the number of tool calls on earlier lines; it numbers
+// the new ones and decides the finish reason of the final chunk.
+func toStreamChunk(resp *chatResponse, id, modelID string, first bool, toolCalls int) openrouter.StreamChunk {
+	delta := openrouter.ChatDelta{
+		Content:   resp.Message.Content,
+		ToolCalls: toToolCalls(resp.Message.ToolCalls, id, toolCalls, true),
+	}
+	if first {
+		delta.Role = "assistant"
+	}
+
+	chunk := openrouter.StreamChunk{
+		ID:      id,
+		Object:  "chat.completion.chunk",
+		Created: created(resp),
+		Model:   modelID,
+		Choices: []openrouter.StreamChoice{{
+			Index: 0,
+			Delta: delta,
+		}},
+	}
+
+	if resp.Done {
+		reason := finishReason(resp, toolCalls+len(delta.ToolCalls) > 0)
+		chunk.Choices[0].FinishReason = &reason
+		chunk.Choices[0].NativeFinishReason = resp.DoneReason
+		u := usage(resp)
+		chunk.Usage = &u
+	}
+
+	return chunk
+}
+
+// usage returns the token counts of a final response
+func usage(resp *chatResponse) openrouter.Usage {
+	return openrouter.Usage{
+		PromptTokens:     resp.PromptEvalCount,
+		CompletionTokens: resp.EvalCount,
+		TotalTokens:      resp.PromptEvalCount + resp.EvalCount,
+	}
+}
+
+// created returns the creation time of a response as a Unix timestamp
+func created(resp *chatResponse) int64 {
+	if resp.CreatedAt.IsZero() {
+		return time.Now().Unix()
+	}
+	return resp.CreatedAt.Unix()
+}
+
+// toModel converts an installed model into a model listing. show may be
+// nil when the model's details could not be fetched.
+func toModel(tag tagModel, show *showResponse) openrouter.Model {
+	params, _ := model.ParseParams(tag.Details.ParameterSize)
+	m := openrouter.Model{
+		ID:          tag.Name,
+		Name:        tag.Name,
+		Description: strings.TrimSpace(tag.Details.ParameterSize + " " + tag.Details.QuantizationLevel),
+		Pricing:     openrouter.Pricing{Prompt: "0", Completion: "0"},
+		Architecture: openrouter.Architecture{
+			Modality:         "text->text",
+			InputModalities:  []string{"text"},
+			OutputModalities: []string{"text"},
+			Tokenizer:        tag.Details.Family,
+		},
+		Params: params,
+	}
+
+	if show == nil {
+		return m
+	}
+
+	for _, capability := range show.Capabilities {
+		switch capability {
+		case "tools":
+			m.SupportedParameters = append(m.SupportedParameters, "tools", "tool_choice")
+		case "vision":
+			m.Architecture.Modality = "text+image->text"
+			m.Architecture.InputModalities = append(m.Architecture.InputModalities, "image")
+		}
+	}
+
+	// The context length is stored under the architecture's name, e.g.
+	// llama.context_length
+	for key, value := range show.ModelInfo {
+		if !strings.HasSuffix(key, ".context_length") {
+			continue
+		}
+		if n, ok := value.(float64); ok {
+			m.ContextLength = int(n)
+		}
+	}
+
+	return m
+}
+
+// canChat reports whether a model can serve chat requests. Embedding models
+// lack the completion capability; older servers report no capabilities.
+func canChat(show *showResponse) bool {
+	if show == nil || len(show.Capabilities) == 0 {
+		return true
+	}
+	for _, capability := range show.Capabilities {
+		if capability == "completion" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package ollama
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// tagsResponse is the response from /api/tags
+type tagsResponse struct {
+	Models []tagModel `json:"models"`
+}
+
+// tagModel is a locally installed model
+type tagModel struct {
+	Name    string       `json:"name"`
+	Model   string       `json:"model"`
+	Details modelDetails `json:"details"`
+}
+
+// modelDetails describes an installed model
+type modelDetails struct {
+	Family            string `json:"family"`
+	ParameterSize     string `json:"parameter_size"`
+	QuantizationLevel string `json:"quantization_level"`
+}
+
+// showResponse is the part of the /api/show response used to fill in a
+// model's context length and capabilities
+type showResponse struct {
+	Capabilities []string               `json:"capabilities"`
+	ModelInfo    map[string]interface{} `json:"model_info"`
+}
+
+// chatRequest is the request body of /api/chat
+type chatRequest struct {
+	Model    string          `json:"model"`
+	Messages []message       `json:"messages"`
+	Stream   bool            `json:"stream"`
+	Tools    json.RawMessage `json:"tools,omitempty"`
+	Format   string          `json:"format,omitempty"`
+	Options  *options        `json:"options,omitempty"`
+}
+
+// options are the sampling and runtime options of a chat request
+type options struct {
+	NumCtx           int      `json:"num_ctx,omitempty"`
+	NumPredict       int      `json:"num_predict,omitempty"`
+	Temperature      *float64 `json:"temperature,omitempty"`
+	TopP             *float64 `json:"top_p,omitempty"`
+	TopK             *int     `json:"top_k,omitempty"`
+	Seed             *int     `json:"seed,omitempty"`
+	Stop             []string `json:"stop,omitempty"`
+	FrequencyPenalty float64  `json:"frequency_penalty,omitempty"`
+	PresencePenalty  float64  `json:"presence_penalty,omitempty"`
+}
+
+// message is a chat message in Ollama format. Images are base64 encoded
+// without a data URI prefix, and tool call arguments are JSON objects
+// rather than strings.
+type message struct {
+	Role      string     `json:"role"`
+	Content   string     `json:"content"`
+	Thinking  string     `json:"thinking,omitempty"`
+	Images    []string   `json:"images,omitempty"`
+	ToolCalls []toolCall `json:"tool_calls,omitempty"`
+	ToolName  string     `json:"tool_name,omitempty"`
+}
+
+// toolCall is a tool invocation requested by the model
+type toolCall struct {
+	Function toolFunction `json:"function"`
+}
+
+// toolFunction holds the name and arguments of a tool call
+type toolFunction struct {
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+// chatResponse is the response of /api/chat, and every line of its NDJSON
+// stream. Only the final line has Done set and carries the token counts.
+type chatResponse struct {
+	Model           string    `json:"model"`
+	CreatedAt       time.Time `json:"created_at"`
+	Message         message   `json:"message"`
+	Done            bool      `json:"done"`
+	DoneReason      string    `json:"done_reason"`
+	PromptEvalCount int       `json:"prompt_eval_count"`
+	EvalCount       int       `json:"eval_count"`
+	Error           string    `json:"error,omitempty"`
+}
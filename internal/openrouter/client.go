@@ -9,14 +9,19 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"path"
+	"strings"
 	"sync"
 	"time"
 )
 
 const (
-	baseURL        = "https://openrouter.ai/api"
-	modelsEndpoint = "/v1/models"
-	chatEndpoint   = "/v1/chat/completions"
+	// DefaultName and DefaultBaseURL identify the OpenRouter API
+	DefaultName    = "openrouter"
+	DefaultBaseURL = "https://openrouter.ai/api/v1"
+
+	modelsEndpoint = "/models"
+	chatEndpoint   = "/chat/completions"
 	userAgent      = "frugalai/1.0"
 )
 
@@ -24,6 +29,10 @@ const (
 type HTTPError struct {
 	Code    int
 	Message string
+
+	// RateLimit is the rate limit state from the response headers, nil when
+	// the upstream sent none
+	RateLimit *RateLimit
 }
 
 func (e *HTTPError) Error() string {
@@ -34,6 +43,43 @@ func (e *HTTPError) StatusCode() int {
 	return e.Code
 }
 
+// ErrorDetails is the error object of an OpenRouter error response
+type ErrorDetails struct {
+	Message  string        `json:"message"`
+	Metadata ErrorMetadata `json:"metadata"`
+}
+
+// ErrorMetadata says where an error came from. Errors of the provider
+// serving a model name it; OpenRouter's own rate limits carry their rate
+// limit headers instead.
+type ErrorMetadata struct {
+	ProviderName string            `json:"provider_name"`
+	Headers      map[string]string `json:"headers"`
+}
+
+// Header returns a header of the metadata by case-insensitive name
+func (m ErrorMetadata) Header(name string) string {
+	for k, v := range m.Headers {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return ""
+}
+
+// Details parses the error object of the response body. A body that is not
+// an OpenRouter error, such as the message of a mid-stream error, becomes
+// the message.
+func (e *HTTPError) Details() ErrorDetails {
+	var body struct {
+		Error ErrorDetails `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(e.Message), &body); err != nil || body.Error.Message == "" {
+		return ErrorDetails{Message: e.Message}
+	}
+	return body.Error
+}
+
 // TimeoutError represents a request timeout
 type TimeoutError struct {
 	Duration time.Duration
@@ -47,24 +93,113 @@ func (e *TimeoutError) IsTimeout() bool {
 	return true
 }
 
-// Client represents an OpenRouter API client
+// ConnectionError represents a request that got no response at all, e.g.
+// because the upstream is unreachable
+type ConnectionError struct {
+	Err error
+}
+
+func (e *ConnectionError) Error() string {
+	return fmt.Sprintf("failed to send request: %v", e.Err)
+}
+
+func (e *ConnectionError) Unwrap() error {
+	return e.Err
+}
+
+// StatusCode reports an unreachable upstream as 502 Bad Gateway, so it
+// counts against the model like a server error
+func (e *ConnectionError) StatusCode() int {
+	return http.StatusBadGateway
+}
+
+// Client represents a client for OpenRouter or any other OpenAI-compatible
+// API
 type Client struct {
+	name       string
+	baseURL    string
 	apiKey     string
+	freeModels []string
+	maxContext int
 	httpClient *http.Client
-	cache      *CachedModels
-	cacheMutex sync.RWMutex
-	cacheTTL   time.Duration
+	// streamClient has no overall timeout so long generations are not cut
+	// off; streams are bounded by the caller's context instead
+	streamClient *http.Client
+	cache        *CachedModels
+	cacheMutex   sync.RWMutex
+	cacheTTL     time.Duration
+}
+
+// ClientConfig configures a client
+type ClientConfig struct {
+	// Name identifies the provider (default: openrouter)
+	Name string
+
+	// BaseURL is the API root the /models and /chat/completions endpoints
+	// live under (default: https://openrouter.ai/api/v1)
+	BaseURL string
+
+	// APIKey is sent as a bearer token; local servers may not need one
+	APIKey string
+
+	// CacheTTL is the model cache TTL in seconds
+	CacheTTL int
+
+	// FreeModels lists patterns (e.g. llama-3.*) of model IDs that are free
+	// to use, "*" matching every model. Without patterns a model is free
+	// when its prompt and completion pricing are zero, as OpenRouter
+	// reports them.
+	FreeModels []string
+
+	// ContextLength caps the context length of the listed models, for
+	// servers that report none or more than they serve. 0 keeps the
+	// reported lengths.
+	ContextLength int
 }
 
 // NewClient creates a new OpenRouter client
 func NewClient(apiKey string, cacheTTL int) *Client {
+	return NewClientWithConfig(ClientConfig{
+		APIKey:   apiKey,
+		CacheTTL: cacheTTL,
+	})
+}
+
+// NewClientWithConfig creates a client for OpenRouter or any other
+// OpenAI-compatible API
+func NewClientWithConfig(cfg ClientConfig) *Client {
+	if cfg.Name == "" {
+		cfg.Name = DefaultName
+	}
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = DefaultBaseURL
+	}
+
 	return &Client{
-		apiKey: apiKey,
+		name:       cfg.Name,
+		baseURL:    strings.TrimSuffix(cfg.BaseURL, "/"),
+		apiKey:     cfg.APIKey,
+		freeModels: cfg.FreeModels,
+		maxContext: cfg.ContextLength,
 		httpClient: &http.Client{
 			Timeout: 30 * time.Second,
 		},
-		cacheTTL: time.Duration(cacheTTL) * time.Second,
+		streamClient: &http.Client{},
+		cacheTTL:     time.Duration(cfg.CacheTTL) * time.Second,
+	}
+}
+
+// Name returns the provider name of the client
+func (c *Client) Name() string {
+	return c.name
+}
+
+// setHeaders sets the headers every upstream request carries
+func (c *Client) setHeaders(req *http.Request) {
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
 	}
+	req.Header.Set("User-Agent", userAgent)
 }
 
 // GetModels fetches available models from OpenRouter
@@ -79,13 +214,12 @@ func (c *Client) GetModels() ([]Model, error) {
 	c.cacheMutex.RUnlock()
 
 	// Fetch from API
-	req, err := http.NewRequest("GET", baseURL+modelsEndpoint, nil)
+	req, err := http.NewRequest("GET", c.baseURL+modelsEndpoint, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	req.Header.Set("Authorization", "Bearer "+c.apiKey)
-	req.Header.Set("User-Agent", userAgent)
+	c.setHeaders(req)
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
@@ -96,25 +230,37 @@ func (c *Client) GetModels() ([]Model, error) {
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
 		return nil, &HTTPError{
-			Code:    resp.StatusCode,
-			Message: string(body),
+			Code:      resp.StatusCode,
+			Message:   string(body),
+			RateLimit: ParseRateLimit(resp.Header),
 		}
 	}
 
-	var modelsResp ModelsResponse
-	if err := json.NewDecoder(resp.Body).Decode(&modelsResp); err != nil {
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	models, err := decodeModels(body)
+	if err != nil {
 		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
+	if c.maxContext > 0 {
+		for i := range models {
+			if models[i].ContextLength == 0 || models[i].ContextLength > c.maxContext {
+				models[i].ContextLength = c.maxContext
+			}
+		}
+	}
 
 	// Update cache
 	c.cacheMutex.Lock()
 	c.cache = &CachedModels{
-		Models:    modelsResp.Data,
+		Models:    models,
 		Timestamp: time.Now(),
 	}
 	c.cacheMutex.Unlock()
 
-	return modelsResp.Data, nil
+	return models, nil
 }
 
 // GetFreeModels returns only free models
@@ -136,10 +282,60 @@ func (c *Client) GetFreeModels() ([]Model, error) {
 
 // isFreeModel checks if a model is free
 func (c *Client) isFreeModel(model Model) bool {
+	if len(c.freeModels) > 0 {
+		for _, pattern := range c.freeModels {
+			if pattern == "*" {
+				return true
+			}
+			if ok, _ := path.Match(pattern, model.ID); ok {
+				return true
+			}
+		}
+		return false
+	}
+
 	// Check if pricing is zero (free)
 	return model.Pricing.Prompt == "0" && model.Pricing.Completion == "0"
 }
 
+// decodeModels decodes a model list. OpenRouter and most OpenAI-compatible
+// APIs wrap it in {"data": [...]}, some return a bare array. Missing names
+// default to the ID, and a context_window field is accepted for the
+// context length.
+func decodeModels(body []byte) ([]Model, error) {
+	type compatModel struct {
+		Model
+		ContextWindow int `json:"context_window"`
+	}
+
+	var list []compatModel
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &list); err != nil {
+			return nil, err
+		}
+	} else {
+		var wrapped struct {
+			Data []compatModel `json:"data"`
+		}
+		if err := json.Unmarshal(trimmed, &wrapped); err != nil {
+			return nil, err
+		}
+		list = wrapped.Data
+	}
+
+	models := make([]Model, 0, len(list))
+	for _, m := range list {
+		if m.Name == "" {
+			m.Name = m.ID
+		}
+		if m.ContextLength == 0 {
+			m.ContextLength = m.ContextWindow
+		}
+		models = append(models, m.Model)
+	}
+	return models, nil
+}
+
 // ChatCompletion sends a chat completion request with timeout tracking
 func (c *Client) ChatCompletion(req *ChatRequest) (*ChatResponse, error) {
 	return c.ChatCompletionWithTimeout(req, 10*time.Second)
@@ -156,14 +352,13 @@ func (c *Client) ChatCompletionWithTimeout(req *ChatRequest, timeout time.Durati
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", baseURL+chatEndpoint, bytes.NewReader(body))
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+chatEndpoint, bytes.NewReader(body))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("Authorization", "Bearer "+c.apiKey)
-	httpReq.Header.Set("User-Agent", userAgent)
+	c.setHeaders(httpReq)
 	httpReq.Header.Set("HTTP-Referer", "https://github.com/mosajjal/frugalai")
 
 	resp, err := c.httpClient.Do(httpReq)
@@ -176,15 +371,16 @@ func (c *Client) ChatCompletionWithTimeout(req *ChatRequest, timeout time.Durati
 		if urlErr, ok := err.(*url.Error); ok && urlErr.Timeout() {
 			return nil, &TimeoutError{Duration: timeout}
 		}
-		return nil, fmt.Errorf("failed to send request: %w", err)
+		return nil, &ConnectionError{Err: err}
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
 		return nil, &HTTPError{
-			Code:    resp.StatusCode,
-			Message: string(body),
+			Code:      resp.StatusCode,
+			Message:   string(body),
+			RateLimit: ParseRateLimit(resp.Header),
 		}
 	}
 
@@ -192,12 +388,20 @@ func (c *Client) ChatCompletionWithTimeout(req *ChatRequest, timeout time.Durati
 	if err := json.NewDecoder(resp.Body).Decode(&chatResp); err != nil {
 		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
+	chatResp.RateLimit = ParseRateLimit(resp.Header)
 
 	return &chatResp, nil
 }
 
 // StreamChatCompletion sends a streaming chat completion request
 func (c *Client) StreamChatCompletion(req *ChatRequest) (<-chan StreamChunk, <-chan error) {
+	return c.StreamChatCompletionWithContext(context.Background(), req)
+}
+
+// StreamChatCompletionWithContext sends a streaming chat completion request
+// that is cancelled together with ctx. errChan is closed before chunkChan,
+// so once chunkChan is drained any error is already waiting in errChan.
+func (c *Client) StreamChatCompletionWithContext(ctx context.Context, req *ChatRequest) (<-chan StreamChunk, <-chan error) {
 	chunkChan := make(chan StreamChunk, 10)
 	errChan := make(chan error, 1)
 
@@ -212,20 +416,25 @@ func (c *Client) StreamChatCompletion(req *ChatRequest) (<-chan StreamChunk, <-c
 			return
 		}
 
-		httpReq, err := http.NewRequest("POST", baseURL+chatEndpoint, bytes.NewReader(body))
+		httpReq, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+chatEndpoint, bytes.NewReader(body))
 		if err != nil {
 			errChan <- fmt.Errorf("failed to create request: %w", err)
 			return
 		}
 
 		httpReq.Header.Set("Content-Type", "application/json")
-		httpReq.Header.Set("Authorization", "Bearer "+c.apiKey)
-		httpReq.Header.Set("User-Agent", userAgent)
+		httpReq.Header.Set("Accept", "text/event-stream")
+		c.setHeaders(httpReq)
 		httpReq.Header.Set("HTTP-Referer", "https://github.com/mosajjal/frugalai")
 
-		resp, err := c.httpClient.Do(httpReq)
+		resp, err := c.streamClient.Do(httpReq)
 		if err != nil {
-			errChan <- fmt.Errorf("failed to send request: %w", err)
+			// A cancelled request says nothing about the upstream
+			if ctx.Err() != nil {
+				errChan <- fmt.Errorf("failed to send request: %w", err)
+				return
+			}
+			errChan <- &ConnectionError{Err: err}
 			return
 		}
 		defer resp.Body.Close()
@@ -233,24 +442,54 @@ func (c *Client) StreamChatCompletion(req *ChatRequest) (<-chan StreamChunk, <-c
 		if resp.StatusCode != http.StatusOK {
 			body, _ := io.ReadAll(resp.Body)
 			errChan <- &HTTPError{
-				Code:    resp.StatusCode,
-				Message: string(body),
+				Code:      resp.StatusCode,
+				Message:   string(body),
+				RateLimit: ParseRateLimit(resp.Header),
 			}
 			return
 		}
 
+		// The rate limit headers are delivered with the first chunk
+		rateLimit := ParseRateLimit(resp.Header)
+
 		// Handle SSE stream
-		decoder := json.NewDecoder(resp.Body)
+		reader := newSSEReader(resp.Body)
 		for {
-			var chunk StreamChunk
-			if err := decoder.Decode(&chunk); err != nil {
+			event, err := reader.Next()
+			if err != nil {
 				if err == io.EOF {
-					break
+					return
 				}
+				if ctx.Err() != nil {
+					return
+				}
+				errChan <- fmt.Errorf("failed to read stream: %w", err)
+				return
+			}
+
+			if strings.TrimSpace(event.Data) == streamDone {
+				return
+			}
+
+			var chunk StreamChunk
+			if err := json.Unmarshal([]byte(event.Data), &chunk); err != nil {
 				errChan <- fmt.Errorf("failed to decode chunk: %w", err)
 				return
 			}
-			chunkChan <- chunk
+
+			// Errors after the stream has started arrive as a payload
+			if chunk.Error != nil {
+				errChan <- chunk.Error.HTTPError()
+				return
+			}
+
+			chunk.RateLimit, rateLimit = rateLimit, nil
+
+			select {
+			case chunkChan <- chunk:
+			case <-ctx.Done():
+				return
+			}
 		}
 	}()
 
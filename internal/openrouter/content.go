@@ -0,0 +1,141 @@
+package openrouter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ContentPart is one part of a multimodal message in OpenAI format
+type ContentPart struct {
+	Type     string    `json:"type"`
+	Text     string    `json:"text,omitempty"`
+	ImageURL *ImageURL `json:"image_url,omitempty"`
+
+	// CacheControl marks a prompt caching breakpoint, which OpenRouter
+	// forwards to providers that support it
+	CacheControl *CacheControl `json:"cache_control,omitempty"`
+
+	// Audio and file parts are passed through untouched
+	InputAudio json.RawMessage `json:"input_audio,omitempty"`
+	File       json.RawMessage `json:"file,omitempty"`
+}
+
+// CacheControl is a prompt caching annotation, e.g. {"type": "ephemeral"}
+type CacheControl struct {
+	Type string `json:"type"`
+	TTL  string `json:"ttl,omitempty"`
+}
+
+// ImageURL references an image by URL or by a base64 data URI
+type ImageURL struct {
+	URL    string `json:"url"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// MessageContent is the content of a chat message. On the wire it is either
+// a plain string or, for multimodal messages, an array of content parts.
+type MessageContent struct {
+	Text  string
+	Parts []ContentPart
+}
+
+// TextContent creates plain text message content
+func TextContent(text string) MessageContent {
+	return MessageContent{Text: text}
+}
+
+// PartsContent creates multimodal message content
+func PartsContent(parts []ContentPart) MessageContent {
+	return MessageContent{Parts: parts}
+}
+
+// MarshalJSON encodes the content as a string, or as an array when it has parts
+func (c MessageContent) MarshalJSON() ([]byte, error) {
+	if c.Parts != nil {
+		return json.Marshal(c.Parts)
+	}
+	return json.Marshal(c.Text)
+}
+
+// UnmarshalJSON accepts a string, an array of content parts or null
+func (c *MessageContent) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	*c = MessageContent{}
+
+	switch {
+	case bytes.Equal(data, []byte("null")):
+		return nil
+	case len(data) > 0 && data[0] == '"':
+		return json.Unmarshal(data, &c.Text)
+	case len(data) > 0 && data[0] == '[':
+		c.Parts = []ContentPart{}
+		return json.Unmarshal(data, &c.Parts)
+	default:
+		return fmt.Errorf("message content must be a string or an array, got %s", data)
+	}
+}
+
+// String returns the text of the content, joining text parts with newlines
+func (c MessageContent) String() string {
+	if c.Parts == nil {
+		return c.Text
+	}
+
+	var textParts []string
+	for _, part := range c.Parts {
+		if part.Type == "text" {
+			textParts = append(textParts, part.Text)
+		}
+	}
+	return strings.Join(textParts, "\n")
+}
+
+// IsEmpty reports whether the content has neither text nor parts
+func (c MessageContent) IsEmpty() bool {
+	return c.Text == "" && len(c.Parts) == 0
+}
+
+// HasImages reports whether the content contains an image part
+func (c MessageContent) HasImages() bool {
+	for _, part := range c.Parts {
+		if part.Type == "image_url" {
+			return true
+		}
+	}
+	return false
+}
+
+// prependText returns a copy of the content with text placed before it
+func (c MessageContent) prependText(text string) MessageContent {
+	if c.Parts == nil {
+		if c.Text == "" {
+			return TextContent(text)
+		}
+		return TextContent(text + "\n\n" + c.Text)
+	}
+
+	parts := make([]ContentPart, 0, len(c.Parts)+1)
+	parts = append(parts, ContentPart{Type: "text", Text: text})
+	parts = append(parts, c.Parts...)
+	return PartsContent(parts)
+}
+
+// ParseDataURI splits a base64 data URI into its media type and data. ok is
+// false for regular URLs.
+func ParseDataURI(uri string) (mediaType, data string, ok bool) {
+	rest, found := strings.CutPrefix(uri, "data:")
+	if !found {
+		return "", "", false
+	}
+	meta, data, found := strings.Cut(rest, ",")
+	if !found {
+		return "", "", false
+	}
+	mediaType, isBase64 := strings.CutSuffix(meta, ";base64")
+	if !isBase64 {
+		return "", "", false
+	}
+	return mediaType, data, true
+}
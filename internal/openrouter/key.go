@@ -0,0 +1,127 @@
+package openrouter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const keyEndpoint = "/key"
+
+const (
+	// FreeTierDailyLimit is the published number of free model requests per
+	// day for accounts that never bought credits
+	FreeTierDailyLimit = 50
+
+	// CreditedDailyLimit is the published number of free model requests per
+	// day for accounts that bought credits
+	CreditedDailyLimit = 1000
+
+	// freeQuotaLimit names the daily free model quota in OpenRouter's rate
+	// limit errors
+	freeQuotaLimit = "free-models-per-day"
+)
+
+// KeyInfo describes the API key's credits and limits, as returned by the
+// /api/v1/key endpoint
+type KeyInfo struct {
+	Label string `json:"label"`
+
+	// Limit is the key's credit limit, nil when unlimited
+	Limit *float64 `json:"limit"`
+
+	// LimitRemaining is the credit left under Limit, nil when unlimited
+	LimitRemaining *float64 `json:"limit_remaining"`
+
+	// Usage is the credit spent by the key
+	Usage float64 `json:"usage"`
+
+	// IsFreeTier is set for accounts that never bought credits
+	IsFreeTier bool `json:"is_free_tier"`
+
+	RateLimit *KeyRateLimit `json:"rate_limit,omitempty"`
+}
+
+// KeyRateLimit is the request rate limit of a key
+type KeyRateLimit struct {
+	Requests int    `json:"requests"`
+	Interval string `json:"interval"`
+}
+
+// FreeDailyLimit returns the published number of free model requests the
+// account may make per day. The /key endpoint does not report it, so it
+// follows from the account's tier.
+func (k *KeyInfo) FreeDailyLimit() int {
+	if k.IsFreeTier {
+		return FreeTierDailyLimit
+	}
+	return CreditedDailyLimit
+}
+
+// IsOpenRouter reports whether the client talks to OpenRouter itself, whose
+// key endpoint and daily free model quota other APIs do not have
+func (c *Client) IsOpenRouter() bool {
+	u, err := url.Parse(c.baseURL)
+	if err != nil {
+		return false
+	}
+	host := u.Hostname()
+	return host == "openrouter.ai" || strings.HasSuffix(host, ".openrouter.ai")
+}
+
+// GetKeyInfo fetches the credits and limits of the client's API key
+func (c *Client) GetKeyInfo() (*KeyInfo, error) {
+	req, err := http.NewRequest("GET", c.baseURL+keyEndpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	c.setHeaders(req)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch key info: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, &HTTPError{
+			Code:      resp.StatusCode,
+			Message:   string(body),
+			RateLimit: ParseRateLimit(resp.Header),
+		}
+	}
+
+	var keyResp struct {
+		Data KeyInfo `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&keyResp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &keyResp.Data, nil
+}
+
+// FreeQuotaExhausted reports whether err is OpenRouter rejecting a request
+// because the account's daily free model quota is used up, along with the
+// quota the error reports, 0 when it reports none. A provider's own rate
+// limit names the provider in the error metadata, so it never counts.
+func FreeQuotaExhausted(err error) (int, bool) {
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.Code != http.StatusTooManyRequests {
+		return 0, false
+	}
+
+	details := httpErr.Details()
+	if details.Metadata.ProviderName != "" || !strings.Contains(details.Message, freeQuotaLimit) {
+		return 0, false
+	}
+	limit, _ := strconv.Atoi(details.Metadata.Header("X-RateLimit-Limit"))
+	return limit, true
+}
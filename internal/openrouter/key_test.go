@@ -0,0 +1,86 @@
+package openrouter
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestFreeQuotaExhausted(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		wantLimit int
+		wantOK    bool
+	}{
+		{
+			name: "daily quota with its headers",
+			err: &HTTPError{Code: 429, Message: `{"error":{"message":"Rate limit exceeded: free-models-per-day. Add 10 credits to unlock 1000 free model requests per day","code":429,` +
+				`"metadata":{"headers":{"X-RateLimit-Limit":"50","X-RateLimit-Remaining":"0","X-RateLimit-Reset":"1741305600000"}}}}`},
+			wantLimit: 50,
+			wantOK:    true,
+		},
+		{
+			name:   "daily quota without headers",
+			err:    &HTTPError{Code: 429, Message: `{"error":{"message":"Rate limit exceeded: free-models-per-day","code":429}}`},
+			wantOK: true,
+		},
+		{
+			name:   "mid-stream error message",
+			err:    &HTTPError{Code: 429, Message: "Rate limit exceeded: free-models-per-day"},
+			wantOK: true,
+		},
+		{
+			name:   "wrapped",
+			err:    fmt.Errorf("stream failed: %w", &HTTPError{Code: 429, Message: "Rate limit exceeded: free-models-per-day"}),
+			wantOK: true,
+		},
+		{
+			name: "per-minute limit",
+			err:  &HTTPError{Code: 429, Message: `{"error":{"message":"Rate limit exceeded: free-models-per-min.","code":429}}`},
+		},
+		{
+			name: "provider rate limit quoting the quota",
+			err: &HTTPError{Code: 429, Message: `{"error":{"message":"Provider returned error","code":429,` +
+				`"metadata":{"provider_name":"Chutes","raw":"free-models-per-day"}}}`},
+		},
+		{
+			name: "not a rate limit",
+			err:  &HTTPError{Code: 400, Message: `{"error":{"message":"free-models-per-day","code":400}}`},
+		},
+		{
+			name: "not an HTTP error",
+			err:  errors.New("429 free-models-per-day"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limit, ok := FreeQuotaExhausted(tt.err)
+			if limit != tt.wantLimit || ok != tt.wantOK {
+				t.Errorf("FreeQuotaExhausted() = %d, %v, want %d, %v", limit, ok, tt.wantLimit, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestIsOpenRouter(t *testing.T) {
+	tests := []struct {
+		baseURL string
+		want    bool
+	}{
+		{baseURL: "", want: true},
+		{baseURL: "https://openrouter.ai/api/v1", want: true},
+		{baseURL: "https://eu.openrouter.ai/api/v1/", want: true},
+		{baseURL: "https://api.groq.com/openai/v1"},
+		{baseURL: "http://localhost:8080/v1"},
+		{baseURL: "https://openrouter.ai.example.com/v1"},
+	}
+
+	for _, tt := range tests {
+		c := NewClientWithConfig(ClientConfig{BaseURL: tt.baseURL})
+		if got := c.IsOpenRouter(); got != tt.want {
+			t.Errorf("IsOpenRouter() for %q = %v, want %v", tt.baseURL, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package openrouter
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RateLimit is the rate limit state the upstream reports in the
+// X-RateLimit-* and Retry-After response headers
+type RateLimit struct {
+	// Limit is the number of requests allowed per window, -1 if unknown
+	Limit int
+
+	// Remaining is the number of requests left in the window, -1 if unknown
+	Remaining int
+
+	// Reset is when the window resets, zero if unknown
+	Reset time.Time
+
+	// RetryAfter is how long the upstream asked us to wait before retrying,
+	// zero if it did not say
+	RetryAfter time.Duration
+}
+
+// ParseRateLimit reads the rate limit headers of a response. It returns nil
+// when none of them is present.
+func ParseRateLimit(header http.Header) *RateLimit {
+	rl := &RateLimit{
+		Limit:      headerInt(header, "X-RateLimit-Limit"),
+		Remaining:  headerInt(header, "X-RateLimit-Remaining"),
+		Reset:      parseReset(header.Get("X-RateLimit-Reset")),
+		RetryAfter: parseRetryAfter(header.Get("Retry-After")),
+	}
+	if rl.Limit < 0 && rl.Remaining < 0 && rl.Reset.IsZero() && rl.RetryAfter == 0 {
+		return nil
+	}
+	return rl
+}
+
+// Wait returns how long the upstream wants no further requests: the
+// Retry-After delay, or the time until the window resets once it is used up.
+// It is zero when requests may be sent right away.
+func (rl *RateLimit) Wait() time.Duration {
+	if rl == nil {
+		return 0
+	}
+	if rl.RetryAfter > 0 {
+		return rl.RetryAfter
+	}
+	if rl.Remaining == 0 && !rl.Reset.IsZero() {
+		if d := time.Until(rl.Reset); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// RateLimitOf returns the rate limit carried by an HTTPError in err's
+// chain, or nil
+func RateLimitOf(err error) *RateLimit {
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.RateLimit
+	}
+	return nil
+}
+
+// headerInt parses an integer header, returning -1 when it is absent or
+// malformed
+func headerInt(header http.Header, name string) int {
+	i, err := strconv.Atoi(strings.TrimSpace(header.Get(name)))
+	if err != nil {
+		return -1
+	}
+	return i
+}
+
+// parseReset parses X-RateLimit-Reset. OpenRouter sends a Unix timestamp in
+// milliseconds; Unix seconds, a number of seconds from now and an HTTP date
+// are accepted as well.
+func parseReset(value string) time.Time {
+	value = strings.TrimSpace(value)
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		if date, err := http.ParseTime(value); err == nil {
+			return date
+		}
+		return time.Time{}
+	}
+	if n <= 0 {
+		return time.Time{}
+	}
+	switch {
+	case n > 1e12:
+		return time.UnixMilli(n)
+	case n > 1e9:
+		return time.Unix(n, 0)
+	default:
+		return time.Now().Add(time.Duration(n) * time.Second)
+	}
+}
+
+// parseRetryAfter parses a Retry-After header, which is either a number of
+// seconds or an HTTP date
+func parseRetryAfter(value string) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		// NaN and delays too long for a Duration are garbage
+		if !(seconds > 0) || seconds > math.MaxInt64/float64(time.Second) {
+			return 0
+		}
+		return time.Duration(seconds * float64(time.Second))
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if d := time.Until(date); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
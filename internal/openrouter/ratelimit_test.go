@@ -0,0 +1,117 @@
+package openrouter
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// near reports whether a is within a second of b
+func near(a, b time.Time) bool {
+	d := a.Sub(b)
+	return d > -time.Second && d < time.Second
+}
+
+func TestParseReset(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name  string
+		value string
+		want  time.Time
+	}{
+		{name: "epoch milliseconds", value: "1767225600000", want: time.UnixMilli(1767225600000)},
+		{name: "epoch seconds", value: "1767225600", want: time.Unix(1767225600, 0)},
+		{name: "seconds from now", value: "30", want: now.Add(30 * time.Second)},
+		{name: "RFC 1123 date", value: "Thu, 01 Jan 2026 00:00:00 GMT", want: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "surrounding spaces", value: " 1767225600 ", want: time.Unix(1767225600, 0)},
+		{name: "missing", value: ""},
+		{name: "zero", value: "0"},
+		{name: "negative", value: "-5"},
+		{name: "garbage", value: "soon"},
+		{name: "fraction", value: "1.5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseReset(tt.value)
+			if tt.want.IsZero() != got.IsZero() || !tt.want.IsZero() && !near(got, tt.want) {
+				t.Errorf("parseReset(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  time.Duration
+	}{
+		{name: "seconds", value: "120", want: 2 * time.Minute},
+		{name: "fractional seconds", value: "1.5", want: 1500 * time.Millisecond},
+		{name: "HTTP date", value: time.Now().Add(time.Hour).UTC().Format(http.TimeFormat), want: time.Hour},
+		{name: "HTTP date in the past", value: "Thu, 01 Jan 1970 00:00:00 GMT"},
+		{name: "missing", value: ""},
+		{name: "zero", value: "0"},
+		{name: "negative", value: "-1"},
+		{name: "not a number", value: "NaN"},
+		{name: "too long", value: "1e300"},
+		{name: "garbage", value: "later"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseRetryAfter(tt.value)
+			if d := got - tt.want; d <= -time.Second || d >= time.Second || (tt.want == 0 && got != 0) {
+				t.Errorf("parseRetryAfter(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRateLimit(t *testing.T) {
+	tests := []struct {
+		name   string
+		header map[string]string
+		want   *RateLimit
+	}{
+		{name: "no headers"},
+		{name: "only garbage", header: map[string]string{"X-RateLimit-Limit": "many", "X-RateLimit-Reset": "soon", "Retry-After": "later"}},
+		{
+			name: "OpenRouter headers",
+			header: map[string]string{
+				"X-RateLimit-Limit":     "20",
+				"X-RateLimit-Remaining": "0",
+				"X-RateLimit-Reset":     "1767225600000",
+			},
+			want: &RateLimit{Limit: 20, Remaining: 0, Reset: time.UnixMilli(1767225600000)},
+		},
+		{
+			name:   "only Retry-After",
+			header: map[string]string{"Retry-After": "7"},
+			want:   &RateLimit{Limit: -1, Remaining: -1, RetryAfter: 7 * time.Second},
+		},
+		{
+			name:   "garbage next to a valid header",
+			header: map[string]string{"X-RateLimit-Limit": "many", "X-RateLimit-Remaining": "3"},
+			want:   &RateLimit{Limit: -1, Remaining: 3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			for k, v := range tt.header {
+				header.Set(k, v)
+			}
+			got := ParseRateLimit(header)
+			switch {
+			case tt.want == nil && got != nil:
+				t.Errorf("ParseRateLimit() = %+v, want nil", got)
+			case tt.want != nil && (got == nil || got.Limit != tt.want.Limit || got.Remaining != tt.want.Remaining ||
+				!got.Reset.Equal(tt.want.Reset) || got.RetryAfter != tt.want.RetryAfter):
+				t.Errorf("ParseRateLimit() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
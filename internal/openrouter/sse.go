@@ -0,0 +1,106 @@
+package openrouter
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// streamDone is the data payload that terminates an OpenAI-style stream
+const streamDone = "[DONE]"
+
+// sseEvent is a single dispatched server-sent event
+type sseEvent struct {
+	Event string
+	Data  string
+	ID    string
+}
+
+// sseReader reads server-sent events as described in the WHATWG spec:
+// comment lines (such as OpenRouter's ": OPENROUTER PROCESSING" keep-alives)
+// are skipped, multiple data lines are joined with newlines, and an event is
+// dispatched on every blank line.
+type sseReader struct {
+	r *bufio.Reader
+}
+
+// newSSEReader creates a reader over an event stream body
+func newSSEReader(r io.Reader) *sseReader {
+	return &sseReader{r: bufio.NewReader(r)}
+}
+
+// Next returns the next event with a non-empty data field. It returns
+// io.EOF once the stream ends.
+func (s *sseReader) Next() (*sseEvent, error) {
+	var event sseEvent
+	var data []string
+	hasData := false
+
+	for {
+		line, err := s.r.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if err == io.EOF && line == "" {
+			// Dispatch a trailing event that was not followed by a blank line
+			if hasData {
+				event.Data = strings.Join(data, "\n")
+				return &event, nil
+			}
+			return nil, io.EOF
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		if line == "" {
+			if hasData {
+				event.Data = strings.Join(data, "\n")
+				return &event, nil
+			}
+			event = sseEvent{}
+			continue
+		}
+
+		// Comment line, used for keep-alives
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value := line, ""
+		if idx := strings.IndexByte(line, ':'); idx >= 0 {
+			field, value = line[:idx], strings.TrimPrefix(line[idx+1:], " ")
+		}
+
+		switch field {
+		case "data":
+			data = append(data, value)
+			hasData = true
+		case "event":
+			event.Event = value
+		case "id":
+			event.ID = value
+		}
+	}
+}
+
+// StreamError is an error payload delivered inside an event stream after
+// the upstream has already answered with 200 OK
+type StreamError struct {
+	Code    json.RawMessage `json:"code"`
+	Message string          `json:"message"`
+}
+
+// HTTPError converts the stream error into an HTTPError so callers can
+// treat it like a failed response. Non-numeric codes are reported as 502.
+func (e *StreamError) HTTPError() *HTTPError {
+	code := http.StatusBadGateway
+	if n, err := strconv.Atoi(strings.Trim(string(e.Code), `"`)); err == nil && n > 0 {
+		code = n
+	}
+	return &HTTPError{
+		Code:    code,
+		Message: e.Message,
+	}
+}
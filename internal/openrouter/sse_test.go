@@ -0,0 +1,152 @@
+package openrouter
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSSEReader(t *testing.T) {
+	tests := []struct {
+		name   string
+		stream string
+		want   []sseEvent
+	}{
+		{
+			name:   "comment frames are skipped",
+			stream: ": OPENROUTER PROCESSING\n\ndata: {\"a\":1}\n\n: keep-alive\n\ndata: {\"b\":2}\n\n",
+			want:   []sseEvent{{Data: `{"a":1}`}, {Data: `{"b":2}`}},
+		},
+		{
+			name:   "multi-line data is joined with newlines",
+			stream: "data: first\ndata: second\n\ndata:third\n\n",
+			want:   []sseEvent{{Data: "first\nsecond"}, {Data: "third"}},
+		},
+		{
+			name:   "event and id fields",
+			stream: "event: message\nid: 7\ndata: x\n\n",
+			want:   []sseEvent{{Event: "message", ID: "7", Data: "x"}},
+		},
+		{
+			name:   "events without data are dropped",
+			stream: "event: ping\n\ndata: x\n\n",
+			want:   []sseEvent{{Data: "x"}},
+		},
+		{
+			name:   "CRLF line endings",
+			stream: "data: x\r\n\r\ndata: y\r\n\r\n",
+			want:   []sseEvent{{Data: "x"}, {Data: "y"}},
+		},
+		{
+			name:   "missing trailing blank line",
+			stream: "data: x\n\ndata: last",
+			want:   []sseEvent{{Data: "x"}, {Data: "last"}},
+		},
+		{
+			name:   "done marker is passed through",
+			stream: "data: x\n\ndata: [DONE]\n\n",
+			want:   []sseEvent{{Data: "x"}, {Data: streamDone}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newSSEReader(strings.NewReader(tt.stream))
+			var got []sseEvent
+			for {
+				event, err := r.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("Next() error = %v", err)
+				}
+				got = append(got, *event)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("events = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// streamServer serves body as an event stream to chat completion requests
+func streamServer(t *testing.T, body string) *Client {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(srv.Close)
+	return NewClientWithConfig(ClientConfig{BaseURL: srv.URL, APIKey: "test"})
+}
+
+// drain collects the chunks of a stream and the error it ended with
+func drain(chunks <-chan StreamChunk, errs <-chan error) ([]StreamChunk, error) {
+	var got []StreamChunk
+	for chunk := range chunks {
+		got = append(got, chunk)
+	}
+	return got, <-errs
+}
+
+func TestStreamChatCompletion(t *testing.T) {
+	t.Run("stops at done", func(t *testing.T) {
+		c := streamServer(t, ": OPENROUTER PROCESSING\n\n"+
+			"data: {\"id\":\"gen-1\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Hi\"}}]}\n\n"+
+			"data: [DONE]\n\n"+
+			"data: {\"id\":\"after-done\"}\n\n")
+
+		chunks, err := drain(c.StreamChatCompletion(&ChatRequest{Model: "m"}))
+		if err != nil {
+			t.Fatalf("stream error = %v", err)
+		}
+		if len(chunks) != 1 || chunks[0].ID != "gen-1" {
+			t.Fatalf("chunks = %+v, want only gen-1", chunks)
+		}
+		if got := chunks[0].Choices[0].Delta.Content; got != "Hi" {
+			t.Errorf("content = %v, want Hi", got)
+		}
+	})
+
+	t.Run("mid-stream error payload", func(t *testing.T) {
+		c := streamServer(t,
+			"data: {\"id\":\"gen-1\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Hi\"}}]}\n\n"+
+				"data: {\"id\":\"gen-1\",\"error\":{\"code\":429,\"message\":\"Rate limited\"},\"choices\":[]}\n\n")
+
+		chunks, err := drain(c.StreamChatCompletion(&ChatRequest{Model: "m"}))
+		if len(chunks) != 1 {
+			t.Errorf("got %d chunks before the error, want 1", len(chunks))
+		}
+		var httpErr *HTTPError
+		if !errors.As(err, &httpErr) {
+			t.Fatalf("error = %v, want an HTTPError", err)
+		}
+		if httpErr.Code != 429 || httpErr.Message != "Rate limited" {
+			t.Errorf("error = %d %q, want 429 Rate limited", httpErr.Code, httpErr.Message)
+		}
+	})
+
+	t.Run("non-numeric error code", func(t *testing.T) {
+		c := streamServer(t, "data: {\"error\":{\"code\":\"server_error\",\"message\":\"Provider disconnected\"}}\n\n")
+
+		_, err := drain(c.StreamChatCompletion(&ChatRequest{Model: "m"}))
+		var httpErr *HTTPError
+		if !errors.As(err, &httpErr) || httpErr.Code != http.StatusBadGateway {
+			t.Errorf("error = %v, want a 502 HTTPError", err)
+		}
+	})
+
+	t.Run("stream without trailing blank line", func(t *testing.T) {
+		c := streamServer(t, "data: {\"id\":\"gen-1\",\"choices\":[]}")
+
+		chunks, err := drain(c.StreamChatCompletion(&ChatRequest{Model: "m"}))
+		if err != nil || len(chunks) != 1 {
+			t.Errorf("chunks = %d, error = %v, want 1 chunk and no error", len(chunks), err)
+		}
+	})
+}
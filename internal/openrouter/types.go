@@ -1,14 +1,18 @@
 package openrouter
 
-import "time"
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
 
 // Architecture represents model architecture information
 type Architecture struct {
-	Modality          string   `json:"modality"`
-	InputModalities   []string `json:"input_modalities"`
-	OutputModalities  []string `json:"output_modalities"`
-	Tokenizer         string   `json:"tokenizer"`
-	InstructType      *string  `json:"instruct_type"`
+	Modality         string   `json:"modality"`
+	InputModalities  []string `json:"input_modalities"`
+	OutputModalities []string `json:"output_modalities"`
+	Tokenizer        string   `json:"tokenizer"`
+	InstructType     *string  `json:"instruct_type"`
 }
 
 // Model represents an OpenRouter model
@@ -21,6 +25,54 @@ type Model struct {
 	ContextLength int          `json:"context_length"`
 	Popularity    int          `json:"popularity,omitempty"`
 	Params        int          `json:"params,omitempty"`
+	// PopularityScore is the popularity term of the model's score, between
+	// 0.1 and 1, combined from the popularity sources; 0 when unknown
+	PopularityScore float64 `json:"popularity_score,omitempty"`
+	// ActiveParams is the number of parameters a mixture-of-experts model
+	// uses per token, 0 for dense models or when unknown
+	ActiveParams int `json:"active_params,omitempty"`
+	// QualityTier is a user-assigned quality tier, e.g. "strong"
+	QualityTier string `json:"quality_tier,omitempty"`
+	// Provider is the name of the provider that serves the model
+	Provider string `json:"provider,omitempty"`
+	// SupportedParameters lists the request parameters the model accepts,
+	// e.g. "tools" and "tool_choice"
+	SupportedParameters []string `json:"supported_parameters,omitempty"`
+}
+
+// SupportsParameter reports whether the model advertises the given request parameter
+func (m Model) SupportsParameter(name string) bool {
+	for _, p := range m.SupportedParameters {
+		if p == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ComputeParams returns the parameters the model uses per token: the
+// active parameters of a mixture-of-experts model, otherwise all of them
+func (m Model) ComputeParams() int {
+	if m.ActiveParams > 0 {
+		return m.ActiveParams
+	}
+	return m.Params
+}
+
+// AcceptsInput reports whether the model accepts the given input modality,
+// e.g. "image"
+func (m Model) AcceptsInput(modality string) bool {
+	for _, input := range m.Architecture.InputModalities {
+		if input == modality {
+			return true
+		}
+	}
+	return false
+}
+
+// SupportsTools reports whether the model advertises tool calling
+func (m Model) SupportsTools() bool {
+	return m.SupportsParameter("tools")
 }
 
 // Pricing represents model pricing
@@ -36,22 +88,154 @@ type ModelsResponse struct {
 
 // ChatMessage represents a chat message
 type ChatMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role       string         `json:"role"`
+	Content    MessageContent `json:"content"`
+	Name       string         `json:"name,omitempty"`
+	ToolCalls  []ToolCall     `json:"tool_calls,omitempty"`
+	ToolCallID string         `json:"tool_call_id,omitempty"`
+}
+
+// Tool represents a tool the model may call
+type Tool struct {
+	Type     string             `json:"type"`
+	Function FunctionDefinition `json:"function"`
+}
+
+// FunctionDefinition describes a function tool. Parameters is a JSON schema.
+type FunctionDefinition struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"`
+	Strict      *bool           `json:"strict,omitempty"`
+}
+
+// ToolCall represents a tool invocation requested by the model. In a
+// streaming delta only Index is guaranteed and the arguments arrive in
+// fragments that have to be concatenated.
+type ToolCall struct {
+	Index    *int         `json:"index,omitempty"`
+	ID       string       `json:"id,omitempty"`
+	Type     string       `json:"type,omitempty"`
+	Function FunctionCall `json:"function"`
+}
+
+// FunctionCall holds the name and JSON-encoded arguments of a tool call
+type FunctionCall struct {
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments"`
 }
 
 // ChatRequest represents a chat completion request
 type ChatRequest struct {
 	Model            string          `json:"model"`
 	Messages         []ChatMessage   `json:"messages"`
-	Temperature      float64         `json:"temperature,omitempty"`
+	Temperature      *float64        `json:"temperature,omitempty"`
 	MaxTokens        int             `json:"max_tokens,omitempty"`
-	TopP             float64         `json:"top_p,omitempty"`
+	TopP             *float64        `json:"top_p,omitempty"`
 	Stream           bool            `json:"stream,omitempty"`
 	FrequencyPenalty float64         `json:"frequency_penalty,omitempty"`
 	PresencePenalty  float64         `json:"presence_penalty,omitempty"`
 	Seed             *int            `json:"seed,omitempty"`
 	ResponseFormat   *ResponseFormat `json:"response_format,omitempty"`
+	StreamOptions    *StreamOptions  `json:"stream_options,omitempty"`
+	Stop             StopSequences   `json:"stop,omitempty"`
+	User             string          `json:"user,omitempty"`
+	Tools            []Tool          `json:"tools,omitempty"`
+	// ToolChoice is "none", "auto", "required" or a named function object
+	ToolChoice        interface{} `json:"tool_choice,omitempty"`
+	ParallelToolCalls *bool       `json:"parallel_tool_calls,omitempty"`
+
+	// OpenRouter extensions without an OpenAI equivalent
+	TopK      *int       `json:"top_k,omitempty"`
+	Reasoning *Reasoning `json:"reasoning,omitempty"`
+}
+
+// StopSequences holds the stop parameter, which OpenAI accepts either as a
+// single string or as an array of strings
+type StopSequences []string
+
+// UnmarshalJSON accepts a string, an array of strings or null
+func (s *StopSequences) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*s = StopSequences{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*s = list
+	return nil
+}
+
+// Reasoning configures OpenRouter's unified reasoning tokens
+type Reasoning struct {
+	MaxTokens int    `json:"max_tokens,omitempty"`
+	Effort    string `json:"effort,omitempty"`
+	Exclude   bool   `json:"exclude,omitempty"`
+}
+
+// HasImages reports whether any message of the request contains an image
+func (r *ChatRequest) HasImages() bool {
+	for _, msg := range r.Messages {
+		if msg.Content.HasImages() {
+			return true
+		}
+	}
+	return false
+}
+
+// MergeSystemPrompt returns a copy of the request with its system messages
+// folded into the first user message, for models that reject the system
+// role. The request is returned unchanged when it has no system messages.
+func (r *ChatRequest) MergeSystemPrompt() *ChatRequest {
+	var system []string
+	messages := make([]ChatMessage, 0, len(r.Messages))
+	for _, msg := range r.Messages {
+		if msg.Role == "system" || msg.Role == "developer" {
+			if text := msg.Content.String(); text != "" {
+				system = append(system, text)
+			}
+			continue
+		}
+		messages = append(messages, msg)
+	}
+	if len(messages) == len(r.Messages) {
+		return r
+	}
+
+	merged := *r
+	merged.Messages = messages
+	if len(system) == 0 {
+		return &merged
+	}
+
+	prompt := strings.Join(system, "\n\n")
+	for i, msg := range messages {
+		if msg.Role == "user" {
+			messages[i].Content = msg.Content.prependText(prompt)
+			return &merged
+		}
+	}
+
+	// No user turn to merge into, so the prompt becomes one
+	merged.Messages = append([]ChatMessage{{Role: "user", Content: TextContent(prompt)}}, messages...)
+	return &merged
+}
+
+// UsesTools reports whether the request offers tools the model may call
+func (r *ChatRequest) UsesTools() bool {
+	if len(r.Tools) == 0 {
+		return false
+	}
+	choice, ok := r.ToolChoice.(string)
+	return !ok || choice != "none"
+}
+
+// StreamOptions controls the extra data sent on a streaming response
+type StreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
 }
 
 // ResponseFormat specifies the format of the response
@@ -61,9 +245,13 @@ type ResponseFormat struct {
 
 // ChatChoice represents a choice in the chat response
 type ChatChoice struct {
-	Index        int          `json:"index"`
-	Message      ChatMessage  `json:"message"`
-	FinishReason string       `json:"finish_reason"`
+	Index        int         `json:"index"`
+	Message      ChatMessage `json:"message"`
+	FinishReason string      `json:"finish_reason"`
+	// NativeFinishReason is the provider's own reason, e.g. "stop_sequence"
+	NativeFinishReason string `json:"native_finish_reason,omitempty"`
+	// StopReason is set by vLLM-based providers to the matched stop string
+	StopReason json.RawMessage `json:"stop_reason,omitempty"`
 }
 
 // Usage represents token usage
@@ -81,15 +269,50 @@ type ChatResponse struct {
 	Model   string       `json:"model"`
 	Choices []ChatChoice `json:"choices"`
 	Usage   Usage        `json:"usage"`
+
+	// RateLimit is the rate limit state from the response headers
+	RateLimit *RateLimit `json:"-"`
+}
+
+// ChatDelta is the incremental message carried by a streaming chunk
+type ChatDelta struct {
+	Role      string     `json:"role,omitempty"`
+	Content   string     `json:"content,omitempty"`
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	Refusal   string     `json:"refusal,omitempty"`
+
+	// Reasoning is where OpenRouter streams a reasoning model's thoughts,
+	// ReasoningContent where DeepSeek and vLLM do
+	Reasoning        string          `json:"reasoning,omitempty"`
+	ReasoningContent string          `json:"reasoning_content,omitempty"`
+	ReasoningDetails json.RawMessage `json:"reasoning_details,omitempty"`
 }
 
-// StreamChunk represents a streaming chunk
+// StreamChoice represents a choice in a streaming chunk. FinishReason is
+// null until the final chunk of the choice, as in the OpenAI wire format.
+type StreamChoice struct {
+	Index              int             `json:"index"`
+	Delta              ChatDelta       `json:"delta"`
+	FinishReason       *string         `json:"finish_reason"`
+	NativeFinishReason string          `json:"native_finish_reason,omitempty"`
+	StopReason         json.RawMessage `json:"stop_reason,omitempty"`
+	Logprobs           json.RawMessage `json:"logprobs,omitempty"`
+}
+
+// StreamChunk represents a chat.completion.chunk object
 type StreamChunk struct {
-	ID      string       `json:"id"`
-	Object  string       `json:"object"`
-	Created int64        `json:"created"`
-	Model   string       `json:"model"`
-	Choices []ChatChoice `json:"choices"`
+	ID                string         `json:"id"`
+	Object            string         `json:"object"`
+	Created           int64          `json:"created"`
+	Model             string         `json:"model"`
+	SystemFingerprint string         `json:"system_fingerprint,omitempty"`
+	Choices           []StreamChoice `json:"choices"`
+	Usage             *Usage         `json:"usage,omitempty"`
+	Error             *StreamError   `json:"error,omitempty"`
+
+	// RateLimit is the rate limit state from the response headers. Only the
+	// first chunk of a stream carries it.
+	RateLimit *RateLimit `json:"-"`
 }
 
 // AnthropicMessage represents an Anthropic-style message
@@ -102,28 +325,61 @@ type AnthropicMessage struct {
 type ContentBlock struct {
 	Type string `json:"type"`
 	Text string `json:"text,omitempty"`
+
+	// tool_use blocks
+	ID    string          `json:"id,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+
+	// tool_result blocks
+	ToolUseID string `json:"tool_use_id,omitempty"`
+	Content   string `json:"content,omitempty"`
+	IsError   bool   `json:"is_error,omitempty"`
+
+	// image blocks
+	Source *ImageSource `json:"source,omitempty"`
+}
+
+// ImageSource is the source of an Anthropic image block, either inline
+// base64 data or a URL
+type ImageSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+// AnthropicTool represents a tool definition in Anthropic format
+type AnthropicTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"input_schema"`
 }
 
 // AnthropicRequest represents an Anthropic-style request
 type AnthropicRequest struct {
-	Model     string              `json:"model"`
-	MaxTokens int                 `json:"max_tokens"`
-	Messages  []AnthropicMessage  `json:"messages"`
-	System    string              `json:"system,omitempty"`
-	Temperature float64           `json:"temperature,omitempty"`
-	TopP     float64              `json:"top_p,omitempty"`
-	Stream   bool                 `json:"stream,omitempty"`
+	Model         string             `json:"model"`
+	MaxTokens     int                `json:"max_tokens"`
+	Messages      []AnthropicMessage `json:"messages"`
+	System        string             `json:"system,omitempty"`
+	Temperature   *float64           `json:"temperature,omitempty"`
+	TopP          *float64           `json:"top_p,omitempty"`
+	TopK          *int               `json:"top_k,omitempty"`
+	StopSequences []string           `json:"stop_sequences,omitempty"`
+	Stream        bool               `json:"stream,omitempty"`
+	Tools         []AnthropicTool    `json:"tools,omitempty"`
 }
 
 // AnthropicResponse represents an Anthropic-style response
 type AnthropicResponse struct {
-	ID      string           `json:"id"`
-	Type    string           `json:"type"`
-	Role    string           `json:"role"`
-	Content []ContentBlock   `json:"content"`
-	StopReason string        `json:"stop_reason"`
-	Model      string        `json:"model"`
-	Usage      AnthropicUsage `json:"usage"`
+	ID           string         `json:"id"`
+	Type         string         `json:"type"`
+	Role         string         `json:"role"`
+	Content      []ContentBlock `json:"content"`
+	StopReason   string         `json:"stop_reason"`
+	StopSequence *string        `json:"stop_sequence"`
+	Model        string         `json:"model"`
+	Usage        AnthropicUsage `json:"usage"`
 }
 
 // AnthropicUsage represents Anthropic token usage
@@ -144,17 +400,6 @@ type CachedModels struct {
 	Timestamp time.Time
 }
 
-// ModelManager manages model selection and failover
-type ModelManager struct {
-	Candidates  []Model
-	Current     *Model
-	CurrentIdx  int
-	Failures    map[string]int
-	LastFailure map[string]time.Time
-	Timeouts    map[string]int
-	Burned      map[string]bool
-}
-
 // APIError represents an error response from the API
 type APIError struct {
 	Code    int    `json:"code"`
@@ -169,4 +414,24 @@ type HealthStatus struct {
 	ModelName  string  `json:"model_name,omitempty"`
 	Candidates int     `json:"candidates"`
 	Uptime     float64 `json:"uptime_seconds"`
+
+	// Quota is the account's free model quota, nil until it is known
+	Quota *QuotaStatus `json:"quota,omitempty"`
+}
+
+// QuotaStatus describes the daily free model quota and the credits of the
+// account
+type QuotaStatus struct {
+	DailyLimit     int       `json:"daily_limit"`
+	UsedToday      int       `json:"used_today"`
+	RemainingToday int       `json:"remaining_today"`
+	ResetsAt       time.Time `json:"resets_at"`
+	Throttled      bool      `json:"throttled"`
+	IsFreeTier     bool      `json:"is_free_tier"`
+
+	// Credits, nil when the key has no credit limit
+	CreditLimit     *float64  `json:"credit_limit"`
+	CreditRemaining *float64  `json:"credit_remaining"`
+	CreditUsage     float64   `json:"credit_usage"`
+	LastChecked     time.Time `json:"last_checked"`
 }
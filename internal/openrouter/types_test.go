@@ -0,0 +1,86 @@
+package openrouter
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestToolsRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{
+			name: "tools and a named tool choice",
+			body: `{"model":"m","messages":[{"role":"user","content":"Weather in Paris?"}],` +
+				`"tools":[{"type":"function","function":{"name":"get_weather","description":"Get the weather","parameters":{"type":"object","properties":{"city":{"type":"string"}}},"strict":true}}],` +
+				`"tool_choice":{"type":"function","function":{"name":"get_weather"}},"parallel_tool_calls":false}`,
+		},
+		{
+			name: "tool choice as a string",
+			body: `{"model":"m","messages":[{"role":"user","content":"Hi"}],"tools":[{"type":"function","function":{"name":"get_weather"}}],"tool_choice":"required"}`,
+		},
+		{
+			name: "tool calls and their results",
+			body: `{"model":"m","messages":[` +
+				`{"role":"assistant","content":"","tool_calls":[{"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Paris\"}"}}]},` +
+				`{"role":"tool","content":"Sunny","tool_call_id":"call_1"}]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req ChatRequest
+			if err := json.Unmarshal([]byte(tt.body), &req); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			got, err := json.Marshal(&req)
+			if err != nil {
+				t.Fatalf("Marshal() error = %v", err)
+			}
+
+			var want, roundTripped interface{}
+			json.Unmarshal([]byte(tt.body), &want)
+			json.Unmarshal(got, &roundTripped)
+			if string(mustMarshal(t, want)) != string(mustMarshal(t, roundTripped)) {
+				t.Errorf("round trip =\n%s\nwant\n%s", got, tt.body)
+			}
+		})
+	}
+}
+
+// mustMarshal marshals v, with object keys sorted
+func mustMarshal(t *testing.T, v interface{}) []byte {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestUsesTools(t *testing.T) {
+	tools := []Tool{{Type: "function", Function: FunctionDefinition{Name: "get_weather"}}}
+	tests := []struct {
+		name   string
+		tools  []Tool
+		choice interface{}
+		want   bool
+	}{
+		{name: "no tools", choice: "auto"},
+		{name: "default choice", tools: tools, want: true},
+		{name: "auto", tools: tools, choice: "auto", want: true},
+		{name: "required", tools: tools, choice: "required", want: true},
+		{name: "named function", tools: tools, choice: map[string]interface{}{"type": "function", "function": map[string]interface{}{"name": "get_weather"}}, want: true},
+		{name: "none", tools: tools, choice: "none"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &ChatRequest{Tools: tt.tools, ToolChoice: tt.choice}
+			if got := req.UsesTools(); got != tt.want {
+				t.Errorf("UsesTools() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
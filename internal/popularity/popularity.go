@@ -0,0 +1,225 @@
+package popularity
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Snapshot is a local copy of public usage statistics, such as OpenRouter's
+// model rankings, so popularity is known without network access
+type Snapshot struct {
+	counts map[string]int
+}
+
+// snapshotEntry is a model in a snapshot listing. Rankings data names the
+// model by one of several keys and counts tokens or requests.
+type snapshotEntry struct {
+	ID             string `json:"id"`
+	Slug           string `json:"slug"`
+	ModelPermaslug string `json:"model_permaslug"`
+	Model          string `json:"model"`
+
+	TotalPromptTokens     int `json:"total_prompt_tokens"`
+	TotalCompletionTokens int `json:"total_completion_tokens"`
+	TotalTokens           int `json:"total_tokens"`
+	Tokens                int `json:"tokens"`
+	Count                 int `json:"count"`
+	Requests              int `json:"requests"`
+}
+
+// LoadSnapshot reads a snapshot file. It is either an object of model IDs to
+// counts, or a list of entries, bare or under "data", that name a model by
+// id, slug, model_permaslug or model and count its tokens or requests.
+func LoadSnapshot(path string) (*Snapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read popularity snapshot: %w", err)
+	}
+
+	var counts map[string]int
+	if err := json.Unmarshal(data, &counts); err == nil {
+		return &Snapshot{counts: counts}, nil
+	}
+
+	var entries []snapshotEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		var wrapped struct {
+			Data []snapshotEntry `json:"data"`
+		}
+		if err := json.Unmarshal(data, &wrapped); err != nil {
+			return nil, fmt.Errorf("failed to parse popularity snapshot %s: %w", path, err)
+		}
+		entries = wrapped.Data
+	}
+
+	s := &Snapshot{counts: map[string]int{}}
+	for _, e := range entries {
+		id := firstNonEmpty(e.ID, e.Slug, e.ModelPermaslug, e.Model)
+		if id == "" {
+			continue
+		}
+		s.counts[id] += e.count()
+	}
+	return s, nil
+}
+
+// count returns the tokens of an entry, or its requests when it has none
+func (e snapshotEntry) count() int {
+	if n := e.TotalPromptTokens + e.TotalCompletionTokens; n > 0 {
+		return n
+	}
+	for _, n := range []int{e.TotalTokens, e.Tokens, e.Count, e.Requests} {
+		if n > 0 {
+			return n
+		}
+	}
+	return 0
+}
+
+// Count returns the snapshot's count of a model. Variants such as :free
+// share the count of the base model.
+func (s *Snapshot) Count(modelID string) (int, bool) {
+	if n, ok := s.counts[modelID]; ok {
+		return n, true
+	}
+	n, ok := s.counts[baseID(modelID)]
+	return n, ok
+}
+
+// Usage counts the requests each model served successfully through the
+// proxy. With a file the counts are kept across restarts. It is safe for
+// concurrent use.
+type Usage struct {
+	mu     sync.Mutex
+	counts map[string]int
+	path   string
+	dirty  bool
+}
+
+// NewUsage creates a usage tracker that persists its counts to path, and
+// loads the counts already there. An empty path keeps them in memory only.
+func NewUsage(path string) (*Usage, error) {
+	u := &Usage{counts: map[string]int{}, path: path}
+	if path == "" {
+		return u, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return u, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read usage file: %w", err)
+	}
+	if err := json.Unmarshal(data, &u.counts); err != nil {
+		return nil, fmt.Errorf("failed to parse usage file %s: %w", path, err)
+	}
+	if u.counts == nil {
+		u.counts = map[string]int{}
+	}
+	return u, nil
+}
+
+// Record counts a successful request to a model
+func (u *Usage) Record(modelID string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.counts[modelID]++
+	u.dirty = true
+}
+
+// Count returns the successful requests of a model
+func (u *Usage) Count(modelID string) (int, bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	n, ok := u.counts[modelID]
+	return n, ok
+}
+
+// Save writes the counts to the usage file when they changed since the
+// last save
+func (u *Usage) Save() error {
+	u.mu.Lock()
+	if u.path == "" || !u.dirty {
+		u.mu.Unlock()
+		return nil
+	}
+	data, err := json.MarshalIndent(u.counts, "", "  ")
+	u.dirty = false
+	u.mu.Unlock()
+	if err == nil {
+		err = writeFile(u.path, data)
+	}
+	if err != nil {
+		// Try again on the next save
+		u.mu.Lock()
+		u.dirty = true
+		u.mu.Unlock()
+		return fmt.Errorf("failed to write usage file: %w", err)
+	}
+	return nil
+}
+
+// writeFile writes a temporary file first and renames it to path, so a
+// crash cannot leave a partial file behind
+func writeFile(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// StartSaver saves the counts every interval, and a last time once ctx is
+// cancelled. done is closed after the last save.
+func (u *Usage) StartSaver(ctx context.Context, interval time.Duration) (done <-chan struct{}) {
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				if err := u.Save(); err != nil {
+					log.Printf("[WARN] Could not save usage counts: %v", err)
+				}
+				return
+			case <-ticker.C:
+				if err := u.Save(); err != nil {
+					log.Printf("[WARN] Could not save usage counts: %v", err)
+				}
+			}
+		}
+	}()
+	return finished
+}
+
+// baseID strips the variant of a model ID, e.g. :free
+func baseID(modelID string) string {
+	slash := strings.LastIndex(modelID, "/")
+	if i := strings.LastIndex(modelID, ":"); i > slash && slash >= 0 {
+		return modelID[:i]
+	}
+	return modelID
+}
+
+// firstNonEmpty returns the first of values that is not empty
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
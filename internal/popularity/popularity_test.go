@@ -0,0 +1,148 @@
+package popularity
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadSnapshot(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want map[string]int
+	}{
+		{
+			name: "object of counts",
+			data: `{"meta-llama/llama-3.3-70b-instruct": 1250, "qwen/qwen3-30b-a3b": 830}`,
+			want: map[string]int{"meta-llama/llama-3.3-70b-instruct": 1250, "qwen/qwen3-30b-a3b": 830},
+		},
+		{
+			name: "list of entries",
+			data: `[
+				{"id": "a/one", "total_prompt_tokens": 100, "total_completion_tokens": 20, "requests": 3},
+				{"slug": "b/two", "total_tokens": 50},
+				{"model_permaslug": "c/three", "count": 7},
+				{"model": "a/one", "requests": 5},
+				{"tokens": 99}
+			]`,
+			want: map[string]int{"a/one": 125, "b/two": 50, "c/three": 7},
+		},
+		{
+			name: "entries under data",
+			data: `{"data": [{"slug": "b/two", "tokens": 12}]}`,
+			want: map[string]int{"b/two": 12},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "snapshot.json")
+			if err := os.WriteFile(path, []byte(tt.data), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			s, err := LoadSnapshot(path)
+			if err != nil {
+				t.Fatalf("LoadSnapshot() error = %v", err)
+			}
+			for id, want := range tt.want {
+				if got, ok := s.Count(id); !ok || got != want {
+					t.Errorf("Count(%s) = %d, %v, want %d", id, got, ok, want)
+				}
+			}
+			if len(s.counts) != len(tt.want) {
+				t.Errorf("snapshot has %d models, want %d", len(s.counts), len(tt.want))
+			}
+		})
+	}
+
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	os.WriteFile(path, []byte(`"not a snapshot"`), 0o644)
+	if _, err := LoadSnapshot(path); err == nil {
+		t.Error("LoadSnapshot() accepted an invalid snapshot")
+	}
+	if _, err := LoadSnapshot(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("LoadSnapshot() accepted a missing file")
+	}
+}
+
+func TestSnapshotVariants(t *testing.T) {
+	s := &Snapshot{counts: map[string]int{"a/one": 10, "a/one:free": 3}}
+
+	tests := []struct {
+		id   string
+		want int
+		ok   bool
+	}{
+		{id: "a/one", want: 10, ok: true},
+		{id: "a/one:free", want: 3, ok: true},
+		{id: "a/one:online", want: 10, ok: true},
+		{id: "b/two:free", ok: false},
+		{id: "ollama:a/one", ok: false},
+	}
+	for _, tt := range tests {
+		if got, ok := s.Count(tt.id); got != tt.want || ok != tt.ok {
+			t.Errorf("Count(%s) = %d, %v, want %d, %v", tt.id, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestUsagePersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.json")
+
+	u, err := NewUsage(path)
+	if err != nil {
+		t.Fatalf("NewUsage() error = %v", err)
+	}
+	if err := u.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("Save() without changes wrote the file")
+	}
+
+	u.Record("a/one:free")
+	u.Record("a/one:free")
+	u.Record("b/two:free")
+	if err := u.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	loaded, err := NewUsage(path)
+	if err != nil {
+		t.Fatalf("NewUsage() error = %v", err)
+	}
+	if n, _ := loaded.Count("a/one:free"); n != 2 {
+		t.Errorf("loaded count = %d, want 2", n)
+	}
+	if _, ok := loaded.Count("c/three:free"); ok {
+		t.Error("a model that was never used has a count")
+	}
+
+	os.WriteFile(path, []byte("{"), 0o644)
+	if _, err := NewUsage(path); err == nil {
+		t.Error("NewUsage() accepted a corrupt file")
+	}
+}
+
+func TestStartSaver(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.json")
+	u, _ := NewUsage(path)
+	u.Record("a/one:free")
+
+	ctx, cancel := context.WithCancel(t.Context())
+	done := u.StartSaver(ctx, time.Hour)
+	cancel()
+	<-done
+
+	loaded, err := NewUsage(path)
+	if err != nil {
+		t.Fatalf("NewUsage() error = %v", err)
+	}
+	if n, _ := loaded.Count("a/one:free"); n != 1 {
+		t.Errorf("count saved on shutdown = %d, want 1", n)
+	}
+}
@@ -0,0 +1,215 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/mosajjal/frugalai/internal/ollama"
+	"github.com/mosajjal/frugalai/internal/openrouter"
+)
+
+// Provider is an upstream API that lists models and serves chat completions
+// in OpenAI format
+type Provider interface {
+	// Name identifies the provider, e.g. "openrouter" or "groq"
+	Name() string
+
+	GetModels() ([]openrouter.Model, error)
+	GetFreeModels() ([]openrouter.Model, error)
+	InvalidateCache()
+
+	ChatCompletion(req *openrouter.ChatRequest) (*openrouter.ChatResponse, error)
+	StreamChatCompletionWithContext(ctx context.Context, req *openrouter.ChatRequest) (<-chan openrouter.StreamChunk, <-chan error)
+}
+
+var (
+	_ Provider = (*openrouter.Client)(nil)
+	_ Provider = (*ollama.Client)(nil)
+)
+
+// Registry combines several providers into one. The models of the primary
+// provider keep their IDs; those of the others are prefixed with the
+// provider name, e.g. "groq:llama-3.3-70b-versatile", and requests are
+// routed by that prefix. Fallback providers are routed the same way, but
+// their models are kept out of the candidate list.
+type Registry struct {
+	primary   Provider
+	providers []Provider
+	fallbacks []Provider
+	byName    map[string]Provider
+}
+
+var _ Provider = (*Registry)(nil)
+
+// NewRegistry creates a registry around the primary provider. The primary
+// may be nil, in which case only prefixed model IDs can be routed.
+func NewRegistry(primary Provider) *Registry {
+	r := &Registry{primary: primary, byName: map[string]Provider{}}
+	if primary != nil {
+		r.providers = []Provider{primary}
+		r.byName[primary.Name()] = primary
+	}
+	return r
+}
+
+// Add registers another provider whose free models join the candidate
+// ranking
+func (r *Registry) Add(p Provider) error {
+	if err := r.register(p); err != nil {
+		return err
+	}
+	r.providers = append(r.providers, p)
+	return nil
+}
+
+// AddFallback registers a last-resort provider, e.g. a local server, whose
+// models are listed by GetFallbackModels instead of GetModels
+func (r *Registry) AddFallback(p Provider) error {
+	if err := r.register(p); err != nil {
+		return err
+	}
+	r.fallbacks = append(r.fallbacks, p)
+	return nil
+}
+
+// register makes p routable. Names must be unique and must not contain '/'
+// or ':', so they cannot be confused with model IDs.
+func (r *Registry) register(p Provider) error {
+	name := p.Name()
+	if name == "" || strings.ContainsAny(name, "/:") {
+		return fmt.Errorf("invalid provider name %q", name)
+	}
+	if _, ok := r.byName[name]; ok {
+		return fmt.Errorf("duplicate provider name %q", name)
+	}
+
+	r.byName[name] = p
+	return nil
+}
+
+// Name returns the name of the primary provider, empty without one
+func (r *Registry) Name() string {
+	if r.primary == nil {
+		return ""
+	}
+	return r.primary.Name()
+}
+
+// Providers returns the registered providers, primary first and fallbacks
+// last
+func (r *Registry) Providers() []Provider {
+	return append(append([]Provider{}, r.providers...), r.fallbacks...)
+}
+
+// GetModels returns the models of all providers. A provider that cannot be
+// reached is skipped; an error is only returned when none can.
+func (r *Registry) GetModels() ([]openrouter.Model, error) {
+	return r.collect(r.providers, Provider.GetModels)
+}
+
+// GetFreeModels returns the free models of all providers. A provider that
+// cannot be reached is skipped; an error is only returned when none can.
+func (r *Registry) GetFreeModels() ([]openrouter.Model, error) {
+	return r.collect(r.providers, Provider.GetFreeModels)
+}
+
+// GetFallbackModels returns the free models of the fallback providers, nil
+// when there are none
+func (r *Registry) GetFallbackModels() ([]openrouter.Model, error) {
+	return r.collect(r.fallbacks, Provider.GetFreeModels)
+}
+
+// InvalidateCache invalidates the model caches of all providers
+func (r *Registry) InvalidateCache() {
+	for _, p := range r.Providers() {
+		p.InvalidateCache()
+	}
+}
+
+// ChatCompletion sends a chat completion request to the provider of
+// req.Model
+func (r *Registry) ChatCompletion(req *openrouter.ChatRequest) (*openrouter.ChatResponse, error) {
+	p, upstream := r.route(req)
+	if p == nil {
+		return nil, fmt.Errorf("no provider serves model %s", req.Model)
+	}
+	return p.ChatCompletion(upstream)
+}
+
+// StreamChatCompletionWithContext sends a streaming chat completion request
+// to the provider of req.Model
+func (r *Registry) StreamChatCompletionWithContext(ctx context.Context, req *openrouter.ChatRequest) (<-chan openrouter.StreamChunk, <-chan error) {
+	p, upstream := r.route(req)
+	if p == nil {
+		chunkChan := make(chan openrouter.StreamChunk)
+		errChan := make(chan error, 1)
+		errChan <- fmt.Errorf("no provider serves model %s", req.Model)
+		close(chunkChan)
+		close(errChan)
+		return chunkChan, errChan
+	}
+	return p.StreamChatCompletionWithContext(ctx, upstream)
+}
+
+// Resolve returns the provider serving a model and the model's ID at that
+// provider. The provider is nil when no prefix matches and there is no
+// primary.
+func (r *Registry) Resolve(modelID string) (Provider, string) {
+	name, id, found := strings.Cut(modelID, ":")
+	if found && name != r.Name() {
+		if p, ok := r.byName[name]; ok {
+			return p, id
+		}
+	}
+	return r.primary, modelID
+}
+
+// ServedByPrimary reports whether a model is served by the primary provider
+func (r *Registry) ServedByPrimary(modelID string) bool {
+	p, _ := r.Resolve(modelID)
+	return p != nil && p == r.primary
+}
+
+// route returns the provider of req.Model and a copy of req addressed to
+// the model's ID at that provider
+func (r *Registry) route(req *openrouter.ChatRequest) (Provider, *openrouter.ChatRequest) {
+	p, id := r.Resolve(req.Model)
+	if id == req.Model {
+		return p, req
+	}
+	upstream := *req
+	upstream.Model = id
+	return p, &upstream
+}
+
+// collect lists the models of providers with list, tagging each model with
+// its provider and prefixing the IDs of secondary providers
+func (r *Registry) collect(providers []Provider, list func(Provider) ([]openrouter.Model, error)) ([]openrouter.Model, error) {
+	var result []openrouter.Model
+	var errs []error
+	for _, p := range providers {
+		models, err := list(p)
+		if err != nil {
+			if len(r.byName) > 1 {
+				log.Printf("[WARN] Could not list models of provider %s: %v", p.Name(), err)
+			}
+			errs = append(errs, err)
+			continue
+		}
+		for _, m := range models {
+			m.Provider = p.Name()
+			if p != r.primary {
+				m.ID = p.Name() + ":" + m.ID
+			}
+			result = append(result, m)
+		}
+	}
+
+	if len(errs) > 0 && len(errs) == len(providers) {
+		return nil, errors.Join(errs...)
+	}
+	return result, nil
+}
@@ -0,0 +1,124 @@
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mosajjal/frugalai/internal/openrouter"
+)
+
+// stubProvider lists fixed models and records the model of the last chat
+// request
+type stubProvider struct {
+	name   string
+	models []openrouter.Model
+	asked  string
+}
+
+func (p *stubProvider) Name() string                               { return p.name }
+func (p *stubProvider) GetModels() ([]openrouter.Model, error)     { return p.models, nil }
+func (p *stubProvider) GetFreeModels() ([]openrouter.Model, error) { return p.models, nil }
+func (p *stubProvider) InvalidateCache()                           {}
+func (p *stubProvider) ChatCompletion(req *openrouter.ChatRequest) (*openrouter.ChatResponse, error) {
+	p.asked = req.Model
+	return &openrouter.ChatResponse{Model: req.Model}, nil
+}
+func (p *stubProvider) StreamChatCompletionWithContext(ctx context.Context, req *openrouter.ChatRequest) (<-chan openrouter.StreamChunk, <-chan error) {
+	p.asked = req.Model
+	chunks, errs := make(chan openrouter.StreamChunk), make(chan error)
+	close(chunks)
+	close(errs)
+	return chunks, errs
+}
+
+func TestRegistry(t *testing.T) {
+	primary := &stubProvider{name: "openrouter", models: []openrouter.Model{{ID: "meta-llama/llama-3.3-70b-instruct:free"}}}
+	groq := &stubProvider{name: "groq", models: []openrouter.Model{{ID: "llama-3.3-70b-versatile"}}}
+	local := &stubProvider{name: "ollama", models: []openrouter.Model{{ID: "llama3.2:3b"}}}
+
+	r := NewRegistry(primary)
+	if err := r.Add(groq); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.AddFallback(local); err != nil {
+		t.Fatal(err)
+	}
+
+	free, err := r.GetFreeModels()
+	if err != nil {
+		t.Fatalf("GetFreeModels() error = %v", err)
+	}
+	if len(free) != 2 || free[0].ID != "meta-llama/llama-3.3-70b-instruct:free" || free[1].ID != "groq:llama-3.3-70b-versatile" {
+		t.Errorf("free models = %v, want the primary's and groq's, without the fallback's", free)
+	}
+
+	fallbacks, err := r.GetFallbackModels()
+	if err != nil {
+		t.Fatalf("GetFallbackModels() error = %v", err)
+	}
+	if len(fallbacks) != 1 || fallbacks[0].ID != "ollama:llama3.2:3b" || fallbacks[0].Provider != "ollama" {
+		t.Errorf("fallback models = %v, want ollama:llama3.2:3b", fallbacks)
+	}
+
+	// Requests are routed by prefix, with the prefix stripped; the colons
+	// of Ollama tags and OpenRouter variants are kept
+	for _, tt := range []struct {
+		model string
+		want  *stubProvider
+		id    string
+	}{
+		{model: "ollama:llama3.2:3b", want: local, id: "llama3.2:3b"},
+		{model: "groq:llama-3.3-70b-versatile", want: groq, id: "llama-3.3-70b-versatile"},
+		{model: "meta-llama/llama-3.3-70b-instruct:free", want: primary, id: "meta-llama/llama-3.3-70b-instruct:free"},
+		{model: "unknown:model", want: primary, id: "unknown:model"},
+	} {
+		if _, err := r.ChatCompletion(&openrouter.ChatRequest{Model: tt.model}); err != nil {
+			t.Fatal(err)
+		}
+		if tt.want.asked != tt.id {
+			t.Errorf("%s was sent to %s as %q, want %q", tt.model, tt.want.name, tt.want.asked, tt.id)
+		}
+		if got := r.ServedByPrimary(tt.model); got != (tt.want == primary) {
+			t.Errorf("ServedByPrimary(%s) = %v", tt.model, got)
+		}
+	}
+}
+
+func TestRegistryWithoutPrimary(t *testing.T) {
+	groq := &stubProvider{name: "groq", models: []openrouter.Model{{ID: "llama-3.3-70b-versatile"}}}
+	r := NewRegistry(nil)
+	if err := r.Add(groq); err != nil {
+		t.Fatal(err)
+	}
+
+	free, err := r.GetFreeModels()
+	if err != nil || len(free) != 1 || free[0].ID != "groq:llama-3.3-70b-versatile" {
+		t.Errorf("GetFreeModels() = %v, %v, want groq's model prefixed", free, err)
+	}
+	if _, err := r.ChatCompletion(&openrouter.ChatRequest{Model: "groq:llama-3.3-70b-versatile"}); err != nil || groq.asked != "llama-3.3-70b-versatile" {
+		t.Errorf("ChatCompletion() = %v, sent as %q, want it sent to groq", err, groq.asked)
+	}
+	if r.ServedByPrimary("groq:llama-3.3-70b-versatile") || r.ServedByPrimary("vendor/model") {
+		t.Error("ServedByPrimary() = true without a primary")
+	}
+
+	// A model without a known prefix has nowhere to go
+	if _, err := r.ChatCompletion(&openrouter.ChatRequest{Model: "vendor/model"}); err == nil {
+		t.Error("ChatCompletion() of an unprefixed model succeeded")
+	}
+	chunks, errs := r.StreamChatCompletionWithContext(t.Context(), &openrouter.ChatRequest{Model: "vendor/model"})
+	for range chunks {
+	}
+	if err := <-errs; err == nil {
+		t.Error("StreamChatCompletionWithContext() of an unprefixed model succeeded")
+	}
+}
+
+func TestRegisterNames(t *testing.T) {
+	r := NewRegistry(&stubProvider{name: "openrouter"})
+	for _, name := range []string{"", "a/b", "a:b", "openrouter"} {
+		if err := r.Add(&stubProvider{name: name}); err == nil {
+			t.Errorf("Add(%q) succeeded", name)
+		}
+	}
+}
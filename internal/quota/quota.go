@@ -0,0 +1,227 @@
+package quota
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/mosajjal/frugalai/internal/openrouter"
+)
+
+const (
+	// throttleFraction is the share of the daily quota left at which
+	// requests start being spaced out over the rest of the day
+	throttleFraction = 0.1
+
+	// pollInterval is how often the key's credits and limits are fetched
+	pollInterval = 10 * time.Minute
+)
+
+// Tracker counts the free model requests of the current UTC day against the
+// account's daily quota. OpenRouter does not report how many free requests
+// have been used, so they are counted locally. The quota is the configured
+// one when set, otherwise the one OpenRouter last reported in a quota
+// error, otherwise the published quota of the key's tier. It is safe for
+// concurrent use.
+type Tracker struct {
+	mu sync.Mutex
+
+	// limit is the daily quota in effect, 0 while unknown
+	limit int
+	used  int
+	day   time.Time
+
+	// configured is the quota set by the operator and reported the quota
+	// OpenRouter reported, 0 when unset
+	configured int
+	reported   int
+
+	// next is the earliest time the next request may be sent while the
+	// quota is nearly used up
+	next time.Time
+
+	key     *openrouter.KeyInfo
+	checked time.Time
+}
+
+// Error is returned when a request would exceed the daily quota, or come
+// too soon while the quota is nearly used up
+type Error struct {
+	Limit      int
+	Remaining  int
+	Exhausted  bool
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	if e.Exhausted {
+		return fmt.Sprintf("daily free model quota of %d requests exhausted; it resets at 00:00 UTC, in %v",
+			e.Limit, e.RetryAfter.Round(time.Minute))
+	}
+	return fmt.Sprintf("daily free model quota nearly exhausted (%d of %d requests left); requests are throttled, retry in %v",
+		e.Remaining, e.Limit, e.RetryAfter.Round(time.Second))
+}
+
+// New creates a tracker. The quota is not enforced until key info is known.
+func New() *Tracker {
+	return &Tracker{day: today(time.Now())}
+}
+
+// SetLimit sets the daily quota, in place of the one that follows from the
+// key's tier. 0 clears it.
+func (t *Tracker) SetLimit(limit int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.configured = limit
+	if t.key != nil || limit > 0 {
+		t.setLimit()
+	}
+}
+
+// Update sets the quota from the key's credit status
+func (t *Tracker) Update(info *openrouter.KeyInfo) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.key = info
+	t.checked = time.Now()
+	t.setLimit()
+}
+
+// setLimit puts the configured, reported or published quota in effect.
+// The caller must hold the lock.
+func (t *Tracker) setLimit() {
+	limit, source := t.configured, "configured"
+	switch {
+	case limit > 0:
+	case t.reported > 0:
+		limit, source = t.reported, "reported by OpenRouter"
+	case t.key != nil:
+		limit, source = t.key.FreeDailyLimit(), fmt.Sprintf("free tier: %v", t.key.IsFreeTier)
+	}
+	if limit != t.limit {
+		log.Printf("[INFO] Daily free model quota: %d requests (%s)", limit, source)
+		t.limit = limit
+	}
+}
+
+// Reserve counts a free model request. It returns an *Error instead when the
+// quota is used up, or when it is nearly used up and the request comes
+// before its share of the rest of the day.
+func (t *Tracker) Reserve() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	t.rollover(now)
+
+	if t.limit == 0 {
+		t.used++
+		return nil
+	}
+
+	remaining := t.limit - t.used
+	untilReset := t.day.Add(24 * time.Hour).Sub(now)
+	if remaining <= 0 {
+		return &Error{Limit: t.limit, Exhausted: true, RetryAfter: untilReset}
+	}
+
+	if remaining <= int(math.Ceil(float64(t.limit)*throttleFraction)) {
+		if now.Before(t.next) {
+			return &Error{Limit: t.limit, Remaining: remaining, RetryAfter: t.next.Sub(now)}
+		}
+		t.next = now.Add(untilReset / time.Duration(remaining))
+	}
+
+	t.used++
+	return nil
+}
+
+// MarkExhausted records that the upstream reported the daily quota as used
+// up, e.g. after requests made outside this proxy, along with the quota it
+// reported, 0 if none
+func (t *Tracker) MarkExhausted(limit int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if limit > 0 {
+		t.reported = limit
+		t.setLimit()
+	}
+	t.rollover(time.Now())
+	if t.limit > 0 && t.used < t.limit {
+		log.Printf("[WARN] Upstream reports the daily free model quota as exhausted after %d local requests", t.used)
+		t.used = t.limit
+	}
+}
+
+// Status returns the quota and credit status, or nil while key info is
+// unknown
+func (t *Tracker) Status() *openrouter.QuotaStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.key == nil {
+		return nil
+	}
+
+	now := time.Now()
+	t.rollover(now)
+
+	remaining := t.limit - t.used
+	if remaining < 0 {
+		remaining = 0
+	}
+	return &openrouter.QuotaStatus{
+		DailyLimit:      t.limit,
+		UsedToday:       t.used,
+		RemainingToday:  remaining,
+		ResetsAt:        t.day.Add(24 * time.Hour),
+		Throttled:       remaining > 0 && remaining <= int(math.Ceil(float64(t.limit)*throttleFraction)),
+		IsFreeTier:      t.key.IsFreeTier,
+		CreditLimit:     t.key.Limit,
+		CreditRemaining: t.key.LimitRemaining,
+		CreditUsage:     t.key.Usage,
+		LastChecked:     t.checked,
+	}
+}
+
+// StartPoller fetches the key's credits and limits now and then every
+// pollInterval until ctx is cancelled
+func (t *Tracker) StartPoller(ctx context.Context, client *openrouter.Client) {
+	go func() {
+		for {
+			if info, err := client.GetKeyInfo(); err != nil {
+				log.Printf("[WARN] Could not fetch API key info: %v", err)
+			} else {
+				t.Update(info)
+			}
+
+			timer := time.NewTimer(pollInterval)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+		}
+	}()
+}
+
+// rollover resets the count at UTC midnight. The caller must hold the lock.
+func (t *Tracker) rollover(now time.Time) {
+	if day := today(now); day.After(t.day) {
+		t.day = day
+		t.used = 0
+		t.next = time.Time{}
+	}
+}
+
+// today returns the start of the UTC day of now
+func today(now time.Time) time.Time {
+	return now.UTC().Truncate(24 * time.Hour)
+}
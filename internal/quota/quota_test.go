@@ -0,0 +1,116 @@
+package quota
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/mosajjal/frugalai/internal/openrouter"
+)
+
+// tracker returns a tracker with a daily quota of limit requests, used of
+// them already made today
+func tracker(limit, used int) *Tracker {
+	t := New()
+	t.Update(&openrouter.KeyInfo{IsFreeTier: true})
+	t.limit = limit
+	t.used = used
+	return t
+}
+
+func TestReserve(t *testing.T) {
+	t.Run("unknown quota is not enforced", func(t *testing.T) {
+		tr := New()
+		for i := 0; i < 100; i++ {
+			if err := tr.Reserve(); err != nil {
+				t.Fatalf("Reserve() #%d error = %v", i+1, err)
+			}
+		}
+	})
+
+	t.Run("exhausted", func(t *testing.T) {
+		err := tracker(50, 50).Reserve()
+		var quotaErr *Error
+		if !errors.As(err, &quotaErr) || !quotaErr.Exhausted || quotaErr.RetryAfter <= 0 {
+			t.Errorf("Reserve() error = %v, want an exhausted quota with a retry time", err)
+		}
+	})
+
+	t.Run("throttled near the end", func(t *testing.T) {
+		tr := tracker(50, 46)
+		if err := tr.Reserve(); err != nil {
+			t.Fatalf("first Reserve() error = %v", err)
+		}
+		err := tr.Reserve()
+		var quotaErr *Error
+		if !errors.As(err, &quotaErr) || quotaErr.Exhausted || quotaErr.Remaining != 3 {
+			t.Errorf("second Reserve() error = %v, want a throttled quota with 3 left", err)
+		}
+	})
+
+	t.Run("plenty left", func(t *testing.T) {
+		tr := tracker(50, 10)
+		for i := 0; i < 5; i++ {
+			if err := tr.Reserve(); err != nil {
+				t.Fatalf("Reserve() #%d error = %v", i+1, err)
+			}
+		}
+		if s := tr.Status(); s.UsedToday != 15 || s.RemainingToday != 35 || s.Throttled {
+			t.Errorf("status = %+v, want 15 used and 35 left", s)
+		}
+	})
+}
+
+func TestMarkExhausted(t *testing.T) {
+	tr := tracker(50, 3)
+	tr.MarkExhausted(0)
+	if s := tr.Status(); s.RemainingToday != 0 {
+		t.Errorf("remaining = %d after MarkExhausted, want 0", s.RemainingToday)
+	}
+	if err := tr.Reserve(); err == nil {
+		t.Error("Reserve() succeeded after MarkExhausted")
+	}
+}
+
+func TestLimit(t *testing.T) {
+	t.Run("published quota of the tier", func(t *testing.T) {
+		tr := New()
+		tr.Update(&openrouter.KeyInfo{IsFreeTier: false})
+		if s := tr.Status(); s.DailyLimit != openrouter.CreditedDailyLimit {
+			t.Errorf("limit = %d, want %d", s.DailyLimit, openrouter.CreditedDailyLimit)
+		}
+	})
+
+	t.Run("reported quota replaces the published one", func(t *testing.T) {
+		tr := New()
+		tr.Update(&openrouter.KeyInfo{IsFreeTier: true})
+		tr.MarkExhausted(200)
+		if s := tr.Status(); s.DailyLimit != 200 || s.RemainingToday != 0 {
+			t.Errorf("status = %+v, want an exhausted quota of 200", s)
+		}
+		tr.Update(&openrouter.KeyInfo{IsFreeTier: true})
+		if s := tr.Status(); s.DailyLimit != 200 {
+			t.Errorf("limit = %d after a key update, want 200", s.DailyLimit)
+		}
+	})
+
+	t.Run("configured quota wins", func(t *testing.T) {
+		tr := New()
+		tr.SetLimit(20)
+		tr.Update(&openrouter.KeyInfo{IsFreeTier: true})
+		tr.MarkExhausted(200)
+		if s := tr.Status(); s.DailyLimit != 20 {
+			t.Errorf("limit = %d, want the configured 20", s.DailyLimit)
+		}
+	})
+
+	t.Run("configured quota is enforced before key info", func(t *testing.T) {
+		tr := New()
+		tr.SetLimit(1)
+		if err := tr.Reserve(); err != nil {
+			t.Fatalf("first Reserve() error = %v", err)
+		}
+		if err := tr.Reserve(); err == nil {
+			t.Error("second Reserve() exceeded the configured quota")
+		}
+	})
+}
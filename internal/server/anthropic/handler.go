@@ -6,44 +6,68 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"net/http"
 	"strings"
-	"sync"
 	"time"
 
+	"github.com/mosajjal/frugalai/internal/manager"
 	"github.com/mosajjal/frugalai/internal/model"
 	"github.com/mosajjal/frugalai/internal/openrouter"
+	"github.com/mosajjal/frugalai/internal/popularity"
+	"github.com/mosajjal/frugalai/internal/provider"
+	"github.com/mosajjal/frugalai/internal/quota"
+	"github.com/mosajjal/frugalai/internal/server/dispatch"
 	"github.com/mosajjal/frugalai/internal/server/openai"
 )
 
 // Handler handles Anthropic-compatible API requests
 type Handler struct {
-	selector     *model.Selector
-	client       *openrouter.Client
-	modelManager *openrouter.ModelManager
-	mu           sync.RWMutex
+	selector *model.Selector
+	client   provider.Provider
+	dispatch *dispatch.Dispatcher
 }
 
 // NewHandler creates a new Anthropic-compatible handler (legacy)
-func NewHandler(selector *model.Selector, client *openrouter.Client) *Handler {
+func NewHandler(selector *model.Selector, client provider.Provider) *Handler {
 	return &Handler{
 		selector: selector,
 		client:   client,
+		dispatch: dispatch.New(selector, nil),
 	}
 }
 
 // NewHandlerWithManager creates a new Anthropic-compatible handler with model manager
-func NewHandlerWithManager(selector *model.Selector, client *openrouter.Client, mgr *openrouter.ModelManager) *Handler {
+func NewHandlerWithManager(selector *model.Selector, client provider.Provider, mgr *manager.Manager) *Handler {
 	return &Handler{
-		selector:     selector,
-		client:       client,
-		modelManager: mgr,
+		selector: selector,
+		client:   client,
+		dispatch: dispatch.New(selector, mgr),
 	}
 }
 
+// SetQuota makes the handler count requests to the models applies accepts
+// against the daily free model quota and reject them once it is used up
+func (h *Handler) SetQuota(q *quota.Tracker, applies func(modelID string) bool) {
+	h.dispatch.SetQuota(q, applies)
+}
+
+// SetUsage makes the handler count the successful requests of each model,
+// which the selector ranks popularity with
+func (h *Handler) SetUsage(u *popularity.Usage) {
+	h.dispatch.SetUsage(u)
+}
+
+// SetRouter makes the handler honor the model a request asks for, following
+// the router's aliases and mode. Without a router the proxy always chooses.
+func (h *Handler) SetRouter(r *model.Router) {
+	h.dispatch.SetRouter(r)
+}
+
 // RegisterRoutes registers the Anthropic-compatible routes
 func (h *Handler) RegisterRoutes(mux *http.ServeMux, path string) {
 	mux.HandleFunc(path+"/messages", h.handleMessages)
+	mux.HandleFunc(path+"/messages/count_tokens", h.handleCountTokens)
 }
 
 // handleMessages handles message requests with retry on error
@@ -67,6 +91,12 @@ func (h *Handler) handleMessages(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	constraints, err := h.dispatch.ParseHints(w, r)
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	// Check if streaming
 	stream := false
 	if s, ok := anthropicReq["stream"].(bool); ok {
@@ -74,7 +104,7 @@ func (h *Handler) handleMessages(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if stream {
-		h.handleStream(w, r, anthropicReq)
+		h.handleStream(w, r, anthropicReq, constraints)
 		return
 	}
 
@@ -82,6 +112,7 @@ func (h *Handler) handleMessages(w http.ResponseWriter, r *http.Request) {
 	maxRetries := 3
 	var lastErr error
 	var resp *openrouter.ChatResponse
+	reserved := false
 
 	for attempt := 0; attempt < maxRetries; attempt++ {
 		// Convert to OpenAI format
@@ -91,15 +122,32 @@ func (h *Handler) handleMessages(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		// Get current model - always replace with proxy model
-		modelID := h.getCurrentModelID()
+		// Route the requested model, honoring it where allowed
+		modelID, err := h.dispatch.ModelID(h.dispatch.Requirements(openaiReq, constraints))
+		if err != nil {
+			h.writeRoutingError(w, err)
+			return
+		}
 		openaiReq.Model = modelID
 
-		resp, lastErr = h.client.ChatCompletion(openaiReq)
+		if err := h.dispatch.Pace(r.Context(), openaiReq.Model); err != nil {
+			return
+		}
+		if reserved, err = h.dispatch.ReserveQuota(openaiReq.Model, reserved); err != nil {
+			h.writeQuotaError(w, err)
+			return
+		}
+
+		start := time.Now()
+		resp, lastErr = h.client.ChatCompletion(h.dispatch.PrepareRequest(openaiReq))
 
 		if lastErr == nil {
-			// Success - convert and write response
-			anthropicResp := h.convertToAnthropic(resp)
+			h.dispatch.RecordSuccess(openaiReq.Model, resp.RateLimit, manager.NewSample(start, time.Time{}, resp.Usage.CompletionTokens))
+
+			// Success - convert and write response, reporting the model
+			// that actually answered
+			resp.Model = openaiReq.Model
+			anthropicResp := h.convertToAnthropic(resp, openaiReq.Stop)
 			w.Header().Set("Content-Type", "application/json")
 			w.Header().Set("X-Model-Used", openaiReq.Model)
 			if err := json.NewEncoder(w).Encode(anthropicResp); err != nil {
@@ -111,16 +159,16 @@ func (h *Handler) handleMessages(w http.ResponseWriter, r *http.Request) {
 		// Check if it's a timeout error
 		var timeoutErr *openrouter.TimeoutError
 		if errors.As(lastErr, &timeoutErr) {
-			if h.recordTimeout(openaiReq.Model) {
+			if h.dispatch.RecordTimeout(openaiReq.Model) {
 				log.Printf("[INFO] Model %s timed out, switching (attempt %d/%d)", openaiReq.Model, attempt+1, maxRetries)
 				continue
 			}
 		}
 
 		// Check if error is from API response
-		if apiErr := h.tryParseAPIError(lastErr); apiErr != nil {
+		if apiErr := dispatch.ParseAPIError(lastErr); apiErr != nil {
 			// Record failure and try switching
-			if h.recordFailure(openaiReq.Model, apiErr.Code) {
+			if h.dispatch.RecordFailure(openaiReq.Model, apiErr.Code, lastErr) {
 				log.Printf("[INFO] Retrying with new model (attempt %d/%d)", attempt+1, maxRetries)
 				continue
 			}
@@ -134,144 +182,207 @@ func (h *Handler) handleMessages(w http.ResponseWriter, r *http.Request) {
 	h.writeError(w, http.StatusInternalServerError, fmt.Sprintf("chat completion failed after %d attempts: %v", maxRetries, lastErr))
 }
 
+// handleCountTokens estimates the input tokens of a Messages request for the
+// model the request would currently be routed to
+func (h *Handler) handleCountTokens(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, "failed to read request body")
+		return
+	}
+
+	var anthropicReq map[string]interface{}
+	if err := json.Unmarshal(body, &anthropicReq); err != nil {
+		h.writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+		return
+	}
+
+	openaiReq, err := openai.ConvertAnthropicToOpenAI(anthropicReq)
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, fmt.Sprintf("failed to convert request: %v", err))
+		return
+	}
+
+	constraints, err := h.dispatch.ParseHints(w, r)
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Count with the tokenizer of the model the request would be sent to,
+	// without claiming a half-open model's probe. A prompt too long for every
+	// candidate is still counted.
+	modelID := h.dispatch.CurrentModelID()
+	if mgr := h.dispatch.Manager(); mgr != nil {
+		if m, err := mgr.Peek(h.dispatch.Requirements(openaiReq, constraints)); err == nil && m != nil {
+			modelID = m.ID
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Model-Used", modelID)
+	json.NewEncoder(w).Encode(map[string]int{
+		"input_tokens": h.estimateInputTokens(modelID, openaiReq),
+	})
+}
+
+// estimateInputTokens estimates the input tokens of a request in the
+// tokenizer family of the model it is sent to
+func (h *Handler) estimateInputTokens(modelID string, req *openrouter.ChatRequest) int {
+	var selected openrouter.Model
+	if m, err := h.selector.SelectModelByID(modelID); err == nil {
+		selected = *m
+	}
+	return h.selector.EstimateTokens(selected, h.dispatch.PrepareRequest(req))
+}
+
 // handleStream handles streaming requests
-func (h *Handler) handleStream(w http.ResponseWriter, r *http.Request, anthropicReq map[string]interface{}) {
+func (h *Handler) handleStream(w http.ResponseWriter, r *http.Request, anthropicReq map[string]interface{}, constraints *model.Constraints) {
 	flusher, ok := w.(http.Flusher)
 	if !ok {
 		h.writeError(w, http.StatusInternalServerError, "streaming not supported")
 		return
 	}
 
-	w.Header().Set("Content-Type", "text/event-stream")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-
 	// Convert to OpenAI format
 	openaiReq, err := openai.ConvertAnthropicToOpenAI(anthropicReq)
 	if err != nil {
-		h.writeAnthropicEvent(w, "error", map[string]string{"error": err.Error()})
-		flusher.Flush()
+		h.writeError(w, http.StatusBadRequest, fmt.Sprintf("failed to convert request: %v", err))
 		return
 	}
 
-	// Get current model - always replace with proxy model
-	modelID := h.getCurrentModelID()
+	// Route the requested model, honoring it where allowed
+	modelID, err := h.dispatch.ModelID(h.dispatch.Requirements(openaiReq, constraints))
+	if err != nil {
+		h.writeRoutingError(w, err)
+		return
+	}
 	openaiReq.Model = modelID
 
-	chunkChan, errChan := h.client.StreamChatCompletion(openaiReq)
+	if err := h.dispatch.Pace(r.Context(), openaiReq.Model); err != nil {
+		return
+	}
+	if _, err := h.dispatch.ReserveQuota(openaiReq.Model, false); err != nil {
+		h.writeQuotaError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	// The server's write timeout is meant for ordinary responses; a stream
+	// lasts as long as the generation, bounded by the request's context
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("[DEBUG] Could not clear the write deadline of the stream: %v", err)
+	}
 
-	eventIndex := 0
+	// Usage is needed for message_delta
+	openaiReq.StreamOptions = &openrouter.StreamOptions{IncludeUsage: true}
+
+	start := time.Now()
+	chunkChan, errChan := h.client.StreamChatCompletionWithContext(r.Context(), h.dispatch.PrepareRequest(openaiReq))
+
+	// message_start is sent before the upstream reports usage, so it
+	// carries an estimate of the input tokens
+	state := newStreamState(h, w, flusher, modelID, openaiReq.Stop)
+	state.usage.PromptTokens = h.estimateInputTokens(modelID, openaiReq)
+	var rateLimit *openrouter.RateLimit
+	var firstToken time.Time
 	for {
 		select {
 		case chunk, ok := <-chunkChan:
 			if !ok {
-				h.writeAnthropicEvent(w, "message_stop", map[string]interface{}{"type": "message_stop"})
-				flusher.Flush()
+				// errChan is closed before chunkChan, so a pending error
+				// is always visible here
+				if err := <-errChan; err != nil {
+					status := http.StatusInternalServerError
+					if apiErr := dispatch.ParseAPIError(err); apiErr != nil {
+						h.dispatch.RecordFailure(openaiReq.Model, apiErr.Code, err)
+						status = apiErr.Code
+					}
+					state.fail(status, err.Error())
+					return
+				}
+				h.dispatch.RecordSuccess(openaiReq.Model, rateLimit, manager.NewSample(start, firstToken, state.usage.CompletionTokens))
+				state.finish()
 				return
 			}
-			if len(chunk.Choices) > 0 {
-				h.writeAnthropicStreamEvent(w, chunk.Choices[0].Message.Content, eventIndex)
-				eventIndex++
+			if chunk.RateLimit != nil {
+				rateLimit = chunk.RateLimit
 			}
-			flusher.Flush()
-		case err := <-errChan:
-			if err != nil {
-				// Try to parse as API error
-				if apiErr := h.tryParseAPIError(err); apiErr != nil {
-					h.recordFailure(openaiReq.Model, apiErr.Code)
-				}
-				h.writeAnthropicEvent(w, "error", map[string]string{"error": err.Error()})
-				flusher.Flush()
-				return
+			if firstToken.IsZero() && len(chunk.Choices) > 0 {
+				firstToken = time.Now()
 			}
+			state.handleChunk(chunk)
 		case <-r.Context().Done():
 			return
 		}
 	}
 }
 
-// getCurrentModelID gets the current model ID from model manager
-func (h *Handler) getCurrentModelID() string {
-	if h.modelManager != nil && h.modelManager.Current != nil {
-		return h.modelManager.Current.ID
-	}
-	// Fallback to selector
-	if id, err := h.selector.GetBestModelID(); err == nil {
-		return id
-	}
-	return ""
-}
-
-// tryParseAPIError attempts to parse an error as an API error
-func (h *Handler) tryParseAPIError(err error) *openrouter.APIError {
-	type httpError interface {
-		StatusCode() int
-	}
-
-	if he, ok := err.(httpError); ok {
-		return &openrouter.APIError{
-			Code:    he.StatusCode(),
-			Message: err.Error(),
-		}
-	}
-
-	errStr := err.Error()
-	if strings.Contains(errStr, "status ") {
-		parts := strings.Split(errStr, "status ")
-		if len(parts) > 1 {
-			var code int
-			fmt.Sscanf(parts[1], "%d", &code)
-			if code > 0 {
-				return &openrouter.APIError{
-					Code:    code,
-					Message: errStr,
-				}
-			}
-		}
-	}
-
-	return nil
-}
-
 // writeAnthropicEvent writes an Anthropic-style server-sent event
 func (h *Handler) writeAnthropicEvent(w http.ResponseWriter, eventType string, data interface{}) {
 	jsonData, _ := json.Marshal(data)
 	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", eventType, jsonData)
 }
 
-// writeAnthropicStreamEvent writes a content block delta event
-func (h *Handler) writeAnthropicStreamEvent(w http.ResponseWriter, content string, index int) {
-	delta := map[string]interface{}{
-		"type":  "content_block_delta",
-		"index": index,
-		"delta": map[string]string{
-			"type": "text_delta",
-			"text": content,
-		},
+// convertToAnthropic converts OpenRouter response to Anthropic format. stops
+// are the request's stop sequences, used to report a stop_sequence stop.
+func (h *Handler) convertToAnthropic(resp *openrouter.ChatResponse, stops []string) openrouter.AnthropicResponse {
+	content := []openrouter.ContentBlock{}
+	finishReason := ""
+	hasToolCalls := false
+	var stopSequence *string
+	matchedStop := false
+	if len(resp.Choices) > 0 {
+		choice := resp.Choices[0]
+		message := choice.Message
+		finishReason = choice.FinishReason
+
+		if seq, ok := matchStopSequence(finishReason, choice.NativeFinishReason, choice.StopReason, message.Content.String(), stops); ok {
+			matchedStop = true
+			if seq != "" {
+				stopSequence = &seq
+			}
+		}
+
+		if text := message.Content.String(); text != "" || len(message.ToolCalls) == 0 {
+			content = append(content, openrouter.ContentBlock{
+				Type: "text",
+				Text: text,
+			})
+		}
+		for _, tc := range message.ToolCalls {
+			content = append(content, openrouter.ContentBlock{
+				Type:  "tool_use",
+				ID:    tc.ID,
+				Name:  tc.Function.Name,
+				Input: toolInput(tc.Function.Arguments),
+			})
+		}
+		hasToolCalls = len(message.ToolCalls) > 0
 	}
-	h.writeAnthropicEvent(w, "content_block_delta", delta)
-}
 
-// convertToAnthropic converts OpenRouter response to Anthropic format
-func (h *Handler) convertToAnthropic(resp *openrouter.ChatResponse) openrouter.AnthropicResponse {
-	content := ""
-	if len(resp.Choices) > 0 {
-		content = resp.Choices[0].Message.Content
+	reason := stopReason(finishReason, hasToolCalls)
+	if matchedStop {
+		reason = "stop_sequence"
 	}
 
 	return openrouter.AnthropicResponse{
-		ID:         resp.ID,
-		Type:       "message",
-		Role:       "assistant",
-		Content: []openrouter.ContentBlock{
-			{
-				Type: "text",
-				Text: content,
-			},
-		},
-		StopReason: "end_turn",
-		Model:      resp.Model,
+		ID:           resp.ID,
+		Type:         "message",
+		Role:         "assistant",
+		Content:      content,
+		StopReason:   reason,
+		StopSequence: stopSequence,
+		Model:        resp.Model,
 		Usage: openrouter.AnthropicUsage{
 			InputTokens:  resp.Usage.PromptTokens,
 			OutputTokens: resp.Usage.CompletionTokens,
@@ -279,10 +390,20 @@ func (h *Handler) convertToAnthropic(resp *openrouter.ChatResponse) openrouter.A
 	}
 }
 
-// InvalidateCache invalidates the cached model ID
+// toolInput converts JSON-encoded tool call arguments into a tool_use input
+// object. Anthropic clients require an object, so anything else (including
+// truncated JSON from a length-limited response) becomes an empty object.
+func toolInput(arguments string) json.RawMessage {
+	var input map[string]interface{}
+	if err := json.Unmarshal([]byte(arguments), &input); err != nil || input == nil {
+		return json.RawMessage("{}")
+	}
+	return json.RawMessage(arguments)
+}
+
+// InvalidateCache invalidates the cached model list
 func (h *Handler) InvalidateCache() {
-	h.mu.Lock()
-	defer h.mu.Unlock()
+	h.client.InvalidateCache()
 }
 
 // writeError writes an Anthropic-style error response
@@ -300,6 +421,43 @@ func (h *Handler) writeError(w http.ResponseWriter, status int, message string)
 	json.NewEncoder(w).Encode(errorResp)
 }
 
+// writeQuotaError writes a 429 rate_limit_error for a request rejected by
+// the daily free model quota
+func (h *Handler) writeQuotaError(w http.ResponseWriter, err error) {
+	var quotaErr *quota.Error
+	if errors.As(err, &quotaErr) {
+		w.Header().Set("Retry-After", fmt.Sprintf("%.0f", math.Ceil(quotaErr.RetryAfter.Seconds())))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"type": "error",
+		"error": map[string]interface{}{
+			"type":    "rate_limit_error",
+			"message": err.Error(),
+		},
+	})
+}
+
+// writeRoutingError writes the error for a request that could not be routed
+// to any model. Context overflows are reported like Anthropic does, and
+// requests whose routing hints no model meets as invalid requests.
+func (h *Handler) writeRoutingError(w http.ResponseWriter, err error) {
+	var overflow *model.ContextOverflowError
+	if errors.As(err, &overflow) {
+		h.writeError(w, http.StatusBadRequest, fmt.Sprintf("prompt plus max_tokens exceeds the context window: %d + %d tokens > %d maximum",
+			overflow.PromptTokens, overflow.CompletionTokens, overflow.MaxContext))
+		return
+	}
+	var constraint *model.ConstraintError
+	if errors.As(err, &constraint) {
+		h.writeError(w, http.StatusBadRequest, constraint.Error())
+		return
+	}
+	h.writeError(w, http.StatusInternalServerError, err.Error())
+}
+
 // ConvertOpenAIToAnthropic converts OpenAI format to Anthropic format
 func ConvertOpenAIToAnthropic(openaiReq *openrouter.ChatRequest) *openrouter.AnthropicRequest {
 	req := &openrouter.AnthropicRequest{
@@ -307,18 +465,55 @@ func ConvertOpenAIToAnthropic(openaiReq *openrouter.ChatRequest) *openrouter.Ant
 		MaxTokens:     openaiReq.MaxTokens,
 		Temperature:   openaiReq.Temperature,
 		TopP:          openaiReq.TopP,
+		TopK:          openaiReq.TopK,
+		StopSequences: openaiReq.Stop,
 		Stream:        openaiReq.Stream,
 	}
 
+	for _, tool := range openaiReq.Tools {
+		schema := tool.Function.Parameters
+		if len(schema) == 0 {
+			schema = json.RawMessage(`{"type":"object"}`)
+		}
+		req.Tools = append(req.Tools, openrouter.AnthropicTool{
+			Name:        tool.Function.Name,
+			Description: tool.Function.Description,
+			InputSchema: schema,
+		})
+	}
+
 	for _, msg := range openaiReq.Messages {
-		anthropicMsg := openrouter.AnthropicMessage{
-			Role: msg.Role,
-			Content: []openrouter.ContentBlock{
-				{
-					Type: "text",
-					Text: msg.Content,
+		// Tool results are sent back by the user in Anthropic format
+		if msg.Role == "tool" {
+			req.Messages = append(req.Messages, openrouter.AnthropicMessage{
+				Role: "user",
+				Content: []openrouter.ContentBlock{
+					{
+						Type:      "tool_result",
+						ToolUseID: msg.ToolCallID,
+						Content:   msg.Content.String(),
+					},
 				},
-			},
+			})
+			continue
+		}
+
+		anthropicMsg := openrouter.AnthropicMessage{
+			Role:    msg.Role,
+			Content: contentBlocks(msg.Content),
+		}
+		if len(anthropicMsg.Content) == 0 && len(msg.ToolCalls) == 0 {
+			anthropicMsg.Content = append(anthropicMsg.Content, openrouter.ContentBlock{
+				Type: "text",
+			})
+		}
+		for _, tc := range msg.ToolCalls {
+			anthropicMsg.Content = append(anthropicMsg.Content, openrouter.ContentBlock{
+				Type:  "tool_use",
+				ID:    tc.ID,
+				Name:  tc.Function.Name,
+				Input: toolInput(tc.Function.Arguments),
+			})
 		}
 		req.Messages = append(req.Messages, anthropicMsg)
 	}
@@ -326,6 +521,48 @@ func ConvertOpenAIToAnthropic(openaiReq *openrouter.ChatRequest) *openrouter.Ant
 	return req
 }
 
+// contentBlocks converts OpenAI message content to Anthropic text and image
+// blocks. Data URIs become base64 sources, anything else a URL source.
+func contentBlocks(content openrouter.MessageContent) []openrouter.ContentBlock {
+	if content.Parts == nil {
+		if content.Text == "" {
+			return nil
+		}
+		return []openrouter.ContentBlock{{Type: "text", Text: content.Text}}
+	}
+
+	var blocks []openrouter.ContentBlock
+	for _, part := range content.Parts {
+		switch part.Type {
+		case "text":
+			blocks = append(blocks, openrouter.ContentBlock{
+				Type: "text",
+				Text: part.Text,
+			})
+		case "image_url":
+			if part.ImageURL == nil {
+				continue
+			}
+			source := &openrouter.ImageSource{
+				Type: "url",
+				URL:  part.ImageURL.URL,
+			}
+			if mediaType, data, ok := openrouter.ParseDataURI(part.ImageURL.URL); ok {
+				source = &openrouter.ImageSource{
+					Type:      "base64",
+					MediaType: mediaType,
+					Data:      data,
+				}
+			}
+			blocks = append(blocks, openrouter.ContentBlock{
+				Type:   "image",
+				Source: source,
+			})
+		}
+	}
+	return blocks
+}
+
 // IsAnthropicRequest checks if the request is in Anthropic format
 func IsAnthropicRequest(r *http.Request) bool {
 	if r.Header.Get("anthropic-version") != "" || r.Header.Get("anthropic-api-version") != "" {
@@ -353,82 +590,3 @@ func IsAnthropicRequest(r *http.Request) bool {
 
 	return false
 }
-
-// recordFailure records a model failure and potentially switches models
-func (h *Handler) recordFailure(modelID string, statusCode int) bool {
-	if h.modelManager == nil {
-		return false
-	}
-
-	h.mu.Lock()
-	defer h.mu.Unlock()
-
-	h.modelManager.Failures[modelID]++
-	h.modelManager.LastFailure[modelID] = time.Now()
-
-	log.Printf("[WARN] Model %s failed (status %d), failure count: %d",
-		modelID, statusCode, h.modelManager.Failures[modelID])
-
-	// Switch on rate limit, server error, or 3+ failures
-	shouldSwitch := statusCode == 429 || statusCode >= 500 || h.modelManager.Failures[modelID] >= 3
-
-	if shouldSwitch && len(h.modelManager.Candidates) > 1 {
-		return h.switchToNextModel()
-	}
-
-	return false
-}
-
-// recordTimeout records a model timeout and potentially burns/switches it
-func (h *Handler) recordTimeout(modelID string) bool {
-	if h.modelManager == nil {
-		return false
-	}
-
-	h.mu.Lock()
-	defer h.mu.Unlock()
-
-	h.modelManager.Timeouts[modelID]++
-
-	log.Printf("[WARN] Model %s timed out, timeout count: %d",
-		modelID, h.modelManager.Timeouts[modelID])
-
-	// Burn model on first timeout
-	h.modelManager.Burned[modelID] = true
-	log.Printf("[WARN] Model %s burned after %d timeouts",
-		modelID, h.modelManager.Timeouts[modelID])
-
-	if len(h.modelManager.Candidates) > 1 {
-		return h.switchToNextModel()
-	}
-
-	return false
-}
-
-// switchToNextModel switches to the next available non-burned model
-func (h *Handler) switchToNextModel() bool {
-	for i := 1; i < len(h.modelManager.Candidates); i++ {
-		nextIdx := (h.modelManager.CurrentIdx + i) % len(h.modelManager.Candidates)
-		nextModel := h.modelManager.Candidates[nextIdx]
-
-		// Skip burned models
-		if h.modelManager.Burned[nextModel.ID] {
-			continue
-		}
-
-		// Skip models with 3+ recent failures
-		if h.modelManager.Failures[nextModel.ID] >= 3 {
-			continue
-		}
-
-		log.Printf("[INFO] Switching from %s to %s",
-			h.modelManager.Current.ID, nextModel.ID)
-
-		h.modelManager.Current = &nextModel
-		h.modelManager.CurrentIdx = nextIdx
-		return true
-	}
-
-	log.Printf("[WARN] No alternative models available")
-	return false
-}
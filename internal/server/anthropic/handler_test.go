@@ -0,0 +1,131 @@
+package anthropic
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mosajjal/frugalai/internal/config"
+	"github.com/mosajjal/frugalai/internal/manager"
+	"github.com/mosajjal/frugalai/internal/model"
+	"github.com/mosajjal/frugalai/internal/openrouter"
+	"github.com/mosajjal/frugalai/internal/tokenizer"
+)
+
+// fakeProvider lists fixed models and streams fixed chunks
+type fakeProvider struct {
+	models []openrouter.Model
+	chunks []openrouter.StreamChunk
+}
+
+func (p *fakeProvider) Name() string                               { return "fake" }
+func (p *fakeProvider) GetModels() ([]openrouter.Model, error)     { return p.models, nil }
+func (p *fakeProvider) GetFreeModels() ([]openrouter.Model, error) { return p.models, nil }
+func (p *fakeProvider) InvalidateCache()                           {}
+
+func (p *fakeProvider) ChatCompletion(req *openrouter.ChatRequest) (*openrouter.ChatResponse, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (p *fakeProvider) StreamChatCompletionWithContext(ctx context.Context, req *openrouter.ChatRequest) (<-chan openrouter.StreamChunk, <-chan error) {
+	chunkChan := make(chan openrouter.StreamChunk, len(p.chunks))
+	errChan := make(chan error, 1)
+	for _, chunk := range p.chunks {
+		chunkChan <- chunk
+	}
+	close(errChan)
+	close(chunkChan)
+	return chunkChan, errChan
+}
+
+// testHandler returns a handler over p whose candidates are p's models
+func testHandler(p *fakeProvider) *Handler {
+	mgr := manager.New()
+	mgr.SetCandidates(p.models, 0)
+	return NewHandlerWithManager(model.NewSelector(p, &config.Config{}), p, mgr)
+}
+
+func TestStreamEstimatesInputTokens(t *testing.T) {
+	p := &fakeProvider{models: []openrouter.Model{{ID: "a/one:free", ContextLength: 8192}}}
+	for _, c := range []string{
+		`{"id":"gen-1","choices":[{"index":0,"delta":{"role":"assistant","content":"Hello"}}]}`,
+		`{"id":"gen-1","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`,
+		`{"id":"gen-1","choices":[],"usage":{"prompt_tokens":21,"completion_tokens":1}}`,
+	} {
+		var chunk openrouter.StreamChunk
+		if err := json.Unmarshal([]byte(c), &chunk); err != nil {
+			t.Fatalf("invalid chunk %s: %v", c, err)
+		}
+		p.chunks = append(p.chunks, chunk)
+	}
+
+	rec := httptest.NewRecorder()
+	body := `{"model":"claude-sonnet-4","max_tokens":100,"stream":true,"messages":[{"role":"user","content":"What is the capital of France?"}]}`
+	testHandler(p).handleMessages(rec, httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(body)))
+
+	_, frame, _ := strings.Cut(rec.Body.String(), "data: ")
+	frame, _, _ = strings.Cut(frame, "\n")
+	var start struct {
+		Message struct {
+			Usage openrouter.AnthropicUsage `json:"usage"`
+		} `json:"message"`
+	}
+	if err := json.Unmarshal([]byte(frame), &start); err != nil {
+		t.Fatalf("invalid message_start %s: %v", frame, err)
+	}
+	if start.Message.Usage.InputTokens <= 0 {
+		t.Errorf("message_start = %s, want estimated input tokens", frame)
+	}
+	if !strings.Contains(rec.Body.String(), `"input_tokens":21`) {
+		t.Errorf("message_delta does not report the upstream's input tokens:\n%s", rec.Body.String())
+	}
+}
+
+func TestCountTokens(t *testing.T) {
+	gpt := openrouter.Model{ID: "a/one:free", ContextLength: 8192}
+	gpt.Architecture.Tokenizer = "GPT"
+	h := testHandler(&fakeProvider{models: []openrouter.Model{gpt}})
+
+	count := func(method, body string) (*httptest.ResponseRecorder, int) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		h.handleCountTokens(rec, httptest.NewRequest(method, "/v1/messages/count_tokens", strings.NewReader(body)))
+		var resp struct {
+			InputTokens int `json:"input_tokens"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec, resp.InputTokens
+	}
+
+	short := `{"model":"claude-sonnet-4","messages":[{"role":"user","content":"Hi"}]}`
+	rec, shortTokens := count(http.MethodPost, short)
+	if rec.Code != http.StatusOK || rec.Header().Get("X-Model-Used") != gpt.ID {
+		t.Fatalf("response = %d from %q, want a 200 from %s", rec.Code, rec.Header().Get("X-Model-Used"), gpt.ID)
+	}
+	req := &openrouter.ChatRequest{Messages: []openrouter.ChatMessage{{Role: "user", Content: openrouter.TextContent("Hi")}}}
+	if want := tokenizer.EstimateRequest(req, "GPT"); shortTokens != want {
+		t.Errorf("input_tokens = %d, want %d as estimated for the model's tokenizer family", shortTokens, want)
+	}
+
+	long := `{"model":"claude-sonnet-4","system":"You are a helpful assistant.","messages":[{"role":"user","content":"Hi"},` +
+		`{"role":"assistant","content":"Hello! How can I help?"},{"role":"user","content":"Tell me about the weather in Paris."}]}`
+	if _, longTokens := count(http.MethodPost, long); longTokens <= shortTokens {
+		t.Errorf("input_tokens = %d for a longer conversation, want more than %d", longTokens, shortTokens)
+	}
+
+	for _, tt := range []struct {
+		method, body string
+		want         int
+	}{
+		{http.MethodGet, "", http.StatusMethodNotAllowed},
+		{http.MethodPost, "{", http.StatusBadRequest},
+	} {
+		if rec, _ := count(tt.method, tt.body); rec.Code != tt.want {
+			t.Errorf("%s %q = %d, want %d", tt.method, tt.body, rec.Code, tt.want)
+		}
+	}
+}
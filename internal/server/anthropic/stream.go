@@ -0,0 +1,316 @@
+package anthropic
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/mosajjal/frugalai/internal/openrouter"
+)
+
+// streamState translates OpenAI-style chunks into the Anthropic Messages
+// event sequence:
+//
+//	message_start
+//	content_block_start / content_block_delta... / content_block_stop
+//	(repeated for each text or tool_use block)
+//	message_delta (stop_reason, usage)
+//	message_stop
+//
+// Nothing is written until the first chunk arrives, so errors that occur
+// before the upstream starts answering can still be sent as a plain HTTP
+// error response.
+type streamState struct {
+	h       *Handler
+	w       http.ResponseWriter
+	flusher http.Flusher
+
+	started    bool
+	id         string
+	model      string
+	blockOpen  bool
+	blockIndex int
+	blockType  string
+	stopReason string
+	usage      openrouter.Usage
+
+	// stop sequences of the request, the one that ended the message and
+	// enough trailing text to recognise it
+	stops        []string
+	stopSequence *string
+	tail         string
+
+	// upstream index and ID of the tool call in the open tool_use block
+	toolIndex  int
+	toolID     string
+	sawToolUse bool
+}
+
+// newStreamState creates the translation state for a single response
+func newStreamState(h *Handler, w http.ResponseWriter, flusher http.Flusher, modelID string, stops []string) *streamState {
+	return &streamState{
+		h:          h,
+		w:          w,
+		flusher:    flusher,
+		model:      modelID,
+		blockIndex: -1,
+		stops:      stops,
+	}
+}
+
+// handleChunk emits the events for a single upstream chunk
+func (s *streamState) handleChunk(chunk openrouter.StreamChunk) {
+	if chunk.ID != "" && s.id == "" {
+		s.id = chunk.ID
+	}
+	if chunk.Model != "" {
+		s.model = chunk.Model
+	}
+	if chunk.Usage != nil {
+		s.usage = *chunk.Usage
+	}
+	s.start()
+
+	for _, choice := range chunk.Choices {
+		// Only the first choice is meaningful for the Messages API
+		if choice.Index != 0 {
+			continue
+		}
+
+		if choice.Delta.Content != "" {
+			if !s.blockOpen || s.blockType != "text" {
+				s.openBlock(map[string]interface{}{
+					"type": "text",
+					"text": "",
+				})
+			}
+			s.h.writeAnthropicEvent(s.w, "content_block_delta", map[string]interface{}{
+				"type":  "content_block_delta",
+				"index": s.blockIndex,
+				"delta": map[string]string{
+					"type": "text_delta",
+					"text": choice.Delta.Content,
+				},
+			})
+			s.keepTail(choice.Delta.Content)
+		}
+
+		for _, tc := range choice.Delta.ToolCalls {
+			s.handleToolCall(tc)
+		}
+
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			s.stopReason = stopReason(*choice.FinishReason, s.sawToolUse)
+			if seq, ok := matchStopSequence(*choice.FinishReason, choice.NativeFinishReason, choice.StopReason, s.tail, s.stops); ok {
+				s.stopReason = "stop_sequence"
+				if seq != "" {
+					s.stopSequence = &seq
+				}
+			}
+		}
+	}
+
+	s.flusher.Flush()
+}
+
+// keepTail remembers the end of the generated text, as long as the longest
+// stop sequence
+func (s *streamState) keepTail(text string) {
+	longest := 0
+	for _, stop := range s.stops {
+		longest = max(longest, len(stop))
+	}
+	s.tail += text
+	if len(s.tail) > longest {
+		s.tail = s.tail[len(s.tail)-longest:]
+	}
+}
+
+// handleToolCall turns a tool call delta into tool_use block events. A new
+// block is opened whenever the upstream moves on to another tool call;
+// argument fragments are forwarded as input_json_delta events.
+func (s *streamState) handleToolCall(tc openrouter.ToolCall) {
+	index := s.toolIndex
+	if tc.Index != nil {
+		index = *tc.Index
+	}
+
+	newCall := !s.blockOpen || s.blockType != "tool_use" || index != s.toolIndex ||
+		(tc.ID != "" && tc.ID != s.toolID)
+	if newCall {
+		id := tc.ID
+		if id == "" {
+			id = fmt.Sprintf("toolu_%s_%d", s.id, index)
+		}
+		s.toolIndex = index
+		s.toolID = id
+		s.sawToolUse = true
+		s.openBlock(map[string]interface{}{
+			"type":  "tool_use",
+			"id":    id,
+			"name":  tc.Function.Name,
+			"input": map[string]interface{}{},
+		})
+	}
+
+	if tc.Function.Arguments != "" {
+		s.h.writeAnthropicEvent(s.w, "content_block_delta", map[string]interface{}{
+			"type":  "content_block_delta",
+			"index": s.blockIndex,
+			"delta": map[string]string{
+				"type":         "input_json_delta",
+				"partial_json": tc.Function.Arguments,
+			},
+		})
+	}
+}
+
+// start sends message_start once
+func (s *streamState) start() {
+	if s.started {
+		return
+	}
+	s.started = true
+
+	s.h.writeAnthropicEvent(s.w, "message_start", map[string]interface{}{
+		"type": "message_start",
+		"message": map[string]interface{}{
+			"id":            s.id,
+			"type":          "message",
+			"role":          "assistant",
+			"content":       []interface{}{},
+			"model":         s.model,
+			"stop_reason":   nil,
+			"stop_sequence": nil,
+			"usage": openrouter.AnthropicUsage{
+				InputTokens:  s.usage.PromptTokens,
+				OutputTokens: 0,
+			},
+		},
+	})
+}
+
+// openBlock closes the current content block, if any, and starts a new one
+func (s *streamState) openBlock(block map[string]interface{}) {
+	s.closeBlock()
+	s.blockIndex++
+	s.blockOpen = true
+	s.blockType, _ = block["type"].(string)
+
+	s.h.writeAnthropicEvent(s.w, "content_block_start", map[string]interface{}{
+		"type":          "content_block_start",
+		"index":         s.blockIndex,
+		"content_block": block,
+	})
+}
+
+// closeBlock sends content_block_stop for the open block
+func (s *streamState) closeBlock() {
+	if !s.blockOpen {
+		return
+	}
+	s.blockOpen = false
+
+	s.h.writeAnthropicEvent(s.w, "content_block_stop", map[string]interface{}{
+		"type":  "content_block_stop",
+		"index": s.blockIndex,
+	})
+}
+
+// finish closes the message after the upstream stream has ended
+func (s *streamState) finish() {
+	s.start()
+	s.closeBlock()
+
+	if s.stopReason == "" {
+		s.stopReason = stopReason("", s.sawToolUse)
+	}
+
+	s.h.writeAnthropicEvent(s.w, "message_delta", map[string]interface{}{
+		"type": "message_delta",
+		"delta": map[string]interface{}{
+			"stop_reason":   s.stopReason,
+			"stop_sequence": s.stopSequence,
+		},
+		"usage": openrouter.AnthropicUsage{
+			InputTokens:  s.usage.PromptTokens,
+			OutputTokens: s.usage.CompletionTokens,
+		},
+	})
+	s.h.writeAnthropicEvent(s.w, "message_stop", map[string]interface{}{
+		"type": "message_stop",
+	})
+	s.flusher.Flush()
+}
+
+// fail reports an upstream error. Before the stream has started the error
+// is returned as a regular HTTP error response.
+func (s *streamState) fail(status int, message string) {
+	if !s.started {
+		s.h.writeError(s.w, status, message)
+		return
+	}
+
+	s.h.writeAnthropicEvent(s.w, "error", map[string]interface{}{
+		"type": "error",
+		"error": map[string]string{
+			"type":    "api_error",
+			"message": message,
+		},
+	})
+	s.flusher.Flush()
+}
+
+// stopReason maps an OpenAI finish_reason to an Anthropic stop_reason. Some
+// providers report "stop", or nothing, even when the turn ends in tool calls.
+func stopReason(finishReason string, hasToolCalls bool) string {
+	switch finishReason {
+	case "length":
+		return "max_tokens"
+	case "tool_calls", "function_call":
+		return "tool_use"
+	case "content_filter":
+		return "refusal"
+	case "", "stop":
+		if hasToolCalls {
+			return "tool_use"
+		}
+	}
+	return "end_turn"
+}
+
+// matchStopSequence reports whether generation ended on one of the request's
+// stop sequences, and which one if it can be told. OpenAI-style responses
+// only say "stop", so the sequence is recovered from a vLLM-style
+// stop_reason, from the provider's native finish reason, or from the end of
+// the generated text for providers that keep the sequence in the output.
+func matchStopSequence(finishReason, nativeReason string, stopReason json.RawMessage, text string, stops []string) (string, bool) {
+	if finishReason != "stop" || len(stops) == 0 {
+		return "", false
+	}
+
+	var matched string
+	if json.Unmarshal(stopReason, &matched) == nil && matched != "" {
+		for _, stop := range stops {
+			if stop == matched {
+				return stop, true
+			}
+		}
+	}
+
+	for _, stop := range stops {
+		if stop != "" && strings.HasSuffix(text, stop) {
+			return stop, true
+		}
+	}
+
+	if nativeReason == "stop_sequence" {
+		if len(stops) == 1 {
+			return stops[0], true
+		}
+		return "", true
+	}
+
+	return "", false
+}
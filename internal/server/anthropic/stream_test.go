@@ -0,0 +1,216 @@
+package anthropic
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mosajjal/frugalai/internal/openrouter"
+)
+
+// sseEvent is an event the stream state wrote
+type sseEvent struct {
+	name string
+	data map[string]interface{}
+}
+
+// runStream feeds chunks given as JSON through a stream state and returns
+// the events it wrote
+func runStream(t *testing.T, stops []string, chunks ...string) []sseEvent {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	state := newStreamState(&Handler{}, rec, rec, "test/model", stops)
+	for _, c := range chunks {
+		var chunk openrouter.StreamChunk
+		if err := json.Unmarshal([]byte(c), &chunk); err != nil {
+			t.Fatalf("invalid chunk %s: %v", c, err)
+		}
+		state.handleChunk(chunk)
+	}
+	state.finish()
+
+	var events []sseEvent
+	for _, frame := range strings.Split(strings.TrimSpace(rec.Body.String()), "\n\n") {
+		name, data, _ := strings.Cut(frame, "\n")
+		e := sseEvent{name: strings.TrimPrefix(name, "event: ")}
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(data, "data: ")), &e.data); err != nil {
+			t.Fatalf("invalid event data %q: %v", data, err)
+		}
+		events = append(events, e)
+	}
+	return events
+}
+
+func eventNames(events []sseEvent) string {
+	names := make([]string, len(events))
+	for i, e := range events {
+		names[i] = e.name
+		if delta, ok := e.data["delta"].(map[string]interface{}); ok && e.name == "content_block_delta" {
+			names[i] += ":" + delta["type"].(string)
+		}
+		if block, ok := e.data["content_block"].(map[string]interface{}); ok {
+			names[i] += ":" + block["type"].(string)
+		}
+	}
+	return strings.Join(names, " ")
+}
+
+func TestStreamTextThenToolUse(t *testing.T) {
+	events := runStream(t, nil,
+		`{"id":"gen-1","choices":[{"index":0,"delta":{"role":"assistant","content":"Let me check."}}]}`,
+		`{"id":"gen-1","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"get_weather","arguments":""}}]}}]}`,
+		`{"id":"gen-1","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"city\":"}}]}}]}`,
+		`{"id":"gen-1","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"Paris\"}"}}]}}]}`,
+		`{"id":"gen-1","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`,
+		`{"id":"gen-1","choices":[],"usage":{"prompt_tokens":12,"completion_tokens":5}}`,
+	)
+
+	want := "message_start " +
+		"content_block_start:text content_block_delta:text_delta content_block_stop " +
+		"content_block_start:tool_use content_block_delta:input_json_delta content_block_delta:input_json_delta content_block_stop " +
+		"message_delta message_stop"
+	if got := eventNames(events); got != want {
+		t.Fatalf("events =\n%s\nwant\n%s", got, want)
+	}
+
+	start := events[0].data["message"].(map[string]interface{})
+	if start["id"] != "gen-1" || start["model"] != "test/model" {
+		t.Errorf("message_start = %v", start)
+	}
+
+	tool := events[4].data["content_block"].(map[string]interface{})
+	if tool["id"] != "call_1" || tool["name"] != "get_weather" || events[4].data["index"] != 1.0 {
+		t.Errorf("tool_use block = %v at index %v", tool, events[4].data["index"])
+	}
+
+	// A "stop" finish with tool calls is reported as tool_use
+	delta := events[8].data["delta"].(map[string]interface{})
+	if delta["stop_reason"] != "tool_use" || delta["stop_sequence"] != nil {
+		t.Errorf("message_delta = %v, want stop_reason tool_use", delta)
+	}
+	usage := events[8].data["usage"].(map[string]interface{})
+	if usage["input_tokens"] != 12.0 || usage["output_tokens"] != 5.0 {
+		t.Errorf("usage = %v, want 12 in and 5 out", usage)
+	}
+}
+
+func TestStreamStopReasons(t *testing.T) {
+	tests := []struct {
+		name         string
+		stops        []string
+		chunks       []string
+		wantReason   string
+		wantSequence interface{}
+	}{
+		{
+			name:       "length",
+			chunks:     []string{`{"choices":[{"index":0,"delta":{"content":"Hi"},"finish_reason":"length"}]}`},
+			wantReason: "max_tokens",
+		},
+		{
+			name:       "no finish reason",
+			chunks:     []string{`{"choices":[{"index":0,"delta":{"content":"Hi"}}]}`},
+			wantReason: "end_turn",
+		},
+		{
+			name:         "stop sequence kept in the output",
+			stops:        []string{"END", "STOP"},
+			chunks:       []string{`{"choices":[{"index":0,"delta":{"content":"Hello ST"}}]}`, `{"choices":[{"index":0,"delta":{"content":"OP"},"finish_reason":"stop"}]}`},
+			wantReason:   "stop_sequence",
+			wantSequence: "STOP",
+		},
+		{
+			name:         "stop sequence in vLLM stop_reason",
+			stops:        []string{"END", "STOP"},
+			chunks:       []string{`{"choices":[{"index":0,"delta":{"content":"Hello"},"finish_reason":"stop","stop_reason":"END"}]}`},
+			wantReason:   "stop_sequence",
+			wantSequence: "END",
+		},
+		{
+			name:       "plain stop with stop sequences",
+			stops:      []string{"END"},
+			chunks:     []string{`{"choices":[{"index":0,"delta":{"content":"Hello"},"finish_reason":"stop"}]}`},
+			wantReason: "end_turn",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := runStream(t, tt.stops, tt.chunks...)
+			delta := events[len(events)-2].data["delta"].(map[string]interface{})
+			if delta["stop_reason"] != tt.wantReason || delta["stop_sequence"] != tt.wantSequence {
+				t.Errorf("delta = %v, want stop_reason %s and stop_sequence %v", delta, tt.wantReason, tt.wantSequence)
+			}
+		})
+	}
+}
+
+func TestMatchStopSequence(t *testing.T) {
+	tests := []struct {
+		name         string
+		finishReason string
+		nativeReason string
+		stopReason   string
+		text         string
+		stops        []string
+		want         string
+		wantOK       bool
+	}{
+		{name: "not a stop", finishReason: "length", text: "END", stops: []string{"END"}},
+		{name: "no stop sequences", finishReason: "stop", text: "END"},
+		{name: "stop_reason", finishReason: "stop", stopReason: `"b"`, stops: []string{"a", "b"}, want: "b", wantOK: true},
+		{name: "unknown stop_reason", finishReason: "stop", stopReason: `"c"`, stops: []string{"a", "b"}},
+		{name: "numeric stop_reason is a token", finishReason: "stop", stopReason: `128001`, stops: []string{"a"}},
+		{name: "text suffix", finishReason: "stop", text: "done. b", stops: []string{"a", "b"}, want: "b", wantOK: true},
+		{name: "native reason, single sequence", finishReason: "stop", nativeReason: "stop_sequence", stops: []string{"a"}, want: "a", wantOK: true},
+		{name: "native reason, ambiguous", finishReason: "stop", nativeReason: "stop_sequence", stops: []string{"a", "b"}, wantOK: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stopReason json.RawMessage
+			if tt.stopReason != "" {
+				stopReason = json.RawMessage(tt.stopReason)
+			}
+			got, ok := matchStopSequence(tt.finishReason, tt.nativeReason, stopReason, tt.text, tt.stops)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("matchStopSequence() = %q, %v, want %q, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestStopReason(t *testing.T) {
+	tests := []struct {
+		finish       string
+		hasToolCalls bool
+		want         string
+	}{
+		{finish: "stop", want: "end_turn"},
+		{finish: "", want: "end_turn"},
+		{finish: "length", want: "max_tokens"},
+		{finish: "length", hasToolCalls: true, want: "max_tokens"},
+		{finish: "tool_calls", want: "tool_use"},
+		{finish: "function_call", want: "tool_use"},
+		{finish: "stop", hasToolCalls: true, want: "tool_use"},
+		{finish: "", hasToolCalls: true, want: "tool_use"},
+		{finish: "content_filter", want: "refusal"},
+	}
+
+	for _, tt := range tests {
+		if got := stopReason(tt.finish, tt.hasToolCalls); got != tt.want {
+			t.Errorf("stopReason(%q, %v) = %s, want %s", tt.finish, tt.hasToolCalls, got, tt.want)
+		}
+	}
+}
+
+func TestStreamUsageBeforeStart(t *testing.T) {
+	events := runStream(t, nil,
+		`{"id":"gen-1","choices":[{"index":0,"delta":{"content":"Hi"}}],"usage":{"prompt_tokens":12,"completion_tokens":1}}`,
+	)
+	usage := events[0].data["message"].(map[string]interface{})["usage"].(map[string]interface{})
+	if usage["input_tokens"] != 12.0 {
+		t.Errorf("message_start usage = %v, want the upstream's input tokens", usage)
+	}
+}
@@ -0,0 +1,227 @@
+// Package dispatch holds what the OpenAI and Anthropic handlers share
+// between choosing a model for a request and recording how it went:
+// routing, pacing, the daily quota and failover bookkeeping.
+package dispatch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/mosajjal/frugalai/internal/manager"
+	"github.com/mosajjal/frugalai/internal/model"
+	"github.com/mosajjal/frugalai/internal/openrouter"
+	"github.com/mosajjal/frugalai/internal/popularity"
+	"github.com/mosajjal/frugalai/internal/quota"
+)
+
+// Dispatcher routes requests to models and records their outcome. Without
+// a model manager it always uses the selector's best model.
+type Dispatcher struct {
+	selector     *model.Selector
+	modelManager *manager.Manager
+	quota        *quota.Tracker
+	quotaApplies func(modelID string) bool
+	router       *model.Router
+	usage        *popularity.Usage
+}
+
+// New creates a dispatcher. The manager may be nil.
+func New(selector *model.Selector, mgr *manager.Manager) *Dispatcher {
+	return &Dispatcher{
+		selector:     selector,
+		modelManager: mgr,
+	}
+}
+
+// SetQuota makes the dispatcher count requests against the daily free model
+// quota and reject them once it is used up. applies tells the models of
+// OpenRouter, whose quota it is, from those of other providers.
+func (d *Dispatcher) SetQuota(q *quota.Tracker, applies func(modelID string) bool) {
+	d.quota = q
+	d.quotaApplies = applies
+}
+
+// SetUsage makes the dispatcher count the successful requests of each
+// model, which the selector ranks popularity with
+func (d *Dispatcher) SetUsage(u *popularity.Usage) {
+	d.usage = u
+}
+
+// SetRouter makes the dispatcher honor the model a request asks for.
+// Without a router the proxy always chooses.
+func (d *Dispatcher) SetRouter(r *model.Router) {
+	d.router = r
+}
+
+// Manager returns the model manager, nil when there is none
+func (d *Dispatcher) Manager() *manager.Manager {
+	return d.modelManager
+}
+
+// Router returns the router, nil when there is none
+func (d *Dispatcher) Router() *model.Router {
+	return d.router
+}
+
+// CurrentModelID returns the manager's current model, or the selector's
+// best model without one
+func (d *Dispatcher) CurrentModelID() string {
+	if d.modelManager != nil {
+		if id := d.modelManager.CurrentID(); id != "" {
+			return id
+		}
+	}
+	// Fallback to selector
+	if id, err := d.selector.GetBestModelID(); err == nil {
+		return id
+	}
+	return ""
+}
+
+// ModelID returns the model to send a request with the given requirements
+// to. It fails with a *model.ContextOverflowError when the request fits no
+// candidate.
+func (d *Dispatcher) ModelID(reqs model.Requirements) (string, error) {
+	if d.modelManager != nil {
+		picked, err := d.modelManager.Pick(reqs)
+		if err != nil {
+			return "", err
+		}
+		if picked != nil {
+			return picked.ID, nil
+		}
+	}
+	return d.CurrentModelID(), nil
+}
+
+// Requirements derives the requirements of a request, including its
+// routing and routing hints
+func (d *Dispatcher) Requirements(req *openrouter.ChatRequest, constraints *model.Constraints) model.Requirements {
+	reqs := model.RequirementsFor(req)
+	if d.router != nil {
+		reqs = d.router.Route(req.Model, reqs)
+	}
+	return reqs.WithConstraints(constraints)
+}
+
+// ParseHints parses the routing hint headers of a request and reports the
+// constraints in the response headers
+func (d *Dispatcher) ParseHints(w http.ResponseWriter, r *http.Request) (*model.Constraints, error) {
+	constraints, err := model.ParseHints(r.Header)
+	if err != nil {
+		return nil, err
+	}
+	if constraints != nil {
+		w.Header().Set(model.HeaderConstraints, constraints.String())
+	}
+	return constraints, nil
+}
+
+// PrepareRequest adapts the request to the quirks of the model it is sent to
+func (d *Dispatcher) PrepareRequest(req *openrouter.ChatRequest) *openrouter.ChatRequest {
+	if d.selector != nil && !d.selector.SupportsSystemPrompt(req.Model) {
+		return req.MergeSystemPrompt()
+	}
+	return req
+}
+
+// Pace holds a request back to spread the model's remaining rate limit
+// over its window
+func (d *Dispatcher) Pace(ctx context.Context, modelID string) error {
+	if d.modelManager == nil {
+		return nil
+	}
+	return d.modelManager.Pace(ctx, modelID)
+}
+
+// ReserveQuota counts a request to an OpenRouter free model against the
+// daily free model quota, once however often it is retried. reserved tells
+// whether the request has been counted already; the result whether it is.
+func (d *Dispatcher) ReserveQuota(modelID string, reserved bool) (bool, error) {
+	if reserved || d.quota == nil || !strings.HasSuffix(modelID, ":free") {
+		return reserved, nil
+	}
+	if d.quotaApplies != nil && !d.quotaApplies(modelID) {
+		return false, nil
+	}
+	if err := d.quota.Reserve(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// RecordSuccess records a successful request and its performance, and
+// counts it towards the model's usage
+func (d *Dispatcher) RecordSuccess(modelID string, rl *openrouter.RateLimit, sample manager.Sample) {
+	if d.modelManager != nil {
+		d.modelManager.RecordSuccess(modelID, rl)
+		d.modelManager.RecordSample(modelID, sample)
+	}
+	if d.usage != nil {
+		d.usage.Record(modelID)
+	}
+}
+
+// RecordFailure records a model failure and reports whether a retry should
+// go to another model. An unreachable upstream counts against all of its
+// models.
+func (d *Dispatcher) RecordFailure(modelID string, statusCode int, err error) bool {
+	if limit, ok := openrouter.FreeQuotaExhausted(err); ok && d.quota != nil {
+		d.quota.MarkExhausted(limit)
+	}
+	if d.modelManager == nil {
+		return false
+	}
+	var connErr *openrouter.ConnectionError
+	if errors.As(err, &connErr) {
+		return d.modelManager.RecordUnreachable(modelID)
+	}
+	return d.modelManager.RecordFailure(modelID, statusCode, openrouter.RateLimitOf(err))
+}
+
+// RecordTimeout records a model timeout and reports whether a retry should
+// go to another model
+func (d *Dispatcher) RecordTimeout(modelID string) bool {
+	if d.modelManager == nil {
+		return false
+	}
+	return d.modelManager.RecordTimeout(modelID)
+}
+
+// ParseAPIError attempts to parse an error as an API error
+func ParseAPIError(err error) *openrouter.APIError {
+	// Check if it's an HTTP error with status code
+	type httpError interface {
+		StatusCode() int
+	}
+
+	var he httpError
+	if errors.As(err, &he) {
+		return &openrouter.APIError{
+			Code:    he.StatusCode(),
+			Message: err.Error(),
+		}
+	}
+
+	// Try to parse from error string
+	errStr := err.Error()
+	if strings.Contains(errStr, "status ") {
+		// Extract status code
+		parts := strings.Split(errStr, "status ")
+		if len(parts) > 1 {
+			var code int
+			fmt.Sscanf(parts[1], "%d", &code)
+			if code > 0 {
+				return &openrouter.APIError{
+					Code:    code,
+					Message: errStr,
+				}
+			}
+		}
+	}
+
+	return nil
+}
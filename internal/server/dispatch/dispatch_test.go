@@ -0,0 +1,116 @@
+package dispatch
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mosajjal/frugalai/internal/manager"
+	"github.com/mosajjal/frugalai/internal/model"
+	"github.com/mosajjal/frugalai/internal/openrouter"
+	"github.com/mosajjal/frugalai/internal/quota"
+)
+
+func TestParseAPIError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "HTTP error", err: &openrouter.HTTPError{Code: 429, Message: "Rate limited"}, want: 429},
+		{name: "wrapped HTTP error", err: fmt.Errorf("stream failed: %w", &openrouter.HTTPError{Code: 404, Message: "No endpoints found"}), want: 404},
+		{name: "unreachable upstream", err: &openrouter.ConnectionError{Err: errors.New("refused")}, want: 502},
+		{name: "status in the message", err: errors.New("API error: status 503: unavailable"), want: 503},
+		{name: "no status", err: errors.New("connection reset"), want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ParseAPIError(tt.err)
+			switch {
+			case tt.want == 0 && got != nil:
+				t.Errorf("ParseAPIError() = %+v, want nil", got)
+			case tt.want != 0 && (got == nil || got.Code != tt.want):
+				t.Errorf("ParseAPIError() = %+v, want code %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseHints(t *testing.T) {
+	d := New(nil, nil)
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	r.Header.Set(model.HeaderMinParams, "30B")
+	w := httptest.NewRecorder()
+	constraints, err := d.ParseHints(w, r)
+	if err != nil || constraints == nil {
+		t.Fatalf("ParseHints() = %v, %v, want constraints", constraints, err)
+	}
+	if w.Header().Get(model.HeaderConstraints) == "" {
+		t.Errorf("constraints are not reported in %s", model.HeaderConstraints)
+	}
+
+	r.Header.Set(model.HeaderMinParams, "lots")
+	if _, err := d.ParseHints(httptest.NewRecorder(), r); err == nil {
+		t.Error("ParseHints() accepted an invalid hint")
+	}
+}
+
+func TestRecordFailover(t *testing.T) {
+	mgr := manager.New()
+	mgr.SetCandidates([]openrouter.Model{{ID: "a/one:free"}, {ID: "b/two:free"}}, 0)
+	d := New(nil, mgr)
+
+	if !d.RecordFailure("a/one:free", 502, &openrouter.HTTPError{Code: 502, Message: "Bad gateway"}) {
+		t.Error("RecordFailure() did not switch away from a failing model")
+	}
+	if got := d.CurrentModelID(); got != "b/two:free" {
+		t.Errorf("current = %s, want b/two:free", got)
+	}
+
+	// An unreachable upstream counts against every model of its provider
+	mgr.SetCandidates([]openrouter.Model{{ID: "a/one:free", Provider: "p"}, {ID: "b/two:free", Provider: "p"}}, 0)
+	d.RecordFailure("a/one:free", 0, &openrouter.ConnectionError{Err: errors.New("refused")})
+	for _, s := range mgr.Status() {
+		if s.Breaker != manager.StateOpen {
+			t.Errorf("%s breaker = %v after its provider was unreachable, want open", s.Model.ID, s.Breaker)
+		}
+	}
+
+	if New(nil, nil).RecordTimeout("a/one:free") {
+		t.Error("RecordTimeout() without a manager asked for a retry")
+	}
+}
+
+func TestReserveQuota(t *testing.T) {
+	q := quota.New()
+	q.Update(&openrouter.KeyInfo{})
+	d := New(nil, nil)
+	d.SetQuota(q, func(id string) bool { return !strings.HasPrefix(id, "groq:") })
+
+	// A request retried with several models counts once, and only for
+	// OpenRouter's free models
+	reserved := false
+	for _, id := range []string{"groq:llama-3.3-70b:free", "a/one:free", "b/two:free"} {
+		var err error
+		if reserved, err = d.ReserveQuota(id, reserved); err != nil {
+			t.Fatalf("ReserveQuota(%s) error = %v", id, err)
+		}
+	}
+	if !reserved {
+		t.Error("ReserveQuota() did not count a request to an OpenRouter free model")
+	}
+
+	for _, id := range []string{"openai/gpt-4o", "groq:llama-3.3-70b:free"} {
+		if counted, _ := d.ReserveQuota(id, false); counted {
+			t.Errorf("ReserveQuota(%s) counted the request", id)
+		}
+	}
+	if used := q.Status().UsedToday; used != 1 {
+		t.Errorf("quota used = %d, want 1", used)
+	}
+}
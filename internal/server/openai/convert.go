@@ -0,0 +1,360 @@
+package openai
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/mosajjal/frugalai/internal/openrouter"
+)
+
+// ConvertAnthropicToOpenAI converts Anthropic format to OpenAI format.
+// Sampling parameters are only set when the client sent them, so the
+// upstream provider's defaults apply otherwise.
+func ConvertAnthropicToOpenAI(anthropicReq map[string]interface{}) (*openrouter.ChatRequest, error) {
+	req := &openrouter.ChatRequest{}
+
+	// Get model
+	if model, ok := anthropicReq["model"].(string); ok {
+		req.Model = model
+	}
+
+	// Get max tokens
+	if maxTokens, ok := anthropicReq["max_tokens"].(float64); ok {
+		req.MaxTokens = int(maxTokens)
+	}
+
+	// Get sampling parameters
+	if temp, ok := anthropicReq["temperature"].(float64); ok {
+		req.Temperature = &temp
+	}
+	if topP, ok := anthropicReq["top_p"].(float64); ok {
+		req.TopP = &topP
+	}
+	if topK, ok := anthropicReq["top_k"].(float64); ok {
+		k := int(topK)
+		req.TopK = &k
+	}
+
+	// Get stop sequences
+	if stops, ok := anthropicReq["stop_sequences"].([]interface{}); ok {
+		for _, stop := range stops {
+			if s, ok := stop.(string); ok {
+				req.Stop = append(req.Stop, s)
+			}
+		}
+	}
+
+	// Get end user ID
+	if metadata, ok := anthropicReq["metadata"].(map[string]interface{}); ok {
+		if userID, ok := metadata["user_id"].(string); ok {
+			req.User = userID
+		}
+	}
+
+	// Extended thinking maps to OpenRouter reasoning tokens
+	if thinking, ok := anthropicReq["thinking"].(map[string]interface{}); ok && thinking["type"] == "enabled" {
+		req.Reasoning = &openrouter.Reasoning{}
+		if budget, ok := thinking["budget_tokens"].(float64); ok {
+			req.Reasoning.MaxTokens = int(budget)
+		}
+	}
+
+	// Convert tool definitions
+	if tools, ok := anthropicReq["tools"].([]interface{}); ok {
+		req.Tools = convertAnthropicTools(tools)
+	}
+	if toolChoice, ok := anthropicReq["tool_choice"].(map[string]interface{}); ok {
+		req.ToolChoice, req.ParallelToolCalls = convertAnthropicToolChoice(toolChoice)
+	}
+
+	// Convert messages
+	messages, ok := anthropicReq["messages"].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid messages format")
+	}
+
+	// The top-level system prompt becomes the leading system message
+	if system, ok := convertAnthropicSystem(anthropicReq["system"]); ok {
+		req.Messages = append(req.Messages, system)
+	}
+
+	for _, msg := range messages {
+		msgMap, ok := msg.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		role, _ := msgMap["role"].(string)
+
+		// Handle content (can be string or array of blocks)
+		switch c := msgMap["content"].(type) {
+		case string:
+			req.Messages = append(req.Messages, openrouter.ChatMessage{
+				Role:    role,
+				Content: openrouter.TextContent(c),
+			})
+		case []interface{}:
+			req.Messages = append(req.Messages, convertAnthropicBlocks(role, c)...)
+		}
+	}
+
+	return req, nil
+}
+
+// convertAnthropicSystem converts the top-level system field, which is a
+// string or an array of text blocks. Blocks are joined into a plain string
+// unless one of them carries a cache_control annotation, in which case they
+// are kept as separate parts so the caching breakpoint survives.
+func convertAnthropicSystem(system interface{}) (openrouter.ChatMessage, bool) {
+	msg := openrouter.ChatMessage{Role: "system"}
+
+	switch s := system.(type) {
+	case string:
+		if s == "" {
+			return msg, false
+		}
+		msg.Content = openrouter.TextContent(s)
+	case []interface{}:
+		parts := []openrouter.ContentPart{}
+		cached := false
+		for _, block := range s {
+			blockMap, ok := block.(map[string]interface{})
+			if !ok || blockMap["type"] != "text" {
+				continue
+			}
+			text, _ := blockMap["text"].(string)
+			part := openrouter.ContentPart{
+				Type: "text",
+				Text: text,
+			}
+			if cc, ok := blockMap["cache_control"].(map[string]interface{}); ok {
+				ccType, _ := cc["type"].(string)
+				ttl, _ := cc["ttl"].(string)
+				part.CacheControl = &openrouter.CacheControl{Type: ccType, TTL: ttl}
+				cached = true
+			}
+			parts = append(parts, part)
+		}
+		if len(parts) == 0 {
+			return msg, false
+		}
+		if cached {
+			msg.Content = openrouter.PartsContent(parts)
+		} else {
+			msg.Content = openrouter.TextContent(openrouter.PartsContent(parts).String())
+		}
+	default:
+		return msg, false
+	}
+
+	return msg, true
+}
+
+// convertAnthropicBlocks converts the content blocks of a single Anthropic
+// message. Each tool_result block becomes its own "tool" message, placed
+// before the rest of the turn as OpenAI expects tool results to directly
+// follow the assistant's tool calls. tool_use blocks become tool_calls.
+// Images, including those returned inside tool results, become image_url
+// parts of the message, which is only sent as a part array when it has
+// images.
+func convertAnthropicBlocks(role string, blocks []interface{}) []openrouter.ChatMessage {
+	var messages []openrouter.ChatMessage
+	var parts []openrouter.ContentPart
+	var toolCalls []openrouter.ToolCall
+	hasImages := false
+
+	for _, block := range blocks {
+		blockMap, ok := block.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		switch blockMap["type"] {
+		case "text":
+			if text, ok := blockMap["text"].(string); ok {
+				parts = append(parts, openrouter.ContentPart{
+					Type: "text",
+					Text: text,
+				})
+			}
+		case "image":
+			if part, ok := convertAnthropicImage(blockMap); ok {
+				parts = append(parts, part)
+				hasImages = true
+			}
+		case "tool_use":
+			id, _ := blockMap["id"].(string)
+			name, _ := blockMap["name"].(string)
+			arguments := "{}"
+			if input, ok := blockMap["input"]; ok && input != nil {
+				if b, err := json.Marshal(input); err == nil {
+					arguments = string(b)
+				}
+			}
+			toolCalls = append(toolCalls, openrouter.ToolCall{
+				ID:   id,
+				Type: "function",
+				Function: openrouter.FunctionCall{
+					Name:      name,
+					Arguments: arguments,
+				},
+			})
+		case "tool_result":
+			id, _ := blockMap["tool_use_id"].(string)
+			content, images := convertToolResult(blockMap["content"])
+			if isError, _ := blockMap["is_error"].(bool); isError {
+				content = "Error: " + content
+			}
+			messages = append(messages, openrouter.ChatMessage{
+				Role:       "tool",
+				Content:    openrouter.TextContent(content),
+				ToolCallID: id,
+			})
+			if len(images) > 0 {
+				parts = append(parts, images...)
+				hasImages = true
+			}
+		}
+	}
+
+	if len(parts) > 0 || len(toolCalls) > 0 || len(messages) == 0 {
+		msg := openrouter.ChatMessage{
+			Role:      role,
+			ToolCalls: toolCalls,
+		}
+		if hasImages {
+			msg.Content = openrouter.PartsContent(parts)
+		} else {
+			msg.Content = openrouter.TextContent(openrouter.PartsContent(parts).String())
+		}
+		messages = append(messages, msg)
+	}
+
+	return messages
+}
+
+// convertAnthropicImage converts an Anthropic image block, with either a
+// base64 or a URL source, to an image_url part
+func convertAnthropicImage(block map[string]interface{}) (openrouter.ContentPart, bool) {
+	source, ok := block["source"].(map[string]interface{})
+	if !ok {
+		return openrouter.ContentPart{}, false
+	}
+
+	var url string
+	switch source["type"] {
+	case "base64":
+		mediaType, _ := source["media_type"].(string)
+		data, _ := source["data"].(string)
+		if data == "" {
+			return openrouter.ContentPart{}, false
+		}
+		url = fmt.Sprintf("data:%s;base64,%s", mediaType, data)
+	case "url":
+		url, _ = source["url"].(string)
+		if url == "" {
+			return openrouter.ContentPart{}, false
+		}
+	default:
+		return openrouter.ContentPart{}, false
+	}
+
+	return openrouter.ContentPart{
+		Type:     "image_url",
+		ImageURL: &openrouter.ImageURL{URL: url},
+	}, true
+}
+
+// convertToolResult flattens the content of a tool_result block, which can
+// be a string or an array of text and image blocks. Images cannot be part
+// of an OpenAI tool message, so they are returned separately.
+func convertToolResult(content interface{}) (string, []openrouter.ContentPart) {
+	switch c := content.(type) {
+	case string:
+		return c, nil
+	case []interface{}:
+		var textParts []string
+		var images []openrouter.ContentPart
+		for _, block := range c {
+			blockMap, ok := block.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			switch blockMap["type"] {
+			case "text":
+				if text, ok := blockMap["text"].(string); ok {
+					textParts = append(textParts, text)
+				}
+			case "image":
+				if part, ok := convertAnthropicImage(blockMap); ok {
+					images = append(images, part)
+				}
+			}
+		}
+		return strings.Join(textParts, "\n"), images
+	}
+	return "", nil
+}
+
+// convertAnthropicToolChoice converts an Anthropic tool_choice object to the
+// OpenAI tool_choice and parallel_tool_calls parameters
+func convertAnthropicToolChoice(toolChoice map[string]interface{}) (interface{}, *bool) {
+	var parallel *bool
+	if disable, ok := toolChoice["disable_parallel_tool_use"].(bool); ok && disable {
+		parallel = new(bool)
+	}
+
+	switch toolChoice["type"] {
+	case "any":
+		return "required", parallel
+	case "none":
+		return "none", parallel
+	case "tool":
+		name, _ := toolChoice["name"].(string)
+		return map[string]interface{}{
+			"type":     "function",
+			"function": map[string]string{"name": name},
+		}, parallel
+	default:
+		return "auto", parallel
+	}
+}
+
+// convertAnthropicTools converts Anthropic tool definitions to OpenAI
+// function tools. Anthropic server tools (web search, computer use, etc.)
+// have no OpenAI equivalent and are skipped.
+func convertAnthropicTools(tools []interface{}) []openrouter.Tool {
+	var result []openrouter.Tool
+
+	for _, tool := range tools {
+		toolMap, ok := tool.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if toolType, ok := toolMap["type"].(string); ok && toolType != "custom" {
+			continue
+		}
+
+		name, _ := toolMap["name"].(string)
+		description, _ := toolMap["description"].(string)
+
+		var parameters json.RawMessage
+		if schema, ok := toolMap["input_schema"]; ok && schema != nil {
+			if b, err := json.Marshal(schema); err == nil {
+				parameters = b
+			}
+		}
+
+		result = append(result, openrouter.Tool{
+			Type: "function",
+			Function: openrouter.FunctionDefinition{
+				Name:        name,
+				Description: description,
+				Parameters:  parameters,
+			},
+		})
+	}
+
+	return result
+}
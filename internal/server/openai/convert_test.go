@@ -0,0 +1,203 @@
+package openai
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/mosajjal/frugalai/internal/openrouter"
+)
+
+// convert converts an Anthropic request given as JSON
+func convert(t *testing.T, body string) *openrouter.ChatRequest {
+	t.Helper()
+	var anthropicReq map[string]interface{}
+	if err := json.Unmarshal([]byte(body), &anthropicReq); err != nil {
+		t.Fatalf("invalid request %s: %v", body, err)
+	}
+	req, err := ConvertAnthropicToOpenAI(anthropicReq)
+	if err != nil {
+		t.Fatalf("ConvertAnthropicToOpenAI() error = %v", err)
+	}
+	return req
+}
+
+// toJSON marshals v for comparison
+func toJSON(t *testing.T, v interface{}) string {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("marshal %v: %v", v, err)
+	}
+	return string(b)
+}
+
+func TestConvertSystem(t *testing.T) {
+	tests := []struct {
+		name   string
+		system string
+		want   string
+	}{
+		{
+			name:   "string",
+			system: `"Be brief."`,
+			want:   `{"role":"system","content":"Be brief."}`,
+		},
+		{
+			name:   "blocks are joined",
+			system: `[{"type":"text","text":"Be brief."},{"type":"text","text":"Answer in French."}]`,
+			want:   `{"role":"system","content":"Be brief.\nAnswer in French."}`,
+		},
+		{
+			name:   "cache_control keeps the parts",
+			system: `[{"type":"text","text":"Long context"},{"type":"text","text":"Rules","cache_control":{"type":"ephemeral","ttl":"1h"}}]`,
+			want:   `{"role":"system","content":[{"type":"text","text":"Long context"},{"type":"text","text":"Rules","cache_control":{"type":"ephemeral","ttl":"1h"}}]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := convert(t, `{"system":`+tt.system+`,"messages":[{"role":"user","content":"Hi"}]}`)
+			if len(req.Messages) != 2 {
+				t.Fatalf("got %d messages, want the system message and the user message", len(req.Messages))
+			}
+			if got := toJSON(t, req.Messages[0]); got != tt.want {
+				t.Errorf("system message = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("empty system", func(t *testing.T) {
+		req := convert(t, `{"system":"","messages":[{"role":"user","content":"Hi"}]}`)
+		if len(req.Messages) != 1 || req.Messages[0].Role != "user" {
+			t.Errorf("messages = %s, want only the user message", toJSON(t, req.Messages))
+		}
+	})
+}
+
+func TestConvertToolChoice(t *testing.T) {
+	no := false
+	tests := []struct {
+		choice       string
+		want         interface{}
+		wantParallel *bool
+	}{
+		{choice: `{"type":"auto"}`, want: "auto"},
+		{choice: `{"type":"any"}`, want: "required"},
+		{choice: `{"type":"none"}`, want: "none"},
+		{
+			choice: `{"type":"tool","name":"get_weather"}`,
+			want:   map[string]interface{}{"type": "function", "function": map[string]string{"name": "get_weather"}},
+		},
+		{choice: `{"type":"auto","disable_parallel_tool_use":true}`, want: "auto", wantParallel: &no},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.choice, func(t *testing.T) {
+			req := convert(t, `{"tool_choice":`+tt.choice+`,"messages":[]}`)
+			if !reflect.DeepEqual(req.ToolChoice, tt.want) {
+				t.Errorf("tool_choice = %v, want %v", req.ToolChoice, tt.want)
+			}
+			if !reflect.DeepEqual(req.ParallelToolCalls, tt.wantParallel) {
+				t.Errorf("parallel_tool_calls = %v, want %v", req.ParallelToolCalls, tt.wantParallel)
+			}
+		})
+	}
+}
+
+func TestConvertThinking(t *testing.T) {
+	tests := []struct {
+		thinking string
+		want     *openrouter.Reasoning
+	}{
+		{thinking: `{"type":"enabled","budget_tokens":2048}`, want: &openrouter.Reasoning{MaxTokens: 2048}},
+		{thinking: `{"type":"enabled"}`, want: &openrouter.Reasoning{}},
+		{thinking: `{"type":"disabled"}`, want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.thinking, func(t *testing.T) {
+			req := convert(t, `{"thinking":`+tt.thinking+`,"messages":[]}`)
+			if !reflect.DeepEqual(req.Reasoning, tt.want) {
+				t.Errorf("reasoning = %+v, want %+v", req.Reasoning, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvertParameters(t *testing.T) {
+	req := convert(t, `{
+		"model": "claude-3-5-sonnet",
+		"max_tokens": 512,
+		"temperature": 0.2,
+		"top_k": 40,
+		"stop_sequences": ["END"],
+		"metadata": {"user_id": "u-1"},
+		"messages": []
+	}`)
+
+	if req.Model != "claude-3-5-sonnet" || req.MaxTokens != 512 || req.User != "u-1" {
+		t.Errorf("request = %s", toJSON(t, req))
+	}
+	if req.Temperature == nil || *req.Temperature != 0.2 || req.TopK == nil || *req.TopK != 40 {
+		t.Errorf("sampling = %s", toJSON(t, req))
+	}
+	if req.TopP != nil {
+		t.Errorf("top_p = %v, want unset", *req.TopP)
+	}
+	if len(req.Stop) != 1 || req.Stop[0] != "END" {
+		t.Errorf("stop = %v, want [END]", req.Stop)
+	}
+}
+
+func TestConvertToolBlocks(t *testing.T) {
+	req := convert(t, `{
+		"tools": [
+			{"name": "get_weather", "description": "Weather", "input_schema": {"type": "object"}},
+			{"type": "web_search_20250305", "name": "web_search"}
+		],
+		"messages": [
+			{"role": "user", "content": "Weather in Paris?"},
+			{"role": "assistant", "content": [
+				{"type": "text", "text": "Let me check."},
+				{"type": "tool_use", "id": "toolu_1", "name": "get_weather", "input": {"city": "Paris"}}
+			]},
+			{"role": "user", "content": [
+				{"type": "tool_result", "tool_use_id": "toolu_1", "content": [{"type": "text", "text": "18C"}]},
+				{"type": "tool_result", "tool_use_id": "toolu_2", "content": "timeout", "is_error": true},
+				{"type": "text", "text": "Thanks"}
+			]}
+		]
+	}`)
+
+	want := `[` +
+		`{"role":"user","content":"Weather in Paris?"},` +
+		`{"role":"assistant","content":"Let me check.","tool_calls":[{"id":"toolu_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Paris\"}"}}]},` +
+		`{"role":"tool","content":"18C","tool_call_id":"toolu_1"},` +
+		`{"role":"tool","content":"Error: timeout","tool_call_id":"toolu_2"},` +
+		`{"role":"user","content":"Thanks"}]`
+	if got := toJSON(t, req.Messages); got != want {
+		t.Errorf("messages =\n%s\nwant\n%s", got, want)
+	}
+
+	if len(req.Tools) != 1 || req.Tools[0].Function.Name != "get_weather" || string(req.Tools[0].Function.Parameters) != `{"type":"object"}` {
+		t.Errorf("tools = %s, want only get_weather", toJSON(t, req.Tools))
+	}
+}
+
+func TestConvertImages(t *testing.T) {
+	req := convert(t, `{"messages": [{"role": "user", "content": [
+		{"type": "text", "text": "What is this?"},
+		{"type": "image", "source": {"type": "base64", "media_type": "image/png", "data": "iVBOR"}},
+		{"type": "image", "source": {"type": "url", "url": "https://example.com/cat.jpg"}},
+		{"type": "image", "source": {"type": "base64", "media_type": "image/png", "data": ""}}
+	]}]}`)
+
+	want := `[{"role":"user","content":[` +
+		`{"type":"text","text":"What is this?"},` +
+		`{"type":"image_url","image_url":{"url":"data:image/png;base64,iVBOR"}},` +
+		`{"type":"image_url","image_url":{"url":"https://example.com/cat.jpg"}}]}]`
+	if got := toJSON(t, req.Messages); got != want {
+		t.Errorf("messages =\n%s\nwant\n%s", got, want)
+	}
+}
@@ -6,40 +6,62 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"net/http"
-	"strings"
-	"sync"
 	"time"
 
+	"github.com/mosajjal/frugalai/internal/manager"
 	"github.com/mosajjal/frugalai/internal/model"
 	"github.com/mosajjal/frugalai/internal/openrouter"
+	"github.com/mosajjal/frugalai/internal/popularity"
+	"github.com/mosajjal/frugalai/internal/provider"
+	"github.com/mosajjal/frugalai/internal/quota"
+	"github.com/mosajjal/frugalai/internal/server/dispatch"
 )
 
 // Handler handles OpenAI-compatible API requests
 type Handler struct {
-	selector     *model.Selector
-	client       *openrouter.Client
-	modelManager *openrouter.ModelManager
-	mu           sync.RWMutex
+	selector *model.Selector
+	client   provider.Provider
+	dispatch *dispatch.Dispatcher
 }
 
 // NewHandler creates a new OpenAI-compatible handler (legacy, for compatibility)
-func NewHandler(selector *model.Selector, client *openrouter.Client) *Handler {
+func NewHandler(selector *model.Selector, client provider.Provider) *Handler {
 	return &Handler{
 		selector: selector,
 		client:   client,
+		dispatch: dispatch.New(selector, nil),
 	}
 }
 
 // NewHandlerWithManager creates a new OpenAI-compatible handler with model manager
-func NewHandlerWithManager(selector *model.Selector, client *openrouter.Client, mgr *openrouter.ModelManager) *Handler {
+func NewHandlerWithManager(selector *model.Selector, client provider.Provider, mgr *manager.Manager) *Handler {
 	return &Handler{
-		selector:     selector,
-		client:       client,
-		modelManager: mgr,
+		selector: selector,
+		client:   client,
+		dispatch: dispatch.New(selector, mgr),
 	}
 }
 
+// SetQuota makes the handler count requests to the models applies accepts
+// against the daily free model quota and reject them once it is used up
+func (h *Handler) SetQuota(q *quota.Tracker, applies func(modelID string) bool) {
+	h.dispatch.SetQuota(q, applies)
+}
+
+// SetUsage makes the handler count the successful requests of each model,
+// which the selector ranks popularity with
+func (h *Handler) SetUsage(u *popularity.Usage) {
+	h.dispatch.SetUsage(u)
+}
+
+// SetRouter makes the handler honor the model a request asks for, following
+// the router's aliases and mode. Without a router the proxy always chooses.
+func (h *Handler) SetRouter(r *model.Router) {
+	h.dispatch.SetRouter(r)
+}
+
 // RegisterRoutes registers the OpenAI-compatible routes
 func (h *Handler) RegisterRoutes(mux *http.ServeMux, path string) {
 	mux.HandleFunc(path+"/chat/completions", h.handleChatCompletions)
@@ -67,15 +89,20 @@ func (h *Handler) handleChatCompletions(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Get current model ID
-	modelID := h.getCurrentModelID()
+	constraints, err := h.dispatch.ParseHints(w, r)
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
-	// Always replace incoming model with current model (this is a proxy)
-	req.Model = modelID
+	// Capabilities the selected model must have, e.g. tool calling, and
+	// the routing of the requested model. Unless it is honored, the
+	// incoming model is replaced with a candidate (this is a proxy).
+	reqs := h.dispatch.Requirements(&req, constraints)
 
 	// Handle streaming vs non-streaming
 	if req.Stream {
-		h.handleStream(w, r, &req)
+		h.handleStream(w, r, &req, reqs)
 		return
 	}
 
@@ -83,15 +110,34 @@ func (h *Handler) handleChatCompletions(w http.ResponseWriter, r *http.Request)
 	maxRetries := 3
 	var lastErr error
 	var resp *openrouter.ChatResponse
+	reserved := false
 
 	for attempt := 0; attempt < maxRetries; attempt++ {
 		// Update model for this attempt
-		req.Model = h.getCurrentModelID()
+		modelID, err := h.dispatch.ModelID(reqs)
+		if err != nil {
+			h.writeRoutingError(w, err)
+			return
+		}
+		req.Model = modelID
+
+		if err := h.dispatch.Pace(r.Context(), req.Model); err != nil {
+			return
+		}
+		if reserved, err = h.dispatch.ReserveQuota(req.Model, reserved); err != nil {
+			h.writeQuotaError(w, err)
+			return
+		}
 
-		resp, lastErr = h.client.ChatCompletion(&req)
+		start := time.Now()
+		resp, lastErr = h.client.ChatCompletion(h.dispatch.PrepareRequest(&req))
 
 		if lastErr == nil {
-			// Success - write response
+			h.dispatch.RecordSuccess(req.Model, resp.RateLimit, manager.NewSample(start, time.Time{}, resp.Usage.CompletionTokens))
+
+			// Success - write response, reporting the model that actually
+			// answered
+			resp.Model = req.Model
 			w.Header().Set("Content-Type", "application/json")
 			w.Header().Set("X-Model-Used", req.Model)
 			if err := json.NewEncoder(w).Encode(resp); err != nil {
@@ -103,16 +149,16 @@ func (h *Handler) handleChatCompletions(w http.ResponseWriter, r *http.Request)
 		// Check if it's a timeout error
 		var timeoutErr *openrouter.TimeoutError
 		if errors.As(lastErr, &timeoutErr) {
-			if h.recordTimeout(req.Model) {
+			if h.dispatch.RecordTimeout(req.Model) {
 				log.Printf("[INFO] Model %s timed out, switching (attempt %d/%d)", req.Model, attempt+1, maxRetries)
 				continue
 			}
 		}
 
 		// Check if error is from API response
-		if apiErr := h.tryParseAPIError(lastErr); apiErr != nil {
+		if apiErr := dispatch.ParseAPIError(lastErr); apiErr != nil {
 			// Record failure and try switching
-			if h.recordFailure(req.Model, apiErr.Code) {
+			if h.dispatch.RecordFailure(req.Model, apiErr.Code, lastErr) {
 				log.Printf("[INFO] Retrying with new model (attempt %d/%d)", attempt+1, maxRetries)
 				continue
 			}
@@ -126,108 +172,207 @@ func (h *Handler) handleChatCompletions(w http.ResponseWriter, r *http.Request)
 	h.writeError(w, http.StatusInternalServerError, fmt.Sprintf("chat completion failed after %d attempts: %v", maxRetries, lastErr))
 }
 
-// handleStream handles streaming chat completion requests
-func (h *Handler) handleStream(w http.ResponseWriter, r *http.Request, req *openrouter.ChatRequest) {
+// handleStream handles streaming chat completion requests. The response
+// follows the OpenAI wire format: every chat.completion.chunk is sent as a
+// bare "data:" line and the stream is terminated with "data: [DONE]".
+func (h *Handler) handleStream(w http.ResponseWriter, r *http.Request, req *openrouter.ChatRequest, reqs model.Requirements) {
 	flusher, ok := w.(http.Flusher)
 	if !ok {
 		h.writeError(w, http.StatusInternalServerError, "streaming not supported")
 		return
 	}
 
+	// Usage is always requested upstream, but only forwarded when the
+	// client asked for it through stream_options.include_usage
+	includeUsage := req.StreamOptions != nil && req.StreamOptions.IncludeUsage
+	req.StreamOptions = &openrouter.StreamOptions{IncludeUsage: true}
+
+	// Nothing is sent before the first chunk arrives, so until then a
+	// failing model is replaced like in a non-streaming request
+	maxRetries := 3
+	var lastErr error
+	var start time.Time
+	var chunkChan <-chan openrouter.StreamChunk
+	var errChan <-chan error
+	var chunk openrouter.StreamChunk
+	started, reserved := false, false
+
+	for attempt := 0; attempt < maxRetries; attempt++ {
+		modelID, err := h.dispatch.ModelID(reqs)
+		if err != nil {
+			h.writeRoutingError(w, err)
+			return
+		}
+		req.Model = modelID
+
+		if err := h.dispatch.Pace(r.Context(), req.Model); err != nil {
+			return
+		}
+		if reserved, err = h.dispatch.ReserveQuota(req.Model, reserved); err != nil {
+			h.writeQuotaError(w, err)
+			return
+		}
+
+		start = time.Now()
+		chunkChan, errChan = h.client.StreamChatCompletionWithContext(r.Context(), h.dispatch.PrepareRequest(req))
+		select {
+		case chunk, ok = <-chunkChan:
+		case <-r.Context().Done():
+			return
+		}
+		// The producer closes errChan before chunkChan, so a pending error
+		// is always visible once chunkChan is closed
+		if ok {
+			started = true
+			break
+		}
+		if lastErr = <-errChan; lastErr == nil {
+			started = true
+			break
+		}
+		if !h.retryStream(req.Model, lastErr) {
+			break
+		}
+		log.Printf("[INFO] Retrying stream with new model (attempt %d/%d)", attempt+1, maxRetries)
+	}
+
+	if !started {
+		code := http.StatusBadGateway
+		if apiErr := dispatch.ParseAPIError(lastErr); apiErr != nil && apiErr.Code >= 400 && apiErr.Code < 600 {
+			code = apiErr.Code
+		}
+		h.writeError(w, code, fmt.Sprintf("chat completion failed: %v", lastErr))
+		return
+	}
+
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 
-	// Update model before starting stream
-	req.Model = h.getCurrentModelID()
+	// The server's write timeout is meant for ordinary responses; a stream
+	// lasts as long as the generation, bounded by the request's context
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("[DEBUG] Could not clear the write deadline of the stream: %v", err)
+	}
 
-	chunkChan, errChan := h.client.StreamChatCompletion(req)
+	var usage *openrouter.Usage
+	var rateLimit *openrouter.RateLimit
+	var last openrouter.StreamChunk
+	var firstToken time.Time
+	for ok {
+		if chunk.RateLimit != nil {
+			rateLimit = chunk.RateLimit
+		}
+		if firstToken.IsZero() && len(chunk.Choices) > 0 {
+			firstToken = time.Now()
+		}
+		h.normalizeChunk(&chunk, req.Model)
+		last = chunk
+
+		// Usage is held back and sent as its own chunk with an empty
+		// choices array right before [DONE]
+		usageOnly := false
+		if chunk.Usage != nil {
+			usage = chunk.Usage
+			chunk.Usage = nil
+			usageOnly = len(chunk.Choices) == 0
+		}
+		if !usageOnly {
+			h.writeSSEData(w, chunk)
+			flusher.Flush()
+		}
 
-	for {
 		select {
-		case chunk, ok := <-chunkChan:
-			if !ok {
-				h.writeServerEvent(w, "done", nil)
-				flusher.Flush()
-				return
-			}
-			h.writeServerEvent(w, "chunk", chunk)
-			flusher.Flush()
-		case err := <-errChan:
-			if err != nil {
-				// Try to parse as API error
-				if apiErr := h.tryParseAPIError(err); apiErr != nil {
-					h.recordFailure(req.Model, apiErr.Code)
-				}
-				h.writeServerEvent(w, "error", map[string]string{"error": err.Error()})
-				flusher.Flush()
-				return
-			}
+		case chunk, ok = <-chunkChan:
 		case <-r.Context().Done():
 			return
 		}
 	}
-}
 
-// getCurrentModelID gets the current model ID from model manager
-func (h *Handler) getCurrentModelID() string {
-	if h.modelManager != nil && h.modelManager.Current != nil {
-		return h.modelManager.Current.ID
+	if err := <-errChan; err != nil {
+		h.writeStreamError(w, req.Model, err)
+		flusher.Flush()
+		return
+	}
+	completionTokens := 0
+	if usage != nil {
+		completionTokens = usage.CompletionTokens
 	}
-	// Fallback to selector
-	if id, err := h.selector.GetBestModelID(); err == nil {
-		return id
+	h.dispatch.RecordSuccess(req.Model, rateLimit, manager.NewSample(start, firstToken, completionTokens))
+	if includeUsage {
+		if usage == nil {
+			usage = &openrouter.Usage{}
+		}
+		h.writeSSEData(w, openrouter.StreamChunk{
+			ID:                last.ID,
+			Object:            "chat.completion.chunk",
+			Created:           last.Created,
+			Model:             last.Model,
+			SystemFingerprint: last.SystemFingerprint,
+			Choices:           []openrouter.StreamChoice{},
+			Usage:             usage,
+		})
 	}
-	return ""
+	fmt.Fprint(w, "data: [DONE]\n\n")
+	flusher.Flush()
 }
 
-// tryParseAPIError attempts to parse an error as an API error
-func (h *Handler) tryParseAPIError(err error) *openrouter.APIError {
-	// Check if it's an HTTP error with status code
-	type httpError interface {
-		StatusCode() int
+// retryStream records the failure of a stream that failed before its first
+// chunk and reports whether it should be retried with another model
+func (h *Handler) retryStream(modelID string, err error) bool {
+	var timeoutErr *openrouter.TimeoutError
+	if errors.As(err, &timeoutErr) {
+		return h.dispatch.RecordTimeout(modelID)
 	}
-
-	if he, ok := err.(httpError); ok {
-		return &openrouter.APIError{
-			Code:    he.StatusCode(),
-			Message: err.Error(),
-		}
+	if apiErr := dispatch.ParseAPIError(err); apiErr != nil {
+		return h.dispatch.RecordFailure(modelID, apiErr.Code, err)
 	}
+	return false
+}
 
-	// Try to parse from error string
-	errStr := err.Error()
-	if strings.Contains(errStr, "status ") {
-		// Extract status code
-		parts := strings.Split(errStr, "status ")
-		if len(parts) > 1 {
-			var code int
-			fmt.Sscanf(parts[1], "%d", &code)
-			if code > 0 {
-				return &openrouter.APIError{
-					Code:    code,
-					Message: errStr,
-				}
-			}
-		}
+// normalizeChunk fills in the fields OpenAI clients rely on when the
+// upstream provider leaves them out, and reports the model that actually
+// answered
+func (h *Handler) normalizeChunk(chunk *openrouter.StreamChunk, modelID string) {
+	if chunk.Object == "" {
+		chunk.Object = "chat.completion.chunk"
 	}
+	chunk.Model = modelID
+	if chunk.Created == 0 {
+		chunk.Created = time.Now().Unix()
+	}
+	if chunk.Choices == nil {
+		chunk.Choices = []openrouter.StreamChoice{}
+	}
+}
 
-	return nil
+// writeStreamError records the failure and sends it as an OpenAI error
+// object inside the event stream
+func (h *Handler) writeStreamError(w http.ResponseWriter, modelID string, err error) {
+	code := http.StatusInternalServerError
+	if apiErr := dispatch.ParseAPIError(err); apiErr != nil {
+		h.dispatch.RecordFailure(modelID, apiErr.Code, err)
+		code = apiErr.Code
+	}
+	h.writeSSEData(w, map[string]interface{}{
+		"error": map[string]string{
+			"message": err.Error(),
+			"type":    "api_error",
+			"code":    fmt.Sprintf("%d", code),
+		},
+	})
 }
 
-// writeServerEvent writes a server-sent event
-func (h *Handler) writeServerEvent(w http.ResponseWriter, eventType string, data interface{}) {
-	var jsonData string
-	if data != nil {
-		bytes, err := json.Marshal(data)
-		if err != nil {
-			return
-		}
-		jsonData = string(bytes)
+// writeSSEData writes a single "data:" frame of a server-sent event stream
+func (h *Handler) writeSSEData(w http.ResponseWriter, data interface{}) {
+	bytes, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("[ERROR] failed to encode stream chunk: %v", err)
+		return
 	}
 
-	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", eventType, jsonData)
+	fmt.Fprintf(w, "data: %s\n\n", bytes)
 }
 
 // handleModels handles model list requests
@@ -241,9 +386,10 @@ func (h *Handler) handleModels(w http.ResponseWriter, r *http.Request) {
 	var err error
 
 	// Use model manager candidates if available
-	if h.modelManager != nil && len(h.modelManager.Candidates) > 0 {
-		models = h.modelManager.Candidates
-	} else {
+	if mgr := h.dispatch.Manager(); mgr != nil {
+		models = append(mgr.Candidates(), mgr.Fallbacks()...)
+	}
+	if len(models) == 0 {
 		models, err = h.client.GetFreeModels()
 		if err != nil {
 			h.writeError(w, http.StatusInternalServerError, fmt.Sprintf("failed to get models: %v", err))
@@ -260,12 +406,29 @@ func (h *Handler) handleModels(w http.ResponseWriter, r *http.Request) {
 	}
 
 	openaiModels := []OpenAIModel{}
+
+	// Names that route to a policy, a preference or the proxy's choice
+	if router := h.dispatch.Router(); router != nil {
+		for _, name := range router.Names() {
+			openaiModels = append(openaiModels, OpenAIModel{
+				ID:      name,
+				Object:  "model",
+				Created: 0,
+				OwnedBy: "frugalai",
+			})
+		}
+	}
+
 	for _, model := range models {
+		ownedBy := model.Provider
+		if ownedBy == "" {
+			ownedBy = "openrouter"
+		}
 		openaiModels = append(openaiModels, OpenAIModel{
 			ID:      model.ID,
 			Object:  "model",
 			Created: 0,
-			OwnedBy: "openrouter",
+			OwnedBy: ownedBy,
 		})
 	}
 
@@ -278,10 +441,9 @@ func (h *Handler) handleModels(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
-// InvalidateCache invalidates the cached model ID
+// InvalidateCache invalidates the cached model list
 func (h *Handler) InvalidateCache() {
-	h.mu.Lock()
-	defer h.mu.Unlock()
+	h.client.InvalidateCache()
 }
 
 // writeError writes an error response
@@ -298,156 +460,60 @@ func (h *Handler) writeError(w http.ResponseWriter, status int, message string)
 	json.NewEncoder(w).Encode(errorResp)
 }
 
-// ConvertAnthropicToOpenAI converts Anthropic format to OpenAI format
-func ConvertAnthropicToOpenAI(anthropicReq map[string]interface{}) (*openrouter.ChatRequest, error) {
-	req := &openrouter.ChatRequest{
-		Temperature: 0.7,
-		MaxTokens:   4096,
-	}
-
-	// Get model
-	if model, ok := anthropicReq["model"].(string); ok {
-		req.Model = model
-	}
-
-	// Get max tokens
-	if maxTokens, ok := anthropicReq["max_tokens"].(float64); ok {
-		req.MaxTokens = int(maxTokens)
-	}
-
-	// Get temperature
-	if temp, ok := anthropicReq["temperature"].(float64); ok {
-		req.Temperature = temp
-	}
-
-	// Convert messages
-	messages, ok := anthropicReq["messages"].([]interface{})
-	if !ok {
-		return nil, fmt.Errorf("invalid messages format")
-	}
-
-	for _, msg := range messages {
-		msgMap, ok := msg.(map[string]interface{})
-		if !ok {
-			continue
-		}
-
-		role, _ := msgMap["role"].(string)
-
-		// Handle content (can be string or array of blocks)
-		var content string
-		switch c := msgMap["content"].(type) {
-		case string:
-			content = c
-		case []interface{}:
-			var textParts []string
-			for _, block := range c {
-				blockMap, ok := block.(map[string]interface{})
-				if !ok {
-					continue
-				}
-				if blockType, ok := blockMap["type"].(string); ok && blockType == "text" {
-					if text, ok := blockMap["text"].(string); ok {
-						textParts = append(textParts, text)
-					}
-				}
-			}
-			content = strings.Join(textParts, "\n")
-		}
-
-		// Handle system prompt
-		if role == "system" {
-			// Add as user message for now (OpenRouter will handle it)
-			req.Messages = append(req.Messages, openrouter.ChatMessage{
-				Role:    "user",
-				Content: content,
-			})
-		} else {
-			req.Messages = append(req.Messages, openrouter.ChatMessage{
-				Role:    role,
-				Content: content,
-			})
+// writeQuotaError writes a 429 for a request rejected by the daily free
+// model quota, in the shape OpenAI uses for rate limits and quota errors
+func (h *Handler) writeQuotaError(w http.ResponseWriter, err error) {
+	code := "rate_limit_exceeded"
+	errType := "requests"
+	var quotaErr *quota.Error
+	if errors.As(err, &quotaErr) {
+		w.Header().Set("Retry-After", fmt.Sprintf("%.0f", math.Ceil(quotaErr.RetryAfter.Seconds())))
+		if quotaErr.Exhausted {
+			code = "insufficient_quota"
+			errType = "insufficient_quota"
 		}
 	}
 
-	return req, nil
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{
+			"message": err.Error(),
+			"type":    errType,
+			"code":    code,
+		},
+	})
 }
 
-// recordFailure records a model failure and potentially switches models
-func (h *Handler) recordFailure(modelID string, statusCode int) bool {
-	if h.modelManager == nil {
-		return false
+// writeRoutingError writes the error for a request that could not be routed
+// to any model. Context overflows are reported like OpenAI does, and
+// requests whose routing hints no model meets as invalid requests.
+func (h *Handler) writeRoutingError(w http.ResponseWriter, err error) {
+	var overflow *model.ContextOverflowError
+	var constraint *model.ConstraintError
+	var param, code string
+	switch {
+	case errors.As(err, &overflow):
+		param, code = "messages", "context_length_exceeded"
+	case errors.As(err, &constraint):
+		code = "no_matching_model"
+	default:
+		h.writeError(w, http.StatusInternalServerError, err.Error())
+		return
 	}
 
-	h.mu.Lock()
-	defer h.mu.Unlock()
-
-	h.modelManager.Failures[modelID]++
-	h.modelManager.LastFailure[modelID] = time.Now()
-
-	log.Printf("[WARN] Model %s failed (status %d), failure count: %d",
-		modelID, statusCode, h.modelManager.Failures[modelID])
-
-	// Switch on rate limit, server error, or 3+ failures
-	shouldSwitch := statusCode == 429 || statusCode >= 500 || h.modelManager.Failures[modelID] >= 3
-
-	if shouldSwitch && len(h.modelManager.Candidates) > 1 {
-		return h.switchToNextModel()
+	errBody := map[string]interface{}{
+		"message": err.Error(),
+		"type":    "invalid_request_error",
+		"code":    code,
 	}
-
-	return false
-}
-
-// recordTimeout records a model timeout and potentially burns/switches it
-func (h *Handler) recordTimeout(modelID string) bool {
-	if h.modelManager == nil {
-		return false
+	if param != "" {
+		errBody["param"] = param
 	}
 
-	h.mu.Lock()
-	defer h.mu.Unlock()
-
-	h.modelManager.Timeouts[modelID]++
-
-	log.Printf("[WARN] Model %s timed out, timeout count: %d",
-		modelID, h.modelManager.Timeouts[modelID])
-
-	// Burn model on first timeout
-	h.modelManager.Burned[modelID] = true
-	log.Printf("[WARN] Model %s burned after %d timeouts",
-		modelID, h.modelManager.Timeouts[modelID])
-
-	if len(h.modelManager.Candidates) > 1 {
-		return h.switchToNextModel()
-	}
-
-	return false
-}
-
-// switchToNextModel switches to the next available non-burned model
-func (h *Handler) switchToNextModel() bool {
-	for i := 1; i < len(h.modelManager.Candidates); i++ {
-		nextIdx := (h.modelManager.CurrentIdx + i) % len(h.modelManager.Candidates)
-		nextModel := h.modelManager.Candidates[nextIdx]
-
-		// Skip burned models
-		if h.modelManager.Burned[nextModel.ID] {
-			continue
-		}
-
-		// Skip models with 3+ recent failures
-		if h.modelManager.Failures[nextModel.ID] >= 3 {
-			continue
-		}
-
-		log.Printf("[INFO] Switching from %s to %s",
-			h.modelManager.Current.ID, nextModel.ID)
-
-		h.modelManager.Current = &nextModel
-		h.modelManager.CurrentIdx = nextIdx
-		return true
-	}
-
-	log.Printf("[WARN] No alternative models available")
-	return false
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": errBody,
+	})
 }
@@ -0,0 +1,257 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mosajjal/frugalai/internal/manager"
+	"github.com/mosajjal/frugalai/internal/openrouter"
+	"github.com/mosajjal/frugalai/internal/quota"
+)
+
+// fakeProvider streams fixed chunks and records the models it was asked
+// for. The first requests fail with errs before sending any chunk.
+type fakeProvider struct {
+	chunks []openrouter.StreamChunk
+	errs   []error
+	models []string
+}
+
+func (p *fakeProvider) Name() string                               { return "fake" }
+func (p *fakeProvider) GetModels() ([]openrouter.Model, error)     { return nil, nil }
+func (p *fakeProvider) GetFreeModels() ([]openrouter.Model, error) { return nil, nil }
+func (p *fakeProvider) InvalidateCache()                           {}
+
+func (p *fakeProvider) ChatCompletion(req *openrouter.ChatRequest) (*openrouter.ChatResponse, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (p *fakeProvider) StreamChatCompletionWithContext(ctx context.Context, req *openrouter.ChatRequest) (<-chan openrouter.StreamChunk, <-chan error) {
+	p.models = append(p.models, req.Model)
+	chunkChan := make(chan openrouter.StreamChunk, len(p.chunks))
+	errChan := make(chan error, 1)
+	if len(p.errs) > 0 {
+		errChan <- p.errs[0]
+		p.errs = p.errs[1:]
+		close(errChan)
+		close(chunkChan)
+		return chunkChan, errChan
+	}
+	for _, chunk := range p.chunks {
+		chunkChan <- chunk
+	}
+	close(errChan)
+	close(chunkChan)
+	return chunkChan, errChan
+}
+
+// parseChunks parses stream chunks given as JSON
+func parseChunks(t *testing.T, chunks ...string) []openrouter.StreamChunk {
+	t.Helper()
+	parsed := make([]openrouter.StreamChunk, len(chunks))
+	for i, c := range chunks {
+		if err := json.Unmarshal([]byte(c), &parsed[i]); err != nil {
+			t.Fatalf("invalid chunk %s: %v", c, err)
+		}
+	}
+	return parsed
+}
+
+// testHandler returns a handler over p with two candidates to fail over
+// between
+func testHandler(p *fakeProvider) *Handler {
+	mgr := manager.New()
+	mgr.SetCandidates([]openrouter.Model{{ID: "a/one:free", ContextLength: 8192}, {ID: "b/two:free", ContextLength: 8192}}, 0)
+	return NewHandlerWithManager(nil, p, mgr)
+}
+
+// stream sends a streaming request through a handler over p and returns
+// the response
+func stream(t *testing.T, p *fakeProvider, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	return streamWith(testHandler(p), body)
+}
+
+// streamWith sends a streaming request through h and returns the response
+func streamWith(h *Handler, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h.handleChatCompletions(rec, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body)))
+	return rec
+}
+
+// frames returns the data of each frame of an event stream
+func frames(t *testing.T, body string) []string {
+	t.Helper()
+	var data []string
+	for _, frame := range strings.Split(strings.TrimSpace(body), "\n\n") {
+		d, ok := strings.CutPrefix(frame, "data: ")
+		if !ok {
+			t.Fatalf("frame %q is not a data line", frame)
+		}
+		data = append(data, d)
+	}
+	return data
+}
+
+func TestStreamFrames(t *testing.T) {
+	chunks := []string{
+		`{"id":"gen-1","created":1700000000,"model":"upstream/name","choices":[{"index":0,"delta":{"role":"assistant","content":"Hi"},"finish_reason":null}]}`,
+		`{"id":"gen-1","created":1700000000,"model":"upstream/name","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`,
+		`{"id":"gen-1","created":1700000000,"model":"upstream/name","choices":[],"usage":{"prompt_tokens":3,"completion_tokens":1,"total_tokens":4}}`,
+	}
+
+	tests := []struct {
+		name  string
+		body  string
+		usage bool
+	}{
+		{name: "usage requested", body: `{"model":"auto","stream":true,"stream_options":{"include_usage":true},"messages":[{"role":"user","content":"Hi"}]}`, usage: true},
+		{name: "usage not requested", body: `{"model":"auto","stream":true,"messages":[{"role":"user","content":"Hi"}]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := stream(t, &fakeProvider{chunks: parseChunks(t, chunks...)}, tt.body)
+			if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "text/event-stream" {
+				t.Fatalf("response = %d %s, want a 200 event stream", rec.Code, rec.Header().Get("Content-Type"))
+			}
+
+			data := frames(t, rec.Body.String())
+			if data[len(data)-1] != "[DONE]" {
+				t.Fatalf("last frame = %s, want [DONE]", data[len(data)-1])
+			}
+			data = data[:len(data)-1]
+
+			want := 2
+			if tt.usage {
+				want++
+			}
+			if len(data) != want {
+				t.Fatalf("got %d chunks, want %d:\n%s", len(data), want, rec.Body.String())
+			}
+
+			for i, d := range data {
+				var chunk map[string]interface{}
+				if err := json.Unmarshal([]byte(d), &chunk); err != nil {
+					t.Fatalf("chunk %d = %s: %v", i, d, err)
+				}
+				if chunk["object"] != "chat.completion.chunk" || chunk["model"] != "a/one:free" {
+					t.Errorf("chunk %d = %s, want a chat.completion.chunk of the model used", i, d)
+				}
+				choices, _ := chunk["choices"].([]interface{})
+				_, hasUsage := chunk["usage"]
+				last := i == len(data)-1
+				switch {
+				case tt.usage && last && (len(choices) != 0 || !hasUsage):
+					t.Errorf("usage chunk = %s, want empty choices and the usage", d)
+				case !(tt.usage && last) && (len(choices) == 0 || hasUsage):
+					t.Errorf("chunk %d = %s, want choices and no usage", i, d)
+				}
+			}
+		})
+	}
+}
+
+func TestStreamKeepsDeltaFields(t *testing.T) {
+	p := &fakeProvider{chunks: parseChunks(t,
+		`{"id":"gen-1","choices":[{"index":0,"delta":{"role":"assistant","reasoning":"Thinking","reasoning_details":[{"type":"reasoning.text","text":"Thinking"}]},"logprobs":{"content":[{"token":"I","logprob":-0.1}]}}]}`,
+		`{"id":"gen-1","choices":[{"index":0,"delta":{"reasoning_content":"More"}}]}`,
+		`{"id":"gen-1","choices":[{"index":0,"delta":{"refusal":"I can't help with that."},"finish_reason":"stop"}]}`,
+	)}
+	rec := stream(t, p, `{"model":"auto","stream":true,"messages":[{"role":"user","content":"Hi"}]}`)
+
+	data := frames(t, rec.Body.String())
+	if len(data) != 4 {
+		t.Fatalf("got %d frames, want 3 chunks and [DONE]:\n%s", len(data), rec.Body.String())
+	}
+	for _, tt := range []struct {
+		frame int
+		want  string
+	}{
+		{0, `"delta":{"role":"assistant","reasoning":"Thinking","reasoning_details":[{"type":"reasoning.text","text":"Thinking"}]}`},
+		{0, `"logprobs":{"content":[{"token":"I","logprob":-0.1}]}`},
+		{1, `"delta":{"reasoning_content":"More"}`},
+		{2, `"delta":{"refusal":"I can't help with that."}`},
+	} {
+		if !strings.Contains(data[tt.frame], tt.want) {
+			t.Errorf("chunk %s is missing %s", data[tt.frame], tt.want)
+		}
+	}
+}
+
+func TestStreamFailover(t *testing.T) {
+	body := `{"model":"auto","stream":true,"messages":[{"role":"user","content":"Hi"}]}`
+	chunks := parseChunks(t, `{"id":"gen-1","choices":[{"index":0,"delta":{"content":"Hi"},"finish_reason":"stop"}]}`)
+
+	p := &fakeProvider{chunks: chunks, errs: []error{&openrouter.HTTPError{Code: 503, Message: "Service unavailable"}}}
+	rec := stream(t, p, body)
+	if rec.Code != http.StatusOK || len(p.models) != 2 || p.models[1] != "b/two:free" {
+		t.Fatalf("response = %d after asking %v, want a 200 from the second model", rec.Code, p.models)
+	}
+	if data := frames(t, rec.Body.String()); len(data) != 2 || !strings.Contains(data[0], `"model":"b/two:free"`) {
+		t.Errorf("frames = %v, want the second model's chunk and [DONE]", data)
+	}
+
+	// The request counts against the daily quota once, not per attempt
+	q := quota.New()
+	q.Update(&openrouter.KeyInfo{})
+	p = &fakeProvider{chunks: chunks, errs: []error{&openrouter.HTTPError{Code: 503, Message: "Service unavailable"}}}
+	h := testHandler(p)
+	h.SetQuota(q, nil)
+	if rec := streamWith(h, body); rec.Code != http.StatusOK || len(p.models) != 2 {
+		t.Fatalf("response = %d after asking %v, want a 200 from the second model", rec.Code, p.models)
+	}
+	if used := q.Status().UsedToday; used != 1 {
+		t.Errorf("quota used = %d after one request, want 1", used)
+	}
+
+	tests := []struct {
+		name string
+		errs []error
+		want int
+	}{
+		{name: "every model fails", errs: []error{
+			&openrouter.HTTPError{Code: 503, Message: "Service unavailable"},
+			&openrouter.HTTPError{Code: 503, Message: "Service unavailable"},
+			&openrouter.HTTPError{Code: 503, Message: "Service unavailable"},
+		}, want: http.StatusServiceUnavailable},
+		{name: "not retried", errs: []error{errors.New("failed to decode chunk")}, want: http.StatusBadGateway},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := stream(t, &fakeProvider{chunks: chunks, errs: tt.errs}, body)
+			if rec.Code != tt.want || strings.HasPrefix(rec.Body.String(), "data:") {
+				t.Errorf("response = %d %s, want a %d error", rec.Code, rec.Body.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestStreamKeepsToolCallIndex(t *testing.T) {
+	p := &fakeProvider{chunks: parseChunks(t,
+		`{"id":"gen-1","choices":[{"index":0,"delta":{"role":"assistant","tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"get_weather","arguments":""}}]}}]}`,
+		`{"id":"gen-1","choices":[{"index":0,"delta":{"tool_calls":[{"index":1,"id":"call_2","type":"function","function":{"name":"get_time","arguments":""}}]}}]}`,
+		`{"id":"gen-1","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"city\":\"Paris\"}"}}]},"finish_reason":"tool_calls"}]}`,
+	)}
+	rec := stream(t, p, `{"model":"auto","stream":true,"messages":[{"role":"user","content":"Hi"}]}`)
+
+	data := frames(t, rec.Body.String())
+	if len(data) != 4 {
+		t.Fatalf("got %d frames, want 3 chunks and [DONE]:\n%s", len(data), rec.Body.String())
+	}
+	for i, want := range []string{
+		`"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"get_weather","arguments":""}}]`,
+		`"tool_calls":[{"index":1,"id":"call_2","type":"function","function":{"name":"get_time","arguments":""}}]`,
+		`"tool_calls":[{"index":0,"function":{"arguments":"{\"city\":\"Paris\"}"}}]`,
+	} {
+		if !strings.Contains(data[i], want) {
+			t.Errorf("chunk %s is missing %s", data[i], want)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package tokenizer
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"unicode"
+
+	"github.com/mosajjal/frugalai/internal/openrouter"
+)
+
+const (
+	// messageOverhead covers the role and separator tokens of a message
+	messageOverhead = 4
+
+	// replyOverhead covers the tokens that prime the assistant's reply
+	replyOverhead = 3
+
+	// imageTokens is a rough cost of a typical image across providers
+	imageTokens = 1024
+)
+
+// Estimator counts the tokens of a piece of text
+type Estimator interface {
+	CountTokens(text string) int
+}
+
+// ForFamily returns the estimator for a tokenizer family as reported by
+// Architecture.Tokenizer (e.g. "GPT", "Llama3"), falling back to a generic
+// heuristic for unknown families
+func ForFamily(family string) Estimator {
+	if h, ok := heuristics[strings.ToLower(family)]; ok {
+		return h
+	}
+	return defaultHeuristic
+}
+
+// CountTokens estimates the tokens of text for a tokenizer family
+func CountTokens(family, text string) int {
+	return ForFamily(family).CountTokens(text)
+}
+
+// EstimateRequest estimates the input tokens of a chat request for a
+// tokenizer family, including message overhead, images, tool calls and
+// tool definitions
+func EstimateRequest(req *openrouter.ChatRequest, family string) int {
+	e := ForFamily(family)
+
+	total := replyOverhead
+	for _, msg := range req.Messages {
+		total += messageOverhead
+		if msg.Content.Parts == nil {
+			total += e.CountTokens(msg.Content.Text)
+		}
+		for _, part := range msg.Content.Parts {
+			switch part.Type {
+			case "text":
+				total += e.CountTokens(part.Text)
+			case "image_url":
+				total += imageTokens
+			}
+		}
+		for _, tc := range msg.ToolCalls {
+			total += e.CountTokens(tc.Function.Name) + e.CountTokens(tc.Function.Arguments)
+		}
+	}
+
+	if len(req.Tools) > 0 {
+		if b, err := json.Marshal(req.Tools); err == nil {
+			total += e.CountTokens(string(b))
+		}
+	}
+
+	return total
+}
+
+// heuristic estimates tokens from the shape of the text. Words, digit runs,
+// punctuation and CJK characters tokenize very differently, so each class is
+// counted with its own ratio. The ratios are rough per-family guesses from
+// vocabulary size and digit handling, not measurements, so estimates are only
+// good for deciding whether a request is near a context limit.
+type heuristic struct {
+	// charsPerToken is the average length of a word piece
+	charsPerToken float64
+	// digitsPerToken is how many digits are merged into one token; tokenizers
+	// that split numbers into single digits use 1
+	digitsPerToken float64
+	// cjkPerToken is how many CJK characters share one token on average
+	cjkPerToken float64
+}
+
+var defaultHeuristic = heuristic{charsPerToken: 3.6, digitsPerToken: 1, cjkPerToken: 0.8}
+
+var heuristics = map[string]heuristic{
+	"gpt":      {charsPerToken: 4.0, digitsPerToken: 3, cjkPerToken: 0.9},
+	"claude":   {charsPerToken: 3.5, digitsPerToken: 1, cjkPerToken: 0.8},
+	"llama2":   {charsPerToken: 3.3, digitsPerToken: 1, cjkPerToken: 0.6},
+	"llama3":   {charsPerToken: 4.0, digitsPerToken: 3, cjkPerToken: 0.9},
+	"llama4":   {charsPerToken: 4.2, digitsPerToken: 3, cjkPerToken: 1.1},
+	"mistral":  {charsPerToken: 3.4, digitsPerToken: 1, cjkPerToken: 0.7},
+	"gemini":   {charsPerToken: 4.2, digitsPerToken: 1, cjkPerToken: 1.2},
+	"qwen":     {charsPerToken: 3.9, digitsPerToken: 1, cjkPerToken: 1.4},
+	"qwen3":    {charsPerToken: 3.9, digitsPerToken: 1, cjkPerToken: 1.4},
+	"deepseek": {charsPerToken: 3.8, digitsPerToken: 3, cjkPerToken: 1.3},
+	"cohere":   {charsPerToken: 4.0, digitsPerToken: 1, cjkPerToken: 0.9},
+	"grok":     {charsPerToken: 4.0, digitsPerToken: 3, cjkPerToken: 0.9},
+	"nova":     {charsPerToken: 4.0, digitsPerToken: 3, cjkPerToken: 0.9},
+}
+
+// runClass is the character class of a run of text
+type runClass int
+
+const (
+	classNone runClass = iota
+	classLetter
+	classForeign
+	classDigit
+	classSpace
+	classCJK
+	classSymbol
+)
+
+// CountTokens estimates the number of tokens in text
+func (h heuristic) CountTokens(text string) int {
+	total := 0.0
+	class := classNone
+	length := 0
+	newline := false
+	var last rune
+
+	flush := func() {
+		switch class {
+		case classLetter:
+			total += math.Max(1, math.Round(float64(length)/h.charsPerToken))
+		case classForeign:
+			// Non-Latin alphabets get far fewer merges
+			total += math.Max(1, math.Round(float64(length)/(h.charsPerToken/2)))
+		case classDigit:
+			total += math.Ceil(float64(length) / h.digitsPerToken)
+		case classSpace:
+			if newline || length > 1 {
+				total++
+			}
+		case classCJK:
+			total += math.Ceil(float64(length) / h.cjkPerToken)
+		case classSymbol:
+			// Repeated symbols such as "====" or "----" merge well
+			total += math.Ceil(float64(length) / 4)
+		}
+		class = classNone
+		length = 0
+		newline = false
+	}
+
+	for _, r := range text {
+		c := classify(r)
+
+		// Only runs of the same symbol are merged
+		if c != class || (c == classSymbol && r != last) {
+			flush()
+			class = c
+		}
+		length++
+		if r == '\n' {
+			newline = true
+		}
+		last = r
+	}
+	flush()
+
+	return int(total)
+}
+
+// classify returns the character class of r
+func classify(r rune) runClass {
+	switch {
+	case unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) ||
+		unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r):
+		return classCJK
+	case unicode.IsLetter(r) || r == '_':
+		// Latin letters, including accented ones
+		if r < 0x0250 {
+			return classLetter
+		}
+		return classForeign
+	case unicode.IsDigit(r):
+		return classDigit
+	case unicode.IsSpace(r):
+		return classSpace
+	default:
+		return classSymbol
+	}
+}
@@ -0,0 +1,98 @@
+package tokenizer
+
+import (
+	"testing"
+
+	"github.com/mosajjal/frugalai/internal/openrouter"
+)
+
+func TestCountTokens(t *testing.T) {
+	tests := []struct {
+		name   string
+		family string
+		text   string
+		want   int
+	}{
+		{name: "empty", family: "GPT", text: "", want: 0},
+		{name: "English prose", family: "GPT", text: "The quick brown fox jumps over the lazy dog.", want: 10},
+		{name: "family is case-insensitive", family: "gpt", text: "The quick brown fox jumps over the lazy dog.", want: 10},
+		{name: "long words split", family: "GPT", text: "internationalization", want: 5},
+		{name: "digits merge in threes", family: "Llama3", text: "1234567", want: 3},
+		{name: "digits split one by one", family: "Mistral", text: "1234567", want: 7},
+		{name: "CJK with a large vocabulary", family: "Qwen", text: "你好世界", want: 3},
+		{name: "CJK with the default heuristic", family: "unknown", text: "你好世界", want: 5},
+		{name: "non-Latin letters", family: "GPT", text: "привет", want: 3},
+		{name: "single spaces are free", family: "GPT", text: "a b", want: 2},
+		{name: "newlines and indentation count", family: "GPT", text: "a\n    b", want: 3},
+		{name: "repeated symbols merge", family: "GPT", text: "========", want: 2},
+		{name: "mixed symbols do not", family: "GPT", text: "{}()", want: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CountTokens(tt.family, tt.text); got != tt.want {
+				t.Errorf("CountTokens(%q, %q) = %d, want %d", tt.family, tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEstimateRequest(t *testing.T) {
+	user := func(text string) openrouter.ChatMessage {
+		return openrouter.ChatMessage{Role: "user", Content: openrouter.TextContent(text)}
+	}
+
+	tests := []struct {
+		name string
+		req  *openrouter.ChatRequest
+		want int
+	}{
+		{
+			name: "empty request pays the reply overhead",
+			req:  &openrouter.ChatRequest{},
+			want: replyOverhead,
+		},
+		{
+			name: "each message pays its overhead",
+			req:  &openrouter.ChatRequest{Messages: []openrouter.ChatMessage{user("Hi"), user("Hi")}},
+			want: replyOverhead + 2*(messageOverhead+1),
+		},
+		{
+			name: "images cost a fixed amount",
+			req: &openrouter.ChatRequest{Messages: []openrouter.ChatMessage{{Role: "user", Content: openrouter.PartsContent([]openrouter.ContentPart{
+				{Type: "text", Text: "Hi"},
+				{Type: "image_url", ImageURL: &openrouter.ImageURL{URL: "https://example.com/cat.jpg"}},
+			})}}},
+			want: replyOverhead + messageOverhead + 1 + imageTokens,
+		},
+		{
+			name: "tool calls count their name and arguments",
+			req: &openrouter.ChatRequest{Messages: []openrouter.ChatMessage{{
+				Role: "assistant",
+				ToolCalls: []openrouter.ToolCall{{Type: "function", Function: openrouter.FunctionCall{
+					Name:      "weather",
+					Arguments: `{"city":"Paris"}`,
+				}}},
+			}}},
+			// "weather" is 2 tokens, the arguments 9
+			want: replyOverhead + messageOverhead + 2 + 9,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := EstimateRequest(tt.req, "GPT"); got != tt.want {
+				t.Errorf("EstimateRequest() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("tool definitions are counted", func(t *testing.T) {
+		req := &openrouter.ChatRequest{Messages: []openrouter.ChatMessage{user("Hi")}}
+		without := EstimateRequest(req, "GPT")
+		req.Tools = []openrouter.Tool{{Type: "function", Function: openrouter.FunctionDefinition{Name: "get_weather"}}}
+		if with := EstimateRequest(req, "GPT"); with <= without {
+			t.Errorf("EstimateRequest() with tools = %d, want more than %d", with, without)
+		}
+	})
+}